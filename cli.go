@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nmohnblatt/contact_discovery2/identity"
+	"go.dedis.ch/kyber/v3/pairing"
+)
+
+// passphraseVariable names the environment variable holding the passphrase of the servers' keystores
+const passphraseVariable = "CONTACT_DISCOVERY_PASSPHRASE"
+
+// stubIssuerTTL is the validity of the tokens handed out by the stub identity provider
+const stubIssuerTTL = time.Hour
+
+// command is a subcommand of the command-line interface
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"setup", "generate the public parameters and the servers' encrypted share files", runSetup},
+	{"server", "run one signing server", runServer},
+	{"reshare", "refresh the servers' shares or move them to a new committee", runReshare},
+	{"issuer", "serve the stub identity provider written by setup, for tests only", runIssuer},
+	{"enroll", "obtain the constraining keys for an identifier", runEnroll},
+	{"discover", "check a contact list against a meeting store", runDiscover},
+	{"store", "serve a meeting store over HTTP", runStore},
+	{"inspect", "dump public parameters", runInspect},
+	{"export-commitments", "dump the public commitments held in the servers' share files", runExportCommitments},
+	{"loadgen", "enroll many concurrent users against running servers and report latencies", runLoadgen},
+	{"demo", "run the interactive demo with in-process servers", runDemo},
+}
+
+// run dispatches the command line to a subcommand
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" {
+		usage(stdout)
+		return nil
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			if err := c.run(args[1:], stdout); err != flag.ErrHelp {
+				return err
+			}
+			return nil
+		}
+	}
+
+	usage(stdout)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: contact_discovery2 <command> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-20s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nEvery command accepts -config to read its flags from a JSON file. Run a command with -h to list its flags.")
+}
+
+// newFlagSet returns the flag set of a subcommand, with the -config flag every subcommand accepts
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	config := fs.String("config", "", "JSON file holding default values for the flags")
+	return fs, config
+}
+
+// parseFlags parses the command line and fills the flags it does not set from the config file
+func parseFlags(fs *flag.FlagSet, config *string, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected argument %q", fs.Name(), fs.Arg(0))
+	}
+	if *config == "" {
+		return nil
+	}
+
+	return applyConfig(fs, *config)
+}
+
+// applyConfig sets the flags that were not given on the command line from a JSON config file. Top-level
+// keys apply to every command that has a flag of that name, keys of an object named after a command
+// apply to that command only and take precedence
+func applyConfig(fs *flag.FlagSet, path string) error {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+	var config map[string]interface{}
+	if err := decoder.Decode(&config); err != nil {
+		return fmt.Errorf("config %s: %v", path, err)
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	values := make(map[string]interface{})
+	for key, value := range config {
+		if _, section := value.(map[string]interface{}); !section && fs.Lookup(key) != nil {
+			values[key] = value
+		}
+	}
+	if section, found := config[fs.Name()].(map[string]interface{}); found {
+		for key, value := range section {
+			if fs.Lookup(key) == nil {
+				return fmt.Errorf("config %s: %s has no flag %q", path, fs.Name(), key)
+			}
+			values[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if given[key] || key == "config" {
+			continue
+		}
+		if err := fs.Set(key, fmt.Sprint(values[key])); err != nil {
+			return fmt.Errorf("config %s: %s: %v", path, key, err)
+		}
+	}
+
+	return nil
+}
+
+// readPassphrase reads the keystore passphrase from a file, or from the environment when no file is given
+func readPassphrase(path string) ([]byte, error) {
+	if path == "" {
+		passphrase := os.Getenv(passphraseVariable)
+		if passphrase == "" {
+			return nil, fmt.Errorf("no passphrase: set $%s or give a passphrase file", passphraseVariable)
+		}
+		return []byte(passphrase), nil
+	}
+
+	return readSecret(path)
+}
+
+// readSecret reads a passphrase or a token from a file, without the trailing newline
+func readSecret(path string) ([]byte, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret := bytes.TrimRight(buf, "\r\n")
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%s: empty file", path)
+	}
+
+	return secret, nil
+}
+
+// loadParametersFile reads public parameters in either encoding and checks them against the pinned fingerprint
+func loadParametersFile(path, pinned string) (publicParameters, []*serverEndpoint, error) {
+	if path == "" {
+		return publicParameters{}, nil, errors.New("no parameters file given")
+	}
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return publicParameters{}, nil, err
+	}
+	if bytes.HasPrefix(buf, parametersMagic) {
+		return unmarshalParametersBinary(buf, pinned)
+	}
+
+	return unmarshalParametersJSON(buf, pinned)
+}
+
+// saveStubIssuer writes the seed of a stub identity provider's key. Anyone holding it can attest any identifier
+func saveStubIssuer(path string, issuer *identity.StubIssuer) error {
+	return ioutil.WriteFile(path, []byte(hex.EncodeToString(issuer.Seed())+"\n"), 0600)
+}
+
+// loadStubIssuer restores a stub identity provider written by saveStubIssuer
+func loadStubIssuer(path string, suite pairing.Suite) (*identity.StubIssuer, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return identity.NewStubIssuerFromSeed(suite, seed, stubIssuerTTL)
+}
+
+// saveIssuerPublicKey writes the public key servers check attestations with
+func saveIssuerPublicKey(path string, verifier *identity.Ed25519Verifier) error {
+	return ioutil.WriteFile(path, []byte(hex.EncodeToString(verifier.PublicKey)+"\n"), 0644)
+}
+
+// loadIssuerVerifier returns a verifier for the attestations signed by the identity provider whose public key
+// was written by saveIssuerPublicKey
+func loadIssuerVerifier(path string) (*identity.Ed25519Verifier, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%s: invalid public key length", path)
+	}
+
+	return &identity.Ed25519Verifier{PublicKey: ed25519.PublicKey(key)}, nil
+}
+
+// splitList splits a comma separated flag value, ignoring empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
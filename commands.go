@@ -0,0 +1,708 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"github.com/nmohnblatt/contact_discovery2/identity"
+	"github.com/nmohnblatt/contact_discovery2/keystore"
+	"github.com/nmohnblatt/contact_discovery2/meetingstore"
+	"github.com/nmohnblatt/contact_discovery2/normalise"
+	"github.com/nmohnblatt/contact_discovery2/profile"
+	"github.com/nmohnblatt/contact_discovery2/quota"
+	"go.dedis.ch/kyber/v3/share"
+)
+
+// Names of the files written by setup in its output directory
+const (
+	parametersFile      = "parameters.json"
+	issuerFile          = "issuer.key"
+	issuerPublicKeyFile = "issuer.pub"
+)
+
+// defaultIssuerURL is where the identity provider started by the issuer command listens by default
+const defaultIssuerURL = "http://127.0.0.1:8200"
+
+// runSetup runs the DKG among in-process servers and writes everything needed to run them separately.
+// The process holds every share while it runs, so setup is a trusted dealer ceremony: it must run on a
+// machine trusted by every operator, and each share file must be handed to its server and deleted
+// everywhere else
+func runSetup(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("setup")
+	servers := fs.Int("servers", 9, "number of servers `n`")
+	threshold := fs.Int("threshold", 3, "number of servers `t` needed to issue keys")
+	out := fs.String("out", "deployment", "output `directory`")
+	addresses := fs.String("addresses", "", "comma separated `host:port` of each server (default 127.0.0.1:8000 onwards)")
+	suiteFlag := fs.String("suite", "bn256", "pairing `suite`: bn256 or bls12381")
+	epochLength := fs.Duration("epoch-length", 0, "period after which keys and meeting points change, in whole seconds (default: a single epoch)")
+	stubIssuer := fs.Bool("stub-issuer", true, "generate the key of a stub identity provider and its public key, for tests only")
+	passphraseFile := fs.String("passphrase-file", "", "file holding the passphrase of the share files (default $"+passphraseVariable+")")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+
+	if *threshold < 1 || *threshold > *servers {
+		return fmt.Errorf("setup: invalid threshold %d of %d", *threshold, *servers)
+	}
+	if *epochLength < 0 || *epochLength%time.Second != 0 {
+		return fmt.Errorf("setup: invalid epoch length %s", *epochLength)
+	}
+	hosts := splitList(*addresses)
+	if len(hosts) == 0 {
+		for i := 0; i < *servers; i++ {
+			hosts = append(hosts, fmt.Sprintf("127.0.0.1:%d", 8000+i))
+		}
+	}
+	if len(hosts) != *servers {
+		return fmt.Errorf("setup: %d addresses given for %d servers", len(hosts), *servers)
+	}
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	suite, err := newSuite(*suiteFlag)
+	if err != nil {
+		return err
+	}
+	parameters := publicParameters{Threshold: *threshold, TotalServers: *servers, Suite: suite, EpochLength: *epochLength}
+	serverList, pub1, pub2, err := setupThresholdServers(parameters)
+	if err != nil {
+		return err
+	}
+	parameters.PublicPolynomials[0], parameters.PublicPolynomials[1] = pub1, pub2
+
+	if err := saveServerKeys(parameters, serverList, *out, passphrase); err != nil {
+		return err
+	}
+	endpoints := make([]*serverEndpoint, len(hosts))
+	for i, host := range hosts {
+		endpoints[i] = newServerEndpoint(i, host)
+	}
+	encoded, err := marshalParametersJSON(parameters, endpoints)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(*out, parametersFile), encoded, 0644); err != nil {
+		return err
+	}
+	if *stubIssuer {
+		issuer, err := identity.NewStubIssuer(suite, stubIssuerTTL)
+		if err != nil {
+			return err
+		}
+		if err := saveStubIssuer(filepath.Join(*out, issuerFile), issuer); err != nil {
+			return err
+		}
+		if err := saveIssuerPublicKey(filepath.Join(*out, issuerPublicKeyFile), issuer.Verifier()); err != nil {
+			return err
+		}
+	}
+
+	fingerprint, err := parametersFingerprint(parameters, endpoints)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Wrote the parameters and %d share files to %s\n", *servers, *out)
+	fmt.Fprintf(stdout, "Parameters fingerprint: %s\n", fingerprint)
+
+	return nil
+}
+
+// serverOptions configure a signing server run from its share file
+type serverOptions struct {
+	parameters, fingerprint, keystore string
+	id                                int
+	// issuerPublicKey is the file holding the public key of the identity provider whose attestations are trusted
+	issuerPublicKey string
+	limits          quota.Config
+	passphrase      []byte
+	// join starts the server without a share file, for it to join the committee in a reshare
+	join bool
+	// reshareToken authorises the coordinator of reshares, the server takes part in none when nil
+	reshareToken []byte
+}
+
+// loadServer restores a server from its share file and checks its share against the public parameters
+func loadServer(options serverOptions) (*server, publicParameters, []*serverEndpoint, error) {
+	parameters, endpoints, err := loadParametersFile(options.parameters, options.fingerprint)
+	if err != nil {
+		return nil, publicParameters{}, nil, err
+	}
+
+	var s *server
+	keyFile := keystorePath(options.keystore, options.id)
+	if options.join {
+		if options.reshareToken == nil {
+			return nil, publicParameters{}, nil, errors.New("a server joining the committee needs a reshare token")
+		}
+		s, keyFile = newServer(options.id, nil, nil), ""
+	} else {
+		id, keys, err := keystore.Load(keyFile, options.passphrase, parameters.Suite)
+		if err != nil {
+			return nil, publicParameters{}, nil, err
+		}
+		if id != options.id {
+			return nil, publicParameters{}, nil, fmt.Errorf("share file of server %d holds the keys of server %d", options.id, id)
+		}
+		if !parameters.PublicPolynomials[0].Eval(keys[0].I).V.Equal(parameters.Suite.G2().Point().Mul(keys[0].V, nil)) {
+			return nil, publicParameters{}, nil, errors.New("share does not match the public parameters")
+		}
+		s = newServer(id, keys[0], keys[1])
+	}
+
+	// Shares installed by a reshare replace the share file, which is named after the server's new ID
+	if options.reshareToken != nil {
+		suite := parameters.Suite
+		s.resharing = newReshareState(options.reshareToken)
+		s.resharing.save = func(id int, keys crypto.MasterSecretShares, old *share.PriShare) error {
+			path := keystorePath(options.keystore, id)
+			if err := keystore.Save(path, options.passphrase, suite, id, keys); err != nil {
+				return err
+			}
+			previous := keyFile
+			keyFile = path
+			if previous == "" || previous == path || old == nil {
+				return nil
+			}
+			return removeOwnKeystore(previous, options.passphrase, suite, old)
+		}
+		s.resharing.forget = func(old *share.PriShare) error {
+			if keyFile == "" {
+				return nil
+			}
+			return removeOwnKeystore(keyFile, options.passphrase, suite, old)
+		}
+	}
+
+	// Servers only sign attested requests, so a server that cannot check attestations does not start
+	if options.issuerPublicKey == "" {
+		return nil, publicParameters{}, nil, errors.New("no identity provider key to check attestations with")
+	}
+	if s.verifier, err = loadIssuerVerifier(options.issuerPublicKey); err != nil {
+		return nil, publicParameters{}, nil, err
+	}
+	if options.limits != (quota.Config{}) {
+		s.limiter = quota.New(options.limits)
+	}
+
+	return s, parameters, endpoints, nil
+}
+
+// runServer runs one signing server until the process is stopped
+func runServer(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("server")
+	var options serverOptions
+	fs.StringVar(&options.parameters, "parameters", filepath.Join("deployment", parametersFile), "public parameters `file`")
+	fs.StringVar(&options.fingerprint, "fingerprint", "", "expected fingerprint of the public parameters")
+	fs.StringVar(&options.keystore, "keystore", "deployment", "`directory` of the share files")
+	fs.IntVar(&options.id, "id", 0, "ID of the server to run")
+	fs.StringVar(&options.issuerPublicKey, "issuer-public-key", filepath.Join("deployment", issuerPublicKeyFile), "identity provider public key `file`, only requests it attests are signed")
+	fs.Float64Var(&options.limits.Rate, "rate", 1, "requests per second allowed to each account, 0 for no limit")
+	fs.IntVar(&options.limits.Burst, "burst", 5, "requests each account may send at once")
+	fs.Float64Var(&options.limits.GlobalRate, "global-rate", 0, "requests per second allowed overall, 0 for no limit")
+	fs.IntVar(&options.limits.GlobalBurst, "global-burst", 0, "requests that may be served at once overall")
+	fs.IntVar(&options.limits.MaxIdentifiers, "max-identifiers", 5, "distinct identifiers each account may obtain keys for, 0 for no limit")
+	fs.BoolVar(&options.join, "join", false, "start without a share file, to join the committee in a reshare (requires -listen and -reshare-token-file)")
+	listen := fs.String("listen", "", "`address` to listen on (default: the server's address in the parameters)")
+	passphraseFile := fs.String("passphrase-file", "", "file holding the passphrase of the share files (default $"+passphraseVariable+")")
+	tokenFile := fs.String("reshare-token-file", "", "`file` holding the token that authorises reshares (default: the server takes part in no reshare)")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+
+	var err error
+	if options.passphrase, err = readPassphrase(*passphraseFile); err != nil {
+		return err
+	}
+	if *tokenFile != "" {
+		if options.reshareToken, err = readSecret(*tokenFile); err != nil {
+			return err
+		}
+	}
+	if options.join && *listen == "" {
+		return errors.New("server: a server joining the committee has no address in the parameters, give -listen")
+	}
+	s, parameters, endpoints, err := loadServer(options)
+	if err != nil {
+		return err
+	}
+
+	address := *listen
+	for _, e := range endpoints {
+		if address == "" && e.ID == s.ID {
+			u, err := url.Parse(e.Address)
+			if err != nil {
+				return err
+			}
+			address = u.Host
+		}
+	}
+	if address == "" {
+		return fmt.Errorf("server: no address for server %d", s.ID)
+	}
+
+	fmt.Fprintf(stdout, "Server %d listening on %s\n", s.ID, address)
+	return s.listenAndServe(parameters, address)
+}
+
+// runReshare moves the shares of the servers listed in the public parameters to a new committee, or
+// refreshes them, through the servers' reshare endpoints. The public keys do not change, so users' keys
+// and profiles remain valid, but the parameters do: they are written for the new committee
+func runReshare(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("reshare")
+	parametersPath := fs.String("parameters", filepath.Join("deployment", parametersFile), "public parameters `file` of the current committee")
+	fingerprint := fs.String("fingerprint", "", "expected fingerprint of the public parameters")
+	addresses := fs.String("addresses", "", "comma separated `host:port` of the servers of the new committee, in the order of their new IDs (default: the current committee, which refreshes the shares)")
+	threshold := fs.Int("threshold", 0, "number of servers `t` of the new committee needed to issue keys (default: the current threshold)")
+	out := fs.String("out", "", "`file` to write the parameters of the new committee to (default: the parameters file)")
+	tokenFile := fs.String("token-file", "", "`file` holding the servers' reshare token")
+	timeout := fs.Duration("timeout", time.Minute, "time allowed for the reshare")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+
+	parameters, endpoints, err := loadParametersFile(*parametersPath, *fingerprint)
+	if err != nil {
+		return err
+	}
+	if *tokenFile == "" {
+		return errors.New("reshare: no token file given")
+	}
+	token, err := readSecret(*tokenFile)
+	if err != nil {
+		return err
+	}
+	if *threshold == 0 {
+		*threshold = parameters.Threshold
+	}
+	if *out == "" {
+		*out = *parametersPath
+	}
+
+	// The old committee is listed in the order of the servers' IDs, which are the indices of their shares
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].ID < endpoints[j].ID })
+	newCommittee := endpoints
+	if hosts := splitList(*addresses); len(hosts) > 0 {
+		newCommittee = make([]*serverEndpoint, len(hosts))
+		for i, host := range hosts {
+			newCommittee[i] = newServerEndpoint(i, host)
+		}
+	}
+	for _, e := range append(append([]*serverEndpoint{}, endpoints...), newCommittee...) {
+		e.token = string(token)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	reshared, newEndpoints, err := reshare(ctx, parameters, endpoints, newCommittee, *threshold)
+	if err != nil {
+		return err
+	}
+	encoded, err := marshalParametersJSON(reshared, newEndpoints)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*out, encoded, 0644); err != nil {
+		return err
+	}
+	actual, err := parametersFingerprint(reshared, newEndpoints)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Reshared to %d servers with a threshold of %d, parameters written to %s\n", reshared.TotalServers, reshared.Threshold, *out)
+	fmt.Fprintf(stdout, "Parameters fingerprint: %s\n", actual)
+
+	return nil
+}
+
+// runEnroll obtains the constraining keys for an identifier from the servers and saves them in a new profile
+func runEnroll(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("enroll")
+	parametersPath := fs.String("parameters", filepath.Join("deployment", parametersFile), "public parameters `file`")
+	fingerprint := fs.String("fingerprint", "", "expected fingerprint of the public parameters")
+	identifier := fs.String("id", "", "comma separated discovery identifiers to enroll, the primary one first")
+	account := fs.String("account", "", "account the identifiers belong to (default: the primary identifier)")
+	region := fs.String("region", "", "default `region` of phone numbers written without a country code, e.g. GB (default: the profile's region)")
+	issuerURL := fs.String("issuer", defaultIssuerURL, "`URL` of the identity provider attesting the identifiers")
+	profilePath := fs.String("profile", "profile.json", "`file` to write the encrypted profile to")
+	passphraseFile := fs.String("passphrase-file", "", "file holding the passphrase of the profile (default $"+passphraseVariable+")")
+	timeout := fs.Duration("timeout", shareCollectionTimeout, "time allowed to collect the signature shares")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+	parameters, endpoints, err := loadParametersFile(*parametersPath, *fingerprint)
+	if err != nil {
+		return err
+	}
+	keys, err := publicKeyFingerprint(parameters)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	// Enrolling again, e.g. once the epoch of the keys has ended, keeps the identifiers and the contacts of an
+	// existing profile. Identifiers given besides those of the profile are added to it
+	var u *user
+	p, err := profile.Load(*profilePath, passphrase)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if p != nil && *region == "" {
+		*region = p.Region
+	}
+	// Identifiers are normalised before they are attested and hashed, so that contacts writing them
+	// differently still derive the same keys
+	identifiers := splitList(*identifier)
+	for i, id := range identifiers {
+		if identifiers[i], err = normalise.Identifier(id, *region); err != nil {
+			return fmt.Errorf("enroll: %s: %v", id, err)
+		}
+	}
+	if p != nil {
+		if u, err = userFromProfile(parameters, keys, p); err != nil {
+			return err
+		}
+		if len(identifiers) > 0 && identifiers[0] != u.DiscoveryIdentifier {
+			return fmt.Errorf("enroll: %s holds the profile of %s", *profilePath, u.DiscoveryIdentifier)
+		}
+		u.startEpoch(parameters, parameters.currentEpoch())
+	} else if len(identifiers) == 0 {
+		return errors.New("enroll: no identifier given")
+	} else {
+		u = newUser(parameters, identifiers[0], nil)
+	}
+	u.region = *region
+	for _, id := range identifiers {
+		if u.identifier(id) == nil {
+			if err := u.addIdentifier(parameters, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	issuer := identity.NewHTTPIssuer(parameters.Suite, *issuerURL)
+	if *account == "" {
+		*account = u.DiscoveryIdentifier
+	}
+	for _, id := range u.identifiers {
+		if id.attestation, err = issuer.IssueForAccount(ctx, *account, u.epoch, id.identifier); err != nil {
+			return err
+		}
+	}
+	if err := u.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+		return err
+	}
+	for id, err := range u.faultyServers {
+		fmt.Fprintf(stdout, "Server %d was skipped: %s\n", id, err)
+	}
+
+	if p, err = u.toProfile(keys); err != nil {
+		return err
+	}
+	if err := profile.Save(*profilePath, passphrase, p); err != nil {
+		return err
+	}
+
+	names := make([]string, len(u.identifiers))
+	for i, id := range u.identifiers {
+		names[i] = id.identifier
+	}
+	fmt.Fprintf(stdout, "Constraining keys for %s in epoch %d saved to %s\n", strings.Join(names, ", "), u.epoch, *profilePath)
+	return nil
+}
+
+// openMeetingStore opens the meeting store at a URL (HTTP store) or a path (file store)
+func openMeetingStore(location string) (meetingstore.MeetingStore, func() error, error) {
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		return meetingstore.NewHTTPStore(location, nil), func() error { return nil }, nil
+	}
+	store, err := meetingstore.OpenFileStore(location)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return store, store.Close, nil
+}
+
+// runDiscover checks the contacts of a profile that were not found yet, adding and removing contacts first.
+// Shared keys computed and contacts found are saved back to the profile
+func runDiscover(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("discover")
+	parametersPath := fs.String("parameters", filepath.Join("deployment", parametersFile), "public parameters `file`")
+	fingerprint := fs.String("fingerprint", "", "expected fingerprint of the public parameters")
+	profilePath := fs.String("profile", "profile.json", "encrypted profile `file` written by enroll")
+	passphraseFile := fs.String("passphrase-file", "", "file holding the passphrase of the profile (default $"+passphraseVariable+")")
+	contacts := fs.String("contacts", "", "comma separated discovery identifiers of contacts to add")
+	location := fs.String("store", "meetings.log", "meeting store: a file `path` or the URL of a meeting store server")
+	remove := fs.String("remove", "", "comma separated discovery identifiers of contacts to remove, they can no longer find the user")
+	sync := fs.Bool("sync", false, "treat -contacts as the whole address book and remove the contacts missing from it")
+	card := fs.String("card", "", "contact card left for the contacts (default: the identifier)")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase(*passphraseFile)
+	if err != nil {
+		return err
+	}
+	parameters, _, err := loadParametersFile(*parametersPath, *fingerprint)
+	if err != nil {
+		return err
+	}
+	keys, err := publicKeyFingerprint(parameters)
+	if err != nil {
+		return err
+	}
+	p, err := profile.Load(*profilePath, passphrase)
+	if err != nil {
+		return err
+	}
+	u, err := userFromProfile(parameters, keys, p)
+	if err != nil {
+		return err
+	}
+	if current := parameters.currentEpoch(); u.epoch != current {
+		return fmt.Errorf("discover: the keys in %s are for epoch %d, the current epoch is %d: run enroll again", *profilePath, u.epoch, current)
+	}
+	if *card != "" {
+		u.card = []byte(*card)
+	}
+
+	store, closeStore, err := openMeetingStore(*location)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	ctx := context.Background()
+	var added, removed []string
+	var checkErr error
+	if *sync {
+		added, removed, checkErr = u.syncContacts(ctx, parameters, store, splitList(*contacts))
+	} else {
+		if added, checkErr = u.addContacts(parameters, splitList(*contacts)); checkErr == nil {
+			removed, checkErr = u.removeContacts(ctx, store, splitList(*remove))
+		}
+	}
+	if checkErr == nil {
+		_, checkErr = u.checkContacts(ctx, store)
+	}
+
+	// Save what was done even if a meeting point could not be checked
+	if p, err = u.toProfile(keys); err != nil {
+		return err
+	}
+	if err := profile.Save(*profilePath, passphrase, p); err != nil {
+		return err
+	}
+	if checkErr != nil {
+		return checkErr
+	}
+
+	if len(added) > 0 {
+		fmt.Fprintf(stdout, "Added %s\n", strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		fmt.Fprintf(stdout, "Removed %s\n", strings.Join(removed, ", "))
+	}
+	var present []string
+	for _, contact := range u.contacts {
+		if u.contactPresence[contact] {
+			present = append(present, contact)
+		}
+	}
+	for _, person := range u.matches(present) {
+		fmt.Fprintf(stdout, "%s is on the service since %s (card: %q)", strings.Join(person.contacts, " and "), u.discoveredAt[person.contacts[0]].Format(time.RFC3339), person.card)
+		if len(u.identifiers) > 1 {
+			fmt.Fprintf(stdout, ", found with your identifier %s", strings.Join(person.own, " and "))
+		}
+		fmt.Fprintln(stdout)
+	}
+
+	fmt.Fprintf(stdout, "Found %d of %d contacts\n", len(present), len(u.contacts))
+	return nil
+}
+
+// runInspect dumps public parameters in a readable form
+func runInspect(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("inspect")
+	parametersPath := fs.String("parameters", filepath.Join("deployment", parametersFile), "public parameters `file`")
+	fingerprint := fs.String("fingerprint", "", "expected fingerprint of the public parameters")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+
+	parameters, endpoints, err := loadParametersFile(*parametersPath, *fingerprint)
+	if err != nil {
+		return err
+	}
+	actual, err := parametersFingerprint(parameters, endpoints)
+	if err != nil {
+		return err
+	}
+	name, err := suiteName(parameters.Suite)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Fingerprint: %s\n", actual)
+	fmt.Fprintf(stdout, "Suite:       %s\n", name)
+	fmt.Fprintf(stdout, "Threshold:   %d of %d servers\n", parameters.Threshold, parameters.TotalServers)
+	for i, group := range []string{"G2", "G1"} {
+		public, err := parameters.PublicPolynomials[i].Commit().MarshalBinary()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Public key in %s: %s\n", group, hex.EncodeToString(public))
+	}
+	fmt.Fprintln(stdout, "Servers:")
+	for _, e := range endpoints {
+		fmt.Fprintf(stdout, "  %d  %s\n", e.ID, e.Address)
+	}
+
+	return nil
+}
+
+// runExportCommitments dumps the public commitments held in the share files as JSON
+func runExportCommitments(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("export-commitments")
+	parametersPath := fs.String("parameters", filepath.Join("deployment", parametersFile), "public parameters `file`")
+	dir := fs.String("keystore", "deployment", "`directory` of the share files")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+
+	parameters, _, err := loadParametersFile(*parametersPath, "")
+	if err != nil {
+		return err
+	}
+	commitments, err := exportCommitments(parameters, *dir)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(commitments)
+}
+
+// collectMeetingPoints deletes the meeting points of past epochs from the store every interval, then
+// compacts its log, until ctx is done
+func collectMeetingPoints(ctx context.Context, parameters publicParameters, store *meetingstore.FileStore, interval time.Duration, stdout io.Writer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		epoch := parameters.currentEpoch()
+		deleted, err := meetingstore.CollectGarbage(ctx, store, epoch)
+		if err == nil && deleted > 0 {
+			err = store.Compact()
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "Garbage collection failed: %s\n", err)
+		} else if deleted > 0 {
+			fmt.Fprintf(stdout, "Deleted %d meeting points from before epoch %d\n", deleted, epoch)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runStore serves a file-backed meeting store over HTTP
+func runStore(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("store")
+	path := fs.String("file", "meetings.log", "`file` backing the meeting store")
+	listen := fs.String("listen", "127.0.0.1:8100", "`address` to listen on")
+	parametersPath := fs.String("parameters", "", "public parameters `file`, the meeting points of past epochs are deleted when given")
+	fingerprint := fs.String("fingerprint", "", "expected fingerprint of the public parameters")
+	gcInterval := fs.Duration("gc-interval", time.Minute, "time between two deletions of the meeting points of past epochs")
+	tokenPath := fs.String("token-file", "", "`file` holding the operator's bearer token, needed to list the meeting points and delete any of them")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+
+	var token []byte
+	var err error
+	if *tokenPath != "" {
+		if token, err = readSecret(*tokenPath); err != nil {
+			return err
+		}
+	}
+
+	var parameters publicParameters
+	if *parametersPath != "" {
+		if parameters, _, err = loadParametersFile(*parametersPath, *fingerprint); err != nil {
+			return err
+		}
+	}
+	store, err := meetingstore.OpenFileStore(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Meeting store listening on %s\n", l.Addr())
+	if *parametersPath != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go collectMeetingPoints(ctx, parameters, store, *gcInterval, stdout)
+	}
+
+	return (&http.Server{Handler: meetingstore.NewHandler(store, token), ReadTimeout: 10 * time.Second}).Serve(l)
+}
+
+// runIssuer serves the stub identity provider written by setup over HTTP. It attests any identifier to anyone
+// who asks and is only meant for testing: a real identity provider checks ownership of the identifiers
+func runIssuer(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("issuer")
+	keyPath := fs.String("key", filepath.Join("deployment", issuerFile), "stub identity provider key `file`")
+	parametersPath := fs.String("parameters", filepath.Join("deployment", parametersFile), "public parameters `file`")
+	fingerprint := fs.String("fingerprint", "", "expected fingerprint of the public parameters")
+	listen := fs.String("listen", strings.TrimPrefix(defaultIssuerURL, "http://"), "`address` to listen on")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+
+	parameters, _, err := loadParametersFile(*parametersPath, *fingerprint)
+	if err != nil {
+		return err
+	}
+	issuer, err := loadStubIssuer(*keyPath, parameters.Suite)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Stub identity provider listening on %s\n", l.Addr())
+	return (&http.Server{Handler: identity.NewHandler(issuer), ReadTimeout: 10 * time.Second}).Serve(l)
+}
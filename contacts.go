@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"github.com/nmohnblatt/contact_discovery2/meetingstore"
+)
+
+// diffContacts compares an address book with the user's contacts. It returns the identifiers missing from the
+// contacts and the contacts missing from the address book, in the order they appear
+func (u *user) diffContacts(addressBook []string) (added, removed []string) {
+	listed := make(map[string]bool)
+	for _, contact := range addressBook {
+		if _, known := u.contactPresence[contact]; !known && !listed[contact] {
+			added = append(added, contact)
+		}
+		listed[contact] = true
+	}
+	for _, contact := range u.contacts {
+		if !listed[contact] {
+			removed = append(removed, contact)
+		}
+	}
+
+	return added, removed
+}
+
+// addContacts adds the contacts the user does not know yet and derives the shared keys for them, leaving the
+// keys of known contacts untouched. It returns the contacts that were added. A contact that cannot be
+// normalised is refused and nothing is added
+func (u *user) addContacts(parameters publicParameters, contacts []string) ([]string, error) {
+	for _, contact := range contacts {
+		if _, err := u.normalisedContact(contact); err != nil {
+			return nil, fmt.Errorf("%s: %v", contact, err)
+		}
+	}
+
+	var added []string
+	for _, contact := range contacts {
+		if _, known := u.contactPresence[contact]; known {
+			continue
+		}
+		u.contacts = append(u.contacts, contact)
+		u.contactPresence[contact] = false
+		added = append(added, contact)
+	}
+	if err := u.computeSharedKeys(parameters); err != nil {
+		return nil, err
+	}
+
+	return added, nil
+}
+
+// removeContacts withdraws the user's payload from the meeting points shared with the given contacts, so that
+// they can no longer discover the user, then forgets everything about them. It returns the contacts that were
+// removed. A contact is only forgotten once its meeting point was withdrawn
+func (u *user) removeContacts(ctx context.Context, onlineCache meetingstore.MeetingStore, contacts []string) ([]string, error) {
+	var removed []string
+	for _, contact := range contacts {
+		if _, known := u.contactPresence[contact]; !known {
+			continue
+		}
+		if err := u.withdraw(ctx, contact, onlineCache); err != nil {
+			return removed, fmt.Errorf("%s: %v", contact, err)
+		}
+
+		for i, c := range u.contacts {
+			if c == contact {
+				u.contacts = append(u.contacts[:i], u.contacts[i+1:]...)
+				break
+			}
+		}
+		delete(u.contactPresence, contact)
+		for _, id := range u.identifiers {
+			delete(u.sharedKeys, meeting{id.identifier, contact})
+		}
+		delete(u.matchedBy, contact)
+		delete(u.canonical, contact)
+		delete(u.contactCards, contact)
+		delete(u.lastChecked, contact)
+		delete(u.discoveredAt, contact)
+		removed = append(removed, contact)
+	}
+
+	return removed, nil
+}
+
+// syncContacts makes the user's contacts match an address book: new identifiers are added and contacts
+// missing from the address book are removed
+func (u *user) syncContacts(ctx context.Context, parameters publicParameters, onlineCache meetingstore.MeetingStore, addressBook []string) (added, removed []string, err error) {
+	toAdd, toRemove := u.diffContacts(addressBook)
+	if removed, err = u.removeContacts(ctx, onlineCache, toRemove); err != nil {
+		return nil, removed, err
+	}
+
+	added, err = u.addContacts(parameters, toAdd)
+	return added, removed, err
+}
+
+// withdraw deletes the payloads the user left at the meeting points shared between their identifiers and
+// contact. A payload left by the contact is not ours to remove and is left in place
+func (u *user) withdraw(ctx context.Context, contact string, onlineCache meetingstore.MeetingStore) error {
+	for _, id := range u.identifiers {
+		if _, found := u.sharedKeys[meeting{id.identifier, contact}]; !found {
+			// no keys, no meeting point was ever visited
+			continue
+		}
+		derived, meetingPoint, peer, err := u.meetingPoint(id.identifier, contact)
+		if err != nil {
+			return err
+		}
+
+		sealed, err := onlineCache.Get(ctx, meetingPoint)
+		if err == meetingstore.ErrNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if _, err := crypto.OpenMeetingPayload(derived, id.identifier, peer, sealed); err != nil {
+			continue
+		}
+		if err := removePayload(ctx, onlineCache, meetingPoint, meetingPointOwner(derived, id.identifier)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package crypto
+
+import (
+	"runtime"
+	"sync"
+
+	"go.dedis.ch/kyber/v3/pairing"
+)
+
+// PublicKeyCache memoises DerivePublicKeys, which hashes the identifier to both groups. It is safe for
+// concurrent use. The cached points are shared between callers and must not be modified
+type PublicKeyCache struct {
+	suite pairing.Suite
+	epoch uint64
+	mu    sync.Mutex
+	keys  map[string]PublicKeys
+}
+
+// NewPublicKeyCache returns an empty cache of the public keys derived under suite during epoch
+func NewPublicKeyCache(suite pairing.Suite, epoch uint64) *PublicKeyCache {
+	return &PublicKeyCache{suite: suite, epoch: epoch, keys: make(map[string]PublicKeys)}
+}
+
+// Epoch returns the epoch the cached keys belong to
+func (c *PublicKeyCache) Epoch() uint64 {
+	return c.epoch
+}
+
+// Get returns the public keys of identifier, deriving them on the first call
+func (c *PublicKeyCache) Get(identifier string) PublicKeys {
+	c.mu.Lock()
+	keys, found := c.keys[identifier]
+	c.mu.Unlock()
+	if found {
+		return keys
+	}
+
+	// hash outside the lock, two callers racing on the same identifier derive the same keys
+	keys = DerivePublicKeys(c.suite, c.epoch, identifier)
+	c.mu.Lock()
+	c.keys[identifier] = keys
+	c.mu.Unlock()
+
+	return keys
+}
+
+// Len returns the number of identifiers in the cache
+func (c *PublicKeyCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.keys)
+}
+
+// DeriveSharedKeysBatch computes DeriveSharedKeys for every contact using a pool of workers; the result at
+// index i belongs to contacts[i]. workers <= 0 uses one worker per CPU. The contacts' public keys are taken
+// from cache when it is not nil; a cache filled during another epoch is ignored.
+//
+// kyber's bn256 does not expose the Miller loop, so the line functions of the user's fixed constraining keys
+// cannot be precomputed and each pairing runs in full. The speedup comes from the workers and the cache
+func DeriveSharedKeysBatch(suite pairing.Suite, epoch uint64, aliceKeys ConstrainingKeys, contacts []string, workers int, cache *PublicKeyCache) []SharedKeys {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if cache != nil && cache.Epoch() != epoch {
+		cache = nil
+	}
+	if workers > len(contacts) {
+		workers = len(contacts)
+	}
+
+	results := make([]SharedKeys, len(contacts))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var bobPk PublicKeys
+				if cache != nil {
+					bobPk = cache.Get(contacts[i])
+				} else {
+					bobPk = DerivePublicKeys(suite, epoch, contacts[i])
+				}
+				results[i] = SharedKeys{
+					Outgoing: suite.Pair(aliceKeys.Left, bobPk.Right),
+					Incoming: suite.Pair(bobPk.Left, aliceKeys.Right),
+				}
+			}
+		}()
+	}
+	for i := range contacts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
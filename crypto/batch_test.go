@@ -0,0 +1,91 @@
+package crypto
+
+import (
+	"fmt"
+	"testing"
+
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+// randomConstrainingKeys returns the constraining keys of "alice" under a random master secret
+func randomConstrainingKeys(suite pairing.Suite) ConstrainingKeys {
+	s := suite.G1().Scalar().Pick(random.New())
+	pk := DerivePublicKeys(suite, 0, "alice")
+	return ConstrainingKeys{Left: pk.Left.Mul(s, pk.Left), Right: pk.Right.Mul(s, pk.Right)}
+}
+
+func addressBook(n int) []string {
+	contacts := make([]string, n)
+	for i := range contacts {
+		contacts[i] = fmt.Sprintf("contact-%d", i)
+	}
+	return contacts
+}
+
+func TestDeriveSharedKeysBatch(t *testing.T) { forEachSuite(t, testDeriveSharedKeysBatch) }
+
+func testDeriveSharedKeysBatch(t *testing.T, suite pairing.Suite) {
+	keys := randomConstrainingKeys(suite)
+	contacts := addressBook(10)
+	cache := NewPublicKeyCache(suite, 0)
+
+	for _, workers := range []int{1, 4, 0} {
+		batch := DeriveSharedKeysBatch(suite, 0, keys, contacts, workers, cache)
+		for i, contact := range contacts {
+			outgoing, incoming := DeriveSharedKeys(suite, 0, keys, contact)
+			if !batch[i].Outgoing.Equal(outgoing) || !batch[i].Incoming.Equal(incoming) {
+				t.Errorf("%d workers: wrong keys for %s", workers, contact)
+			}
+		}
+	}
+	if cache.Len() != len(contacts) {
+		t.Errorf("Expected %d cached identifiers, got %d", len(contacts), cache.Len())
+	}
+	// A cache from another epoch is not used
+	other := DeriveSharedKeysBatch(suite, 1, keys, contacts[:1], 1, cache)
+	if outgoing, _ := DeriveSharedKeys(suite, 1, keys, contacts[0]); !other[0].Outgoing.Equal(outgoing) {
+		t.Errorf("Keys derived from a cache of another epoch")
+	}
+	if len(DeriveSharedKeysBatch(suite, 0, keys, nil, 0, nil)) != 0 {
+		t.Errorf("Empty batch returned keys")
+	}
+}
+
+// BenchmarkSharedKeysSerial is the loop computeSharedKeys used before batching
+func BenchmarkSharedKeysSerial(b *testing.B) {
+	suite := bn256.NewSuite()
+	keys := randomConstrainingKeys(suite)
+	contacts := addressBook(64)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, contact := range contacts {
+			DeriveSharedKeys(suite, 0, keys, contact)
+		}
+	}
+}
+
+func BenchmarkSharedKeysBatch(b *testing.B) {
+	suite := bn256.NewSuite()
+	keys := randomConstrainingKeys(suite)
+	contacts := addressBook(64)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		DeriveSharedKeysBatch(suite, 0, keys, contacts, 0, nil)
+	}
+}
+
+// BenchmarkSharedKeysBatchCached recomputes an address book whose public keys are already cached, as when
+// the constraining keys change but the contacts do not
+func BenchmarkSharedKeysBatchCached(b *testing.B) {
+	suite := bn256.NewSuite()
+	keys := randomConstrainingKeys(suite)
+	contacts := addressBook(64)
+	cache := NewPublicKeyCache(suite, 0)
+	DeriveSharedKeysBatch(suite, 0, keys, contacts, 0, cache)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		DeriveSharedKeysBatch(suite, 0, keys, contacts, 0, cache)
+	}
+}
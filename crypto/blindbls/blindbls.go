@@ -3,23 +3,31 @@ package blindbls
 
 import (
 	"errors"
+	"reflect"
 
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
 )
 
-// CheckGroup checks whether point P is from the group G
+// CheckGroup checks whether point P is an element of the prime order group G other than the identity.
+// P must have the concrete type of G's points, and multiplying it by the order r of G must give the
+// identity: this rejects points of the curve that lie outside the subgroup used by the pairing, which
+// decoding alone does not rule out for every curve (e.g. bn256's G2)
 func CheckGroup(P kyber.Point, G kyber.Group) bool {
-	isInGroup := false
-
-	if G.String() == P.String()[:8] {
-		isInGroup = true
+	if P == nil || reflect.TypeOf(P) != reflect.TypeOf(G.Point()) {
+		return false
+	}
+	identity := G.Point().Null()
+	if P.Equal(identity) {
+		return false
 	}
 
-	return isInGroup
+	// -1 is the scalar r-1, so (r-1)P + P = rP
+	rP := G.Point().Mul(G.Scalar().SetInt64(-1), P)
+	return rP.Add(rP, P).Equal(identity)
 }
 
-// Blind returns a blinded byte representation of an input point
+// Blind returns a blinded byte representation of an input point. HM must pass CheckGroup
 func Blind(group kyber.Group, blindingFactor kyber.Scalar, HM kyber.Point) ([]byte, error) {
 	if check := CheckGroup(HM, group); !check {
 		err := errors.New("blind: HM and group do not match")
@@ -37,13 +45,17 @@ func Blind(group kyber.Group, blindingFactor kyber.Scalar, HM kyber.Point) ([]by
 
 // Sign creates a BLS signature S = x * H(m) on a blinded message (byte representation) using the private
 // key x. The signature S is a point on the curve defined by the argument group.
-// Warning: "group" must match the original group of "blindedHash"
+// Warning: "group" must match the original group of "blindedHash". A blinded point that does not pass
+// CheckGroup is rejected, so a malicious input cannot make the signer multiply a low order point
 func Sign(group kyber.Group, x kyber.Scalar, blindedHash []byte) ([]byte, error) {
 	aHM := group.Point()
 	err := aHM.UnmarshalBinary(blindedHash)
 	if err != nil {
 		return nil, err
 	}
+	if check := CheckGroup(aHM, group); !check {
+		return nil, errors.New("sign: blinded point is not in the group")
+	}
 	xaHM := aHM.Mul(x, aHM)
 
 	s, err := xaHM.MarshalBinary()
@@ -53,13 +65,16 @@ func Sign(group kyber.Group, x kyber.Scalar, blindedHash []byte) ([]byte, error)
 	return s, nil
 }
 
-// Unblind outputs the unblinded point underlying the blinded signature s
+// Unblind outputs the unblinded point underlying the blinded signature s, which must pass CheckGroup
 func Unblind(group kyber.Group, blindingFactor kyber.Scalar, s []byte) (kyber.Point, error) {
 	axHM := group.Point()
 	err := axHM.UnmarshalBinary(s)
 	if err != nil {
 		return nil, err
 	}
+	if check := CheckGroup(axHM, group); !check {
+		return nil, errors.New("unblind: signature is not in the group")
+	}
 
 	inv := group.Scalar().Inv(blindingFactor)
 	xHM := axHM.Mul(inv, axHM)
@@ -75,14 +90,14 @@ func Unblind(group kyber.Group, blindingFactor kyber.Scalar, s []byte) (kyber.Po
 // the base point from curve G1.
 func Verify(suite pairing.Suite, group kyber.Group, X kyber.Point, HM, xHM kyber.Point) error {
 
-	if group.String() == "bn256.G1" {
+	if group.String() == suite.G1().String() {
 		left := suite.Pair(HM, X)
 
 		right := suite.Pair(xHM, suite.G2().Point().Base())
 		if !left.Equal(right) {
 			return errors.New("bls: invalid signature")
 		}
-	} else if group.String() == "bn256.G2" {
+	} else if group.String() == suite.G2().String() {
 		left := suite.Pair(X, HM)
 
 		right := suite.Pair(suite.G1().Point().Base(), xHM)
@@ -1,19 +1,42 @@
 package blindbls
 
 import (
+	"math/big"
 	"testing"
 
+	"github.com/nmohnblatt/contact_discovery2/crypto/bls12381"
 	"github.com/nmohnblatt/contact_discovery2/crypto/dedishash"
 	"github.com/nmohnblatt/contact_discovery2/crypto/morebls"
+	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/pairing/bn256"
 	"go.dedis.ch/kyber/v3/sign/bls"
 	"go.dedis.ch/kyber/v3/util/random"
 )
 
-func TestCheckGroup(t *testing.T) {
-	suite := bn256.NewSuite()
-	p1 := suite.G1().Point()
-	p2 := suite.G2().Point()
+var testDST = []byte("CONTACT-DISCOVERY2-TEST-V01-CS01-with-BN256_XMD:SHA-256_SVDW_RO_")
+
+// testSuites lists the pairings every test runs against
+var testSuites = []struct {
+	name  string
+	suite pairing.Suite
+}{
+	{"bn256", bn256.NewSuite()},
+	{"bls12381", bls12381.NewSuite()},
+}
+
+// forEachSuite runs test once per pairing of testSuites
+func forEachSuite(t *testing.T, test func(*testing.T, pairing.Suite)) {
+	for _, s := range testSuites {
+		suite := s.suite
+		t.Run(s.name, func(t *testing.T) { test(t, suite) })
+	}
+}
+
+func TestCheckGroup(t *testing.T) { forEachSuite(t, testCheckGroup) }
+
+func testCheckGroup(t *testing.T, suite pairing.Suite) {
+	p1 := suite.G1().Point().Pick(random.New())
+	p2 := suite.G2().Point().Pick(random.New())
 
 	if test := CheckGroup(p1, suite.G1()); !test {
 		t.Errorf("p1 was not recognised as a G1 point")
@@ -31,12 +54,120 @@ func TestCheckGroup(t *testing.T) {
 		t.Errorf("p2 was recognised as a G1 point")
 	}
 
+	if test := CheckGroup(suite.G1().Point().Null(), suite.G1()); test {
+		t.Errorf("The identity of G1 was accepted")
+	}
+
+	if test := CheckGroup(suite.G2().Point().Null(), suite.G2()); test {
+		t.Errorf("The identity of G2 was accepted")
+	}
+
+	identity, _ := suite.G1().Point().Null().MarshalBinary()
+	if _, err := Sign(suite.G1(), suite.G1().Scalar().Pick(random.New()), identity); err == nil {
+		t.Errorf("The identity was signed")
+	}
+	if _, err := Unblind(suite.G1(), suite.G1().Scalar().Pick(random.New()), identity); err == nil {
+		t.Errorf("The identity was unblinded")
+	}
 }
 
-func TestBlindUnblind(t *testing.T) {
-	msg := []byte("Hello Boneh-Lynn-Shacham")
+// bn256P is the characteristic of the field bn256 is defined over
+var bn256P, _ = new(big.Int).SetString("65000549695646603732796438742359905742825358107623003571877145026864184071783", 10)
+
+// fp2 is the element a + bi of the quadratic extension bn256's G2 is defined over, where i^2 = -1
+type fp2 struct{ a, b *big.Int }
+
+func (x fp2) add(y fp2) fp2 {
+	a, b := new(big.Int).Add(x.a, y.a), new(big.Int).Add(x.b, y.b)
+	return fp2{a.Mod(a, bn256P), b.Mod(b, bn256P)}
+}
+
+func (x fp2) sub(y fp2) fp2 {
+	a, b := new(big.Int).Sub(x.a, y.a), new(big.Int).Sub(x.b, y.b)
+	return fp2{a.Mod(a, bn256P), b.Mod(b, bn256P)}
+}
+
+func (x fp2) mul(y fp2) fp2 {
+	a := new(big.Int).Sub(new(big.Int).Mul(x.a, y.a), new(big.Int).Mul(x.b, y.b))
+	b := new(big.Int).Add(new(big.Int).Mul(x.a, y.b), new(big.Int).Mul(x.b, y.a))
+	return fp2{a.Mod(a, bn256P), b.Mod(b, bn256P)}
+}
+
+// sqrt returns a square root of x, if it has one. As p = 3 mod 4, a square root of the norm n gives
+// x = (s + bi/2s)^2 with s^2 = (a +- n)/2
+func (x fp2) sqrt() (fp2, bool) {
+	exp := new(big.Int).Rsh(new(big.Int).Add(bn256P, big.NewInt(1)), 2)
+	half := new(big.Int).ModInverse(big.NewInt(2), bn256P)
+	norm := new(big.Int).Mod(new(big.Int).Add(new(big.Int).Mul(x.a, x.a), new(big.Int).Mul(x.b, x.b)), bn256P)
+	n := new(big.Int).Exp(norm, exp, bn256P)
+	for _, sign := range []int64{1, -1} {
+		t := new(big.Int).Add(x.a, new(big.Int).Mul(big.NewInt(sign), n))
+		t.Mul(t, half).Mod(t, bn256P)
+		s := new(big.Int).Exp(t, exp, bn256P)
+		if s.Sign() == 0 {
+			continue
+		}
+		b := new(big.Int).Mul(x.b, new(big.Int).ModInverse(new(big.Int).Lsh(s, 1), bn256P))
+		root := fp2{s, b.Mod(b, bn256P)}
+		if r := root.mul(root); r.a.Cmp(x.a) == 0 && r.b.Cmp(x.b) == 0 {
+			return root, true
+		}
+	}
+	return fp2{}, false
+}
+
+// decodeTwistPoint reads the coordinates of a bn256 G2 point, encoded as x.b || x.a || y.b || y.a
+func decodeTwistPoint(buf []byte) (fp2, fp2) {
+	c := make([]*big.Int, 4)
+	for i := range c {
+		c[i] = new(big.Int).SetBytes(buf[32*i : 32*(i+1)])
+	}
+	return fp2{c[1], c[0]}, fp2{c[3], c[2]}
+}
+
+func encodeTwistPoint(x, y fp2) []byte {
+	buf := make([]byte, 128)
+	for i, c := range []*big.Int{x.b, x.a, y.b, y.a} {
+		b := c.Bytes()
+		copy(buf[32*(i+1)-len(b):], b)
+	}
+	return buf
+}
+
+// TestCheckGroupRejectsPointsOutsideSubgroup builds a point of bn256's twist outside G2, which kyber
+// decodes without complaint, and checks that it is neither accepted nor signed
+func TestCheckGroupRejectsPointsOutsideSubgroup(t *testing.T) {
 	suite := bn256.NewSuite()
-	H1M, _ := dedishash.Hash(suite, suite.G1(), msg)
+	base, _ := suite.G2().Point().Base().MarshalBinary()
+	x, y := decodeTwistPoint(base)
+	b := y.mul(y).sub(x.mul(x).mul(x))
+
+	for i := int64(1); ; i++ {
+		x := fp2{big.NewInt(i), big.NewInt(0)}
+		y, found := x.mul(x).mul(x).add(b).sqrt()
+		if !found {
+			continue
+		}
+		encoded := encodeTwistPoint(x, y)
+		P := suite.G2().Point()
+		if err := P.UnmarshalBinary(encoded); err != nil {
+			t.Fatal(err)
+		}
+		if test := CheckGroup(P, suite.G2()); test {
+			t.Errorf("A point outside the subgroup was recognised as a G2 point")
+		}
+		if _, err := Sign(suite.G2(), suite.G2().Scalar().Pick(random.New()), encoded); err == nil {
+			t.Errorf("A point outside the subgroup was signed")
+		}
+		return
+	}
+}
+
+func TestBlindUnblind(t *testing.T) { forEachSuite(t, testBlindUnblind) }
+
+func testBlindUnblind(t *testing.T, suite pairing.Suite) {
+	msg := []byte("Hello Boneh-Lynn-Shacham")
+	H1M, _ := dedishash.Hash(suite, suite.G1(), msg, testDST)
 	BF := suite.G1().Scalar().Pick(random.New())
 
 	aH1M, err := Blind(suite.G1(), BF, H1M)
@@ -54,10 +185,11 @@ func TestBlindUnblind(t *testing.T) {
 	}
 }
 
-func TestBlindBLSG1(t *testing.T) {
+func TestBlindBLSG1(t *testing.T) { forEachSuite(t, testBlindBLSG1) }
+
+func testBlindBLSG1(t *testing.T, suite pairing.Suite) {
 	msg := []byte("Hello Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
-	H1M, _ := dedishash.Hash(suite, suite.G1(), msg)
+	H1M, _ := dedishash.Hash(suite, suite.G1(), msg, testDST)
 	BF := suite.G1().Scalar().Pick(random.New())
 	aH1M, err := Blind(suite.G1(), BF, H1M)
 	if err != nil {
@@ -85,10 +217,11 @@ func TestBlindBLSG1(t *testing.T) {
 	}
 }
 
-func TestBlindBLSG2(t *testing.T) {
+func TestBlindBLSG2(t *testing.T) { forEachSuite(t, testBlindBLSG2) }
+
+func testBlindBLSG2(t *testing.T, suite pairing.Suite) {
 	msg := []byte("Hello Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
-	H2M, _ := dedishash.Hash(suite, suite.G2(), msg)
+	H2M, _ := dedishash.Hash(suite, suite.G2(), msg, testDST)
 	BF := suite.G2().Scalar().Pick(random.New())
 	aH2M, err := Blind(suite.G2(), BF, H2M)
 	if err != nil {
@@ -116,10 +249,11 @@ func TestBlindBLSG2(t *testing.T) {
 	}
 }
 
-func TestBlindBLSFailSig(t *testing.T) {
+func TestBlindBLSFailSig(t *testing.T) { forEachSuite(t, testBlindBLSFailSig) }
+
+func testBlindBLSFailSig(t *testing.T, suite pairing.Suite) {
 	msg := []byte("Hello Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
-	H1M, _ := dedishash.Hash(suite, suite.G1(), msg)
+	H1M, _ := dedishash.Hash(suite, suite.G1(), msg, testDST)
 	BF := suite.G1().Scalar().Pick(random.New())
 	aH1M, err := Blind(suite.G1(), BF, H1M)
 	if err != nil {
@@ -147,10 +281,11 @@ func TestBlindBLSFailSig(t *testing.T) {
 	}
 }
 
-func TestBlindBLSFailKey(t *testing.T) {
+func TestBlindBLSFailKey(t *testing.T) { forEachSuite(t, testBlindBLSFailKey) }
+
+func testBlindBLSFailKey(t *testing.T, suite pairing.Suite) {
 	msg := []byte("Hello Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
-	H1M, _ := dedishash.Hash(suite, suite.G1(), msg)
+	H1M, _ := dedishash.Hash(suite, suite.G1(), msg, testDST)
 	BF := suite.G1().Scalar().Pick(random.New())
 	aH1M, err := Blind(suite.G1(), BF, H1M)
 	if err != nil {
@@ -3,13 +3,17 @@ package blindtbls
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto/blindbls"
 
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/share"
 	"go.dedis.ch/kyber/v3/sign/tbls"
 )
 
-// SigSharetoPubShare converts a SigShare (byte representation) to a PubShare (complex representation)
+// SigSharetoPubShare converts a SigShare (byte representation) to a PubShare (complex representation). The
+// share must pass blindbls.CheckGroup
 func SigSharetoPubShare(group kyber.Group, sig tbls.SigShare) (*share.PubShare, error) {
 	i, err := sig.Index()
 	if err != nil {
@@ -20,6 +24,9 @@ func SigSharetoPubShare(group kyber.Group, sig tbls.SigShare) (*share.PubShare,
 	if err := point.UnmarshalBinary(sig.Value()); err != nil {
 		return &share.PubShare{I: -1, V: nil}, err
 	}
+	if check := blindbls.CheckGroup(point, group); !check {
+		return &share.PubShare{I: -1, V: nil}, errors.New("signature share is not in the group")
+	}
 
 	return &share.PubShare{I: i, V: point}, nil
 
@@ -3,13 +3,14 @@ package blindtbls
 import (
 	"testing"
 
-	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/share"
 	"go.dedis.ch/kyber/v3/util/random"
 )
 
-func TestConvert(t *testing.T) {
-	suite := bn256.NewSuite()
+func TestConvert(t *testing.T) { forEachSuite(t, testConvert) }
+
+func testConvert(t *testing.T, suite pairing.Suite) {
 	integer := 1
 	point := suite.G1().Point().Pick(random.New())
 
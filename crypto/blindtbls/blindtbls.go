@@ -3,12 +3,16 @@ package blindtbls
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
 
 	"github.com/nmohnblatt/contact_discovery2/crypto/blindbls"
+	"github.com/nmohnblatt/contact_discovery2/crypto/nizk"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/share"
 	"go.dedis.ch/kyber/v3/sign/tbls"
+	"go.dedis.ch/kyber/v3/util/random"
 )
 
 // Blind returns a blinded byte representation of an input point
@@ -33,6 +37,46 @@ func Sign(suite pairing.Suite, group kyber.Group, private *share.PriShare, blind
 	return buf.Bytes(), nil
 }
 
+// SignBatch signs each blinded point of blindedHashes with the secret key share xi, as Sign does. The
+// shares are returned in the order of the points
+func SignBatch(suite pairing.Suite, group kyber.Group, private *share.PriShare, blindedHashes [][]byte) ([]tbls.SigShare, error) {
+	sigs := make([]tbls.SigShare, len(blindedHashes))
+	for j, blindedHash := range blindedHashes {
+		s, err := Sign(suite, group, private, blindedHash)
+		if err != nil {
+			return nil, fmt.Errorf("point %d: %v", j, err)
+		}
+		sigs[j] = s
+	}
+	return sigs, nil
+}
+
+// shareProofContext separates share proofs from other uses of the nizk package
+var shareProofContext = []byte("blind tbls signature share")
+
+// ProveShare outputs a Chaum-Pedersen proof that the signature share s = xi * aH(m) was computed with
+// the same secret share xi as the public share commitment Xi = xi * B, where B is the base point of
+// pubGroup (the group of the public polynomial). It is much cheaper to check than the pairing in Verify
+func ProveShare(group, pubGroup kyber.Group, private *share.PriShare, blindedHash, s []byte) ([]byte, error) {
+	aHM := group.Point()
+	if err := aHM.UnmarshalBinary(blindedHash); err != nil {
+		return nil, err
+	}
+	Si, err := SigSharetoPubShare(group, tbls.SigShare(s))
+	if err != nil {
+		return nil, err
+	}
+	Xi := pubGroup.Point().Mul(private.V, nil)
+
+	return nizk.ProveDLEQ(pubGroup, group, pubGroup.Point().Base(), aHM, private.V, Xi, Si.V, shareProofContext)
+}
+
+// VerifyShare checks a proof output by ProveShare against the public polynomial, which lives in pubGroup
+func VerifyShare(group, pubGroup kyber.Group, public *share.PubPoly, aHM kyber.Point, s *share.PubShare, proof []byte) error {
+	base, _ := public.Info()
+	return nizk.VerifyDLEQ(pubGroup, group, base, aHM, public.Eval(s.I).V, s.V, proof, shareProofContext)
+}
+
 // UnblindShare outputs the unblinded point underlying the blinded signature s
 func UnblindShare(group kyber.Group, blindingFactor kyber.Scalar, s []byte) (*share.PubShare, error) {
 	Si := tbls.SigShare(s)
@@ -46,6 +90,9 @@ func UnblindShare(group kyber.Group, blindingFactor kyber.Scalar, s []byte) (*sh
 	if err != nil {
 		return &share.PubShare{I: -1, V: nil}, err
 	}
+	if check := blindbls.CheckGroup(axHM, group); !check {
+		return &share.PubShare{I: -1, V: nil}, errors.New("unblind: signature share is not in the group")
+	}
 
 	inv := group.Scalar().Inv(blindingFactor)
 	xHM := axHM.Mul(inv, axHM)
@@ -61,6 +108,38 @@ func Verify(suite pairing.Suite, group kyber.Group, public *share.PubPoly, HM ky
 	return blindbls.Verify(suite, group, public.Eval(s.I).V, HM, s.V)
 }
 
+// VerifyBatch checks the signature shares sigs[j] = xi * aHM[j] returned by a single server, all with
+// the same index i, against the public polynomial. Instead of a pairing check per share, the shares and
+// points are combined with random coefficients rj and a single check is made that Sum(rj * sigs[j]) is
+// the signature of Sum(rj * aHM[j]): a batch holding an invalid share passes with negligible probability
+func VerifyBatch(suite pairing.Suite, group kyber.Group, public *share.PubPoly, aHM []kyber.Point, sigs []*share.PubShare) error {
+	if len(sigs) == 0 || len(sigs) != len(aHM) {
+		return errors.New("verify batch: expected one share per point")
+	}
+
+	combinedHM, combinedSig := group.Point().Null(), group.Point().Null()
+	for j, sig := range sigs {
+		if sig.I != sigs[0].I {
+			return errors.New("verify batch: shares have different indices")
+		}
+		r := group.Scalar().Pick(random.New())
+		combinedHM.Add(combinedHM, group.Point().Mul(r, aHM[j]))
+		combinedSig.Add(combinedSig, group.Point().Mul(r, sig.V))
+	}
+
+	return blindbls.Verify(suite, group, public.Eval(sigs[0].I).V, combinedHM, combinedSig)
+}
+
+// Combine reconstructs the full signature from a threshold t of signature shares that were already
+// verified, e.g. with VerifyShare
+func Combine(group kyber.Group, sigs []*share.PubShare, t, n int) ([]byte, error) {
+	commit, err := share.RecoverCommit(group, sigs, t, n)
+	if err != nil {
+		return nil, err
+	}
+	return commit.MarshalBinary()
+}
+
 // Recover reconstructs the full BLS signature S = x * H(m) from a threshold t
 // of signature shares Si using Lagrange interpolation. The full signature S
 // can be verified through the regular BLS verification routine using the
@@ -73,13 +152,5 @@ func Recover(suite pairing.Suite, group kyber.Group, public *share.PubPoly, HM k
 		}
 	}
 
-	commit, err := share.RecoverCommit(group, sigs, t, n)
-	if err != nil {
-		return nil, err
-	}
-	sig, err := commit.MarshalBinary()
-	if err != nil {
-		return nil, err
-	}
-	return sig, nil
+	return Combine(group, sigs, t, n)
 }
@@ -1,23 +1,47 @@
 package blindtbls
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/nmohnblatt/contact_discovery2/crypto/blindbls"
+	"github.com/nmohnblatt/contact_discovery2/crypto/bls12381"
 	"github.com/nmohnblatt/contact_discovery2/crypto/dedishash"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/pairing/bn256"
 	"go.dedis.ch/kyber/v3/share"
 	"go.dedis.ch/kyber/v3/sign/tbls"
 	"go.dedis.ch/kyber/v3/util/random"
 )
 
-func TestUnblindShare(test *testing.T) {
+var testDST = []byte("CONTACT-DISCOVERY2-TEST-V01-CS01-with-BN256_XMD:SHA-256_SVDW_RO_")
+
+// testSuites lists the pairings every test runs against
+var testSuites = []struct {
+	name  string
+	suite pairing.Suite
+}{
+	{"bn256", bn256.NewSuite()},
+	{"bls12381", bls12381.NewSuite()},
+}
+
+// forEachSuite runs test once per pairing of testSuites
+func forEachSuite(t *testing.T, test func(*testing.T, pairing.Suite)) {
+	for _, s := range testSuites {
+		suite := s.suite
+		t.Run(s.name, func(t *testing.T) { test(t, suite) })
+	}
+}
+
+func TestUnblindShare(t *testing.T) { forEachSuite(t, testUnblindShare) }
+
+func testUnblindShare(test *testing.T, suite pairing.Suite) {
 	// SETUP PHASE
 	msg := []byte("Hello threshold Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
 	signGroup := suite.G1()
 	keyGroup := suite.G2()
-	HM, err := dedishash.Hash(suite, signGroup, msg)
+	HM, err := dedishash.Hash(suite, signGroup, msg, testDST)
 	HMBytes, err := HM.MarshalBinary()
 	if err != nil {
 		test.Error(err)
@@ -82,13 +106,14 @@ func TestUnblindShare(test *testing.T) {
 	}
 }
 
-func TestBlindTBLSRecoverThenUnblind(test *testing.T) {
+func TestBlindTBLSRecoverThenUnblind(t *testing.T) { forEachSuite(t, testBlindTBLSRecoverThenUnblind) }
+
+func testBlindTBLSRecoverThenUnblind(test *testing.T, suite pairing.Suite) {
 	// SETUP PHASE
 	msg := []byte("Hello threshold Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
 	signGroup := suite.G1()
 	keyGroup := suite.G2()
-	HM, err := dedishash.Hash(suite, signGroup, msg)
+	HM, err := dedishash.Hash(suite, signGroup, msg, testDST)
 	if err != nil {
 		test.Error(err)
 	}
@@ -140,13 +165,14 @@ func TestBlindTBLSRecoverThenUnblind(test *testing.T) {
 	}
 }
 
-func TestBlindTBLSUnblindThenRecover(test *testing.T) {
+func TestBlindTBLSUnblindThenRecover(t *testing.T) { forEachSuite(t, testBlindTBLSUnblindThenRecover) }
+
+func testBlindTBLSUnblindThenRecover(test *testing.T, suite pairing.Suite) {
 	// SETUP PHASE
 	msg := []byte("Hello threshold Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
 	signGroup := suite.G1()
 	keyGroup := suite.G2()
-	HM, err := dedishash.Hash(suite, signGroup, msg)
+	HM, err := dedishash.Hash(suite, signGroup, msg, testDST)
 	BF := signGroup.Scalar().Pick(random.New())
 	if err != nil {
 		test.Error(err)
@@ -201,3 +227,201 @@ func TestBlindTBLSUnblindThenRecover(test *testing.T) {
 		test.Errorf("Signature did not match")
 	}
 }
+
+func TestProveShare(t *testing.T) { forEachSuite(t, testProveShare) }
+
+func testProveShare(test *testing.T, suite pairing.Suite) {
+	// SETUP PHASE
+	msg := []byte("Hello threshold Boneh-Lynn-Shacham")
+	signGroup := suite.G1()
+	keyGroup := suite.G2()
+	HM, err := dedishash.Hash(suite, signGroup, msg, testDST)
+	if err != nil {
+		test.Fatal(err)
+	}
+	BF := signGroup.Scalar().Pick(random.New())
+	n := 6
+	t := n/2 + 1
+	secret := signGroup.Scalar().Pick(suite.RandomStream())
+	priPoly := share.NewPriPoly(keyGroup, t, secret, suite.RandomStream())
+	pubPoly := priPoly.Commit(keyGroup.Point().Base())
+
+	// BLIND
+	aHM, err := Blind(signGroup, BF, HM)
+	if err != nil {
+		test.Fatal(err)
+	}
+	aHMPoint := signGroup.Point()
+	if err := aHMPoint.UnmarshalBinary(aHM); err != nil {
+		test.Fatal(err)
+	}
+
+	// SIGN AND PROVE, the last share is computed with the wrong secret
+	sigShares := make([]*share.PubShare, 0)
+	for i, x := range priPoly.Shares(n) {
+		signing := x
+		if i == n-1 {
+			signing = &share.PriShare{I: x.I, V: keyGroup.Scalar().Pick(random.New())}
+		}
+		sig, err := Sign(suite, signGroup, signing, aHM)
+		if err != nil {
+			test.Fatal(err)
+		}
+		proof, err := ProveShare(signGroup, keyGroup, signing, aHM, sig)
+		if err != nil {
+			test.Fatal(err)
+		}
+		Si, _ := SigSharetoPubShare(signGroup, tbls.SigShare(sig))
+
+		err = VerifyShare(signGroup, keyGroup, pubPoly, aHMPoint, Si, proof)
+		if i < n-1 && err != nil {
+			test.Errorf("index %d: valid share was rejected", x.I)
+		} else if i == n-1 && err == nil {
+			test.Errorf("index %d: invalid share was accepted", x.I)
+		}
+		if err == nil {
+			sigShares = append(sigShares, Si)
+		}
+	}
+
+	// COMBINE, UNBLIND AND CHECK
+	sig, err := Combine(signGroup, sigShares, t, n)
+	if err != nil {
+		test.Fatal(err)
+	}
+	final, _ := blindbls.Unblind(signGroup, BF, sig)
+	if !final.Equal(signGroup.Point().Mul(secret, HM)) {
+		test.Errorf("Computed signature does not match expected signature")
+	}
+}
+
+func TestSignBatch(t *testing.T) { forEachSuite(t, testSignBatch) }
+
+func testSignBatch(test *testing.T, suite pairing.Suite) {
+	// SETUP PHASE, keys signing in G2 are committed in G1
+	signGroup := suite.G2()
+	keyGroup := suite.G1()
+	n := 5
+	t := 3
+	priPoly := share.NewPriPoly(keyGroup, t, nil, suite.RandomStream())
+	pubPoly := priPoly.Commit(keyGroup.Point().Base())
+	x := priPoly.Shares(n)[2]
+
+	// BLIND a batch of identifiers
+	BF := signGroup.Scalar().Pick(random.New())
+	var blinded [][]byte
+	var aHM []kyber.Point
+	for _, id := range []string{"phone", "email", "handle", "username"} {
+		HM, err := dedishash.Hash(suite, signGroup, []byte(id), testDST)
+		if err != nil {
+			test.Fatal(err)
+		}
+		b, err := Blind(signGroup, BF, HM)
+		if err != nil {
+			test.Fatal(err)
+		}
+		blinded = append(blinded, b)
+		aHM = append(aHM, signGroup.Point().Mul(BF, HM))
+	}
+
+	// SIGN AND VERIFY the whole batch
+	sigs, err := SignBatch(suite, signGroup, x, blinded)
+	if err != nil {
+		test.Fatal(err)
+	}
+	shares := make([]*share.PubShare, len(sigs))
+	for j, sig := range sigs {
+		if shares[j], err = SigSharetoPubShare(signGroup, sig); err != nil {
+			test.Fatal(err)
+		}
+	}
+	if err := VerifyBatch(suite, signGroup, pubPoly, aHM, shares); err != nil {
+		test.Errorf("Valid batch was rejected: %s", err)
+	}
+
+	// A single invalid share spoils the batch
+	tampered := append([]*share.PubShare(nil), shares...)
+	tampered[1] = &share.PubShare{I: x.I, V: signGroup.Point().Pick(random.New())}
+	if err := VerifyBatch(suite, signGroup, pubPoly, aHM, tampered); err == nil {
+		test.Errorf("Batch holding an invalid share was accepted")
+	}
+	if err := VerifyBatch(suite, signGroup, pubPoly, aHM[1:], shares); err == nil {
+		test.Errorf("Batch with a missing point was accepted")
+	}
+
+	// Malformed points are reported with their position in the batch
+	blinded[3] = []byte("not a point")
+	if _, err := SignBatch(suite, signGroup, x, blinded); err == nil {
+		test.Errorf("Batch holding a malformed point was signed")
+	}
+}
+
+// blindedShares signs a blinded hash in signGroup with each of n shares of a (t, n) sharing
+func blindedShares(b *testing.B, suite pairing.Suite, signGroup, keyGroup kyber.Group, t, n int) (*share.PubPoly, kyber.Point, []*share.PubShare) {
+	HM, err := dedishash.Hash(suite, signGroup, []byte("alice"), testDST)
+	if err != nil {
+		b.Fatal(err)
+	}
+	aHM, err := Blind(signGroup, signGroup.Scalar().Pick(random.New()), HM)
+	if err != nil {
+		b.Fatal(err)
+	}
+	aHMPoint := signGroup.Point()
+	if err := aHMPoint.UnmarshalBinary(aHM); err != nil {
+		b.Fatal(err)
+	}
+
+	priPoly := share.NewPriPoly(keyGroup, t, nil, suite.RandomStream())
+	sigs := make([]*share.PubShare, n)
+	for i, x := range priPoly.Shares(n) {
+		sig, err := Sign(suite, signGroup, x, aHM)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if sigs[i], err = SigSharetoPubShare(signGroup, tbls.SigShare(sig)); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return priPoly.Commit(keyGroup.Point().Base()), aHMPoint, sigs
+}
+
+func benchmarkSign(b *testing.B, signGroup, keyGroup kyber.Group) {
+	suite := bn256.NewSuite()
+	HM, _ := dedishash.Hash(suite, signGroup, []byte("alice"), testDST)
+	aHM, _ := Blind(signGroup, signGroup.Scalar().Pick(random.New()), HM)
+	x := share.NewPriPoly(keyGroup, 2, nil, suite.RandomStream()).Shares(3)[0]
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := Sign(suite, signGroup, x, aHM); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSignG1(b *testing.B) {
+	suite := bn256.NewSuite()
+	benchmarkSign(b, suite.G1(), suite.G2())
+}
+
+func BenchmarkSignG2(b *testing.B) {
+	suite := bn256.NewSuite()
+	benchmarkSign(b, suite.G2(), suite.G1())
+}
+
+// BenchmarkRecover verifies t shares and combines them, as a user does once per group
+func BenchmarkRecover(b *testing.B) {
+	for _, tn := range [][2]int{{2, 3}, {3, 9}, {7, 13}, {11, 31}} {
+		t, n := tn[0], tn[1]
+		b.Run(fmt.Sprintf("t=%d,n=%d", t, n), func(b *testing.B) {
+			suite := bn256.NewSuite()
+			pubPoly, aHM, sigs := blindedShares(b, suite, suite.G1(), suite.G2(), t, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := Recover(suite, suite.G1(), pubPoly, aHM, sigs[:t], t, n); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
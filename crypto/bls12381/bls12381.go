@@ -0,0 +1,137 @@
+// Package bls12381 exposes the BLS12-381 pairing of github.com/kilic/bls12-381 as a kyber pairing.Suite, so
+// that it can be used wherever the system takes kyber's bn256. Points are encoded in the compressed form of
+// the zcash serialisation; decoding rejects points outside the prime order subgroups.
+//
+// Unlike kyber's groups, the kilic groups carry scratch space and are not safe for concurrent use, so a fresh
+// one is created for each operation.
+package bls12381
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"math/big"
+	"reflect"
+
+	bls "github.com/kilic/bls12-381"
+	"go.dedis.ch/fixbuf"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/group/mod"
+	"go.dedis.ch/kyber/v3/util/random"
+	"go.dedis.ch/kyber/v3/xof/blake2xb"
+)
+
+// Order is the order r of the three groups
+var Order = bls.NewG1().Q()
+
+// Domain separation tags used by Hash, those of the basic BLS signature ciphersuites
+var (
+	signatureDSTG1 = []byte("BLS_SIG_BLS12381G1_XMD:SHA-256_SSWU_RO_NUL_")
+	signatureDSTG2 = []byte("BLS_SIG_BLS12381G2_XMD:SHA-256_SSWU_RO_NUL_")
+)
+
+// Suite implements pairing.Suite for BLS12-381
+type Suite struct {
+	g1 *groupG1
+	g2 *groupG2
+	gt *groupGT
+}
+
+// NewSuite returns the BLS12-381 pairing suite
+func NewSuite() *Suite {
+	return &Suite{g1: &groupG1{}, g2: &groupG2{}, gt: &groupGT{}}
+}
+
+// G1 returns the group G1, whose points are 48 bytes long
+func (s *Suite) G1() kyber.Group { return s.g1 }
+
+// G2 returns the group G2, whose points are 96 bytes long
+func (s *Suite) G2() kyber.Group { return s.g2 }
+
+// GT returns the target group, written additively as kyber expects
+func (s *Suite) GT() kyber.Group { return s.gt }
+
+// Pair computes the pairing of p1 in G1 and p2 in G2
+func (s *Suite) Pair(p1, p2 kyber.Point) kyber.Point {
+	engine := bls.NewEngine()
+	engine.AddPair(p1.(*pointG1).p, p2.(*pointG2).p)
+	return &pointGT{e: engine.Result()}
+}
+
+// String names the suite
+func (s *Suite) String() string { return "bls12381" }
+
+// Hash returns a new SHA-256 instance
+func (s *Suite) Hash() hash.Hash { return sha256.New() }
+
+// XOF returns a blake2xb XOF seeded with seed
+func (s *Suite) XOF(seed []byte) kyber.XOF { return blake2xb.New(seed) }
+
+// RandomStream returns a stream of cryptographically secure random bytes
+func (s *Suite) RandomStream() cipher.Stream { return random.New() }
+
+// Read implements kyber.Encoding
+func (s *Suite) Read(r io.Reader, objs ...interface{}) error { return fixbuf.Read(r, s, objs...) }
+
+// Write implements kyber.Encoding
+func (s *Suite) Write(w io.Writer, objs ...interface{}) error { return fixbuf.Write(w, objs) }
+
+var (
+	tScalar  = reflect.TypeOf((*kyber.Scalar)(nil)).Elem()
+	tPointG1 = reflect.TypeOf(pointG1{})
+	tPointG2 = reflect.TypeOf(pointG2{})
+	tPointGT = reflect.TypeOf(pointGT{})
+)
+
+// New creates the objects read by Read
+func (s *Suite) New(t reflect.Type) interface{} {
+	switch t {
+	case tScalar:
+		return s.g1.Scalar()
+	case tPointG1:
+		return s.g1.Point()
+	case tPointG2:
+		return s.g2.Point()
+	case tPointGT:
+		return s.gt.Point()
+	}
+	return nil
+}
+
+// newScalar returns a zero scalar modulo the group order
+func newScalar() kyber.Scalar {
+	return mod.NewInt64(0, Order)
+}
+
+// scalarToBig returns the integer held by a scalar
+func scalarToBig(s kyber.Scalar) *big.Int {
+	if i, ok := s.(*mod.Int); ok {
+		return new(big.Int).Set(&i.V)
+	}
+	buf, _ := s.MarshalBinary()
+	return new(big.Int).SetBytes(buf)
+}
+
+// unmarshalFrom reads a point of size bytes from r, or picks one if r is a stream
+func unmarshalFrom(p kyber.Point, r io.Reader) (int, error) {
+	if stream, ok := r.(cipher.Stream); ok {
+		p.Pick(stream)
+		return -1, nil
+	}
+	buf := make([]byte, p.MarshalSize())
+	n, err := io.ReadFull(r, buf)
+	if err != nil {
+		return n, err
+	}
+	return n, p.UnmarshalBinary(buf)
+}
+
+// marshalTo writes the encoding of p to w
+func marshalTo(p kyber.Point, w io.Writer) (int, error) {
+	buf, err := p.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(buf)
+}
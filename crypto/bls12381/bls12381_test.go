@@ -0,0 +1,81 @@
+package bls12381
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func TestGroups(t *testing.T) {
+	suite := NewSuite()
+	for _, g := range []kyber.Group{suite.G1(), suite.G2(), suite.GT()} {
+		a, b := g.Scalar().Pick(random.New()), g.Scalar().Pick(random.New())
+		A, B := g.Point().Mul(a, nil), g.Point().Mul(b, nil)
+
+		sum := g.Point().Add(A, B)
+		if !sum.Equal(g.Point().Mul(g.Scalar().Add(a, b), nil)) {
+			t.Errorf("%s: addition is not homomorphic", g)
+		}
+		if !g.Point().Sub(sum, B).Equal(A) {
+			t.Errorf("%s: subtraction does not undo addition", g)
+		}
+		if !g.Point().Add(A, g.Point().Neg(A)).Equal(g.Point().Null()) {
+			t.Errorf("%s: negation is wrong", g)
+		}
+		if !g.Point().Mul(g.Scalar().SetInt64(0), A).Equal(g.Point().Null()) {
+			t.Errorf("%s: multiplication by zero is not the identity", g)
+		}
+
+		buf, err := A.MarshalBinary()
+		if err != nil || len(buf) != g.PointLen() || len(buf) != A.MarshalSize() {
+			t.Fatalf("%s: wrong encoding length", g)
+		}
+		decoded := g.Point()
+		if err := decoded.UnmarshalBinary(buf); err != nil || !decoded.Equal(A) {
+			t.Errorf("%s: encoding does not round trip: %v", g, err)
+		}
+		if err := decoded.UnmarshalBinary(buf[1:]); err == nil {
+			t.Errorf("%s: truncated encoding accepted", g)
+		}
+
+		clone := A.Clone()
+		clone.Add(clone, A)
+		if clone.Equal(A) {
+			t.Errorf("%s: clone shares its value with the original", g)
+		}
+	}
+}
+
+func TestPairing(t *testing.T) {
+	suite := NewSuite()
+	a, b := suite.G1().Scalar().Pick(random.New()), suite.G1().Scalar().Pick(random.New())
+	P := suite.G1().Point().Mul(a, nil)
+	Q := suite.G2().Point().Mul(b, nil)
+
+	left := suite.Pair(P, Q)
+	right := suite.GT().Point().Mul(suite.G1().Scalar().Mul(a, b), nil)
+	if !left.Equal(right) {
+		t.Errorf("Pairing is not bilinear")
+	}
+	if !suite.Pair(suite.G1().Point().Base(), suite.G2().Point().Base()).Equal(suite.GT().Point().Base()) {
+		t.Errorf("GT base is not the pairing of the generators")
+	}
+}
+
+// Test vector from https://www.rfc-editor.org/rfc/rfc9380#appendix-J.9.1
+func TestHashToPoint(t *testing.T) {
+	suite := NewSuite()
+	P, err := suite.G1().(*groupG1).HashToPoint([]byte{}, []byte("QUUX-V01-CS02-with-BLS12381G1_XMD:SHA-256_SSWU_RO_"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := P.MarshalBinary()
+	// compressed encoding: the x coordinate with the flags set in its first byte
+	want := "052926add2207b76ca4fa57a8734416c8dc95e24501772c814278700eed6d1e4e8cf62d9c09db0fac349612b759e79a1"
+	buf[0] &= 0x1f
+	if got := hex.EncodeToString(buf); got != want {
+		t.Errorf("Hash does not match RFC 9380:\ngot  %s\nwant %s", got, want)
+	}
+}
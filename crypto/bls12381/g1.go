@@ -0,0 +1,127 @@
+package bls12381
+
+import (
+	"crypto/cipher"
+	"encoding/hex"
+	"io"
+
+	bls "github.com/kilic/bls12-381"
+	"go.dedis.ch/kyber/v3"
+)
+
+type groupG1 struct{}
+
+func (g *groupG1) String() string       { return "bls12381.G1" }
+func (g *groupG1) ScalarLen() int       { return 32 }
+func (g *groupG1) Scalar() kyber.Scalar { return newScalar() }
+func (g *groupG1) PointLen() int        { return 48 }
+func (g *groupG1) Point() kyber.Point   { return &pointG1{p: bls.NewG1().Zero()} }
+
+// HashToPoint hashes msg to G1 following the BLS12381G1_XMD:SHA-256_SSWU_RO_ suite of RFC 9380
+func (g *groupG1) HashToPoint(msg, dst []byte) (kyber.Point, error) {
+	p, err := bls.NewG1().HashToCurve(msg, dst)
+	if err != nil {
+		return nil, err
+	}
+	return &pointG1{p: p}, nil
+}
+
+type pointG1 struct {
+	p *bls.PointG1
+}
+
+func (p *pointG1) MarshalBinary() ([]byte, error) {
+	return bls.NewG1().ToCompressed(new(bls.PointG1).Set(p.p)), nil
+}
+
+func (p *pointG1) UnmarshalBinary(buf []byte) error {
+	q, err := bls.NewG1().FromCompressed(buf)
+	if err != nil {
+		return err
+	}
+	p.p = q
+	return nil
+}
+
+func (p *pointG1) String() string {
+	buf, _ := p.MarshalBinary()
+	return "bls12381.G1(" + hex.EncodeToString(buf) + ")"
+}
+
+func (p *pointG1) MarshalSize() int                       { return 48 }
+func (p *pointG1) MarshalTo(w io.Writer) (int, error)     { return marshalTo(p, w) }
+func (p *pointG1) UnmarshalFrom(r io.Reader) (int, error) { return unmarshalFrom(p, r) }
+
+func (p *pointG1) Equal(q kyber.Point) bool {
+	return bls.NewG1().Equal(p.p, q.(*pointG1).p)
+}
+
+func (p *pointG1) Null() kyber.Point {
+	p.p = bls.NewG1().Zero()
+	return p
+}
+
+func (p *pointG1) Base() kyber.Point {
+	p.p = bls.NewG1().One()
+	return p
+}
+
+func (p *pointG1) Pick(rand cipher.Stream) kyber.Point {
+	return p.Mul(newScalar().Pick(rand), nil)
+}
+
+func (p *pointG1) Set(q kyber.Point) kyber.Point {
+	p.p = new(bls.PointG1).Set(q.(*pointG1).p)
+	return p
+}
+
+func (p *pointG1) Clone() kyber.Point {
+	return &pointG1{p: new(bls.PointG1).Set(p.p)}
+}
+
+// Hash hashes msg to G1 with the domain separation tag of the BLS signature scheme, so that kyber's BLS
+// packages can sign with this suite
+func (p *pointG1) Hash(msg []byte) kyber.Point {
+	q, err := bls.NewG1().HashToCurve(msg, signatureDSTG1)
+	if err != nil {
+		panic(err)
+	}
+	return p.Set(&pointG1{p: q})
+}
+
+func (p *pointG1) EmbedLen() int                                  { return 0 }
+func (p *pointG1) Embed(data []byte, r cipher.Stream) kyber.Point { return p.Pick(r) }
+func (p *pointG1) Data() ([]byte, error)                          { return nil, nil }
+
+func (p *pointG1) Add(a, b kyber.Point) kyber.Point {
+	r := new(bls.PointG1)
+	bls.NewG1().Add(r, a.(*pointG1).p, b.(*pointG1).p)
+	p.p = r
+	return p
+}
+
+func (p *pointG1) Sub(a, b kyber.Point) kyber.Point {
+	r := new(bls.PointG1)
+	bls.NewG1().Sub(r, a.(*pointG1).p, b.(*pointG1).p)
+	p.p = r
+	return p
+}
+
+func (p *pointG1) Neg(a kyber.Point) kyber.Point {
+	r := new(bls.PointG1)
+	bls.NewG1().Neg(r, a.(*pointG1).p)
+	p.p = r
+	return p
+}
+
+func (p *pointG1) Mul(s kyber.Scalar, q kyber.Point) kyber.Point {
+	g := bls.NewG1()
+	base := g.One()
+	if q != nil {
+		base = q.(*pointG1).p
+	}
+	r := new(bls.PointG1)
+	g.MulScalarBig(r, base, scalarToBig(s))
+	p.p = r
+	return p
+}
@@ -0,0 +1,127 @@
+package bls12381
+
+import (
+	"crypto/cipher"
+	"encoding/hex"
+	"io"
+
+	bls "github.com/kilic/bls12-381"
+	"go.dedis.ch/kyber/v3"
+)
+
+type groupG2 struct{}
+
+func (g *groupG2) String() string       { return "bls12381.G2" }
+func (g *groupG2) ScalarLen() int       { return 32 }
+func (g *groupG2) Scalar() kyber.Scalar { return newScalar() }
+func (g *groupG2) PointLen() int        { return 96 }
+func (g *groupG2) Point() kyber.Point   { return &pointG2{p: bls.NewG2().Zero()} }
+
+// HashToPoint hashes msg to G2 following the BLS12381G2_XMD:SHA-256_SSWU_RO_ suite of RFC 9380
+func (g *groupG2) HashToPoint(msg, dst []byte) (kyber.Point, error) {
+	p, err := bls.NewG2().HashToCurve(msg, dst)
+	if err != nil {
+		return nil, err
+	}
+	return &pointG2{p: p}, nil
+}
+
+type pointG2 struct {
+	p *bls.PointG2
+}
+
+func (p *pointG2) MarshalBinary() ([]byte, error) {
+	return bls.NewG2().ToCompressed(new(bls.PointG2).Set(p.p)), nil
+}
+
+func (p *pointG2) UnmarshalBinary(buf []byte) error {
+	q, err := bls.NewG2().FromCompressed(buf)
+	if err != nil {
+		return err
+	}
+	p.p = q
+	return nil
+}
+
+func (p *pointG2) String() string {
+	buf, _ := p.MarshalBinary()
+	return "bls12381.G2(" + hex.EncodeToString(buf) + ")"
+}
+
+func (p *pointG2) MarshalSize() int                       { return 96 }
+func (p *pointG2) MarshalTo(w io.Writer) (int, error)     { return marshalTo(p, w) }
+func (p *pointG2) UnmarshalFrom(r io.Reader) (int, error) { return unmarshalFrom(p, r) }
+
+func (p *pointG2) Equal(q kyber.Point) bool {
+	return bls.NewG2().Equal(p.p, q.(*pointG2).p)
+}
+
+func (p *pointG2) Null() kyber.Point {
+	p.p = bls.NewG2().Zero()
+	return p
+}
+
+func (p *pointG2) Base() kyber.Point {
+	p.p = bls.NewG2().One()
+	return p
+}
+
+func (p *pointG2) Pick(rand cipher.Stream) kyber.Point {
+	return p.Mul(newScalar().Pick(rand), nil)
+}
+
+func (p *pointG2) Set(q kyber.Point) kyber.Point {
+	p.p = new(bls.PointG2).Set(q.(*pointG2).p)
+	return p
+}
+
+func (p *pointG2) Clone() kyber.Point {
+	return &pointG2{p: new(bls.PointG2).Set(p.p)}
+}
+
+// Hash hashes msg to G2 with the domain separation tag of the BLS signature scheme, so that kyber's BLS
+// packages can sign with this suite
+func (p *pointG2) Hash(msg []byte) kyber.Point {
+	q, err := bls.NewG2().HashToCurve(msg, signatureDSTG2)
+	if err != nil {
+		panic(err)
+	}
+	return p.Set(&pointG2{p: q})
+}
+
+func (p *pointG2) EmbedLen() int                                  { return 0 }
+func (p *pointG2) Embed(data []byte, r cipher.Stream) kyber.Point { return p.Pick(r) }
+func (p *pointG2) Data() ([]byte, error)                          { return nil, nil }
+
+func (p *pointG2) Add(a, b kyber.Point) kyber.Point {
+	r := new(bls.PointG2)
+	bls.NewG2().Add(r, a.(*pointG2).p, b.(*pointG2).p)
+	p.p = r
+	return p
+}
+
+func (p *pointG2) Sub(a, b kyber.Point) kyber.Point {
+	r := new(bls.PointG2)
+	bls.NewG2().Sub(r, a.(*pointG2).p, b.(*pointG2).p)
+	p.p = r
+	return p
+}
+
+func (p *pointG2) Neg(a kyber.Point) kyber.Point {
+	r := new(bls.PointG2)
+	bls.NewG2().Neg(r, a.(*pointG2).p)
+	p.p = r
+	return p
+}
+
+func (p *pointG2) Mul(s kyber.Scalar, q kyber.Point) kyber.Point {
+	g := bls.NewG2()
+	base := g.One()
+	if q != nil {
+		base = q.(*pointG2).p
+	}
+	r := new(bls.PointG2)
+	g.MulScalarBig(r, base, scalarToBig(s))
+	p.p = r
+	return p
+}
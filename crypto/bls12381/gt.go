@@ -0,0 +1,117 @@
+package bls12381
+
+import (
+	"crypto/cipher"
+	"encoding/hex"
+	"io"
+
+	bls "github.com/kilic/bls12-381"
+	"go.dedis.ch/kyber/v3"
+)
+
+// gtBase is e(G1, G2) for the generators G1 and G2
+var gtBase = func() *bls.E {
+	engine := bls.NewEngine()
+	engine.AddPair(bls.NewG1().One(), bls.NewG2().One())
+	return engine.Result()
+}()
+
+// groupGT is the multiplicative target group, written additively: Add multiplies and Mul exponentiates
+type groupGT struct{}
+
+func (g *groupGT) String() string       { return "bls12381.GT" }
+func (g *groupGT) ScalarLen() int       { return 32 }
+func (g *groupGT) Scalar() kyber.Scalar { return newScalar() }
+func (g *groupGT) PointLen() int        { return 576 }
+func (g *groupGT) Point() kyber.Point   { return &pointGT{e: bls.NewGT().New()} }
+
+type pointGT struct {
+	e *bls.E
+}
+
+func (p *pointGT) MarshalBinary() ([]byte, error) {
+	return bls.NewGT().ToBytes(p.e), nil
+}
+
+func (p *pointGT) UnmarshalBinary(buf []byte) error {
+	e, err := bls.NewGT().FromBytes(buf)
+	if err != nil {
+		return err
+	}
+	p.e = e
+	return nil
+}
+
+func (p *pointGT) String() string {
+	buf, _ := p.MarshalBinary()
+	return "bls12381.GT(" + hex.EncodeToString(buf) + ")"
+}
+
+func (p *pointGT) MarshalSize() int                       { return 576 }
+func (p *pointGT) MarshalTo(w io.Writer) (int, error)     { return marshalTo(p, w) }
+func (p *pointGT) UnmarshalFrom(r io.Reader) (int, error) { return unmarshalFrom(p, r) }
+
+func (p *pointGT) Equal(q kyber.Point) bool {
+	return p.e.Equal(q.(*pointGT).e)
+}
+
+func (p *pointGT) Null() kyber.Point {
+	p.e = bls.NewGT().New()
+	return p
+}
+
+func (p *pointGT) Base() kyber.Point {
+	p.e = new(bls.E).Set(gtBase)
+	return p
+}
+
+func (p *pointGT) Pick(rand cipher.Stream) kyber.Point {
+	return p.Mul(newScalar().Pick(rand), nil)
+}
+
+func (p *pointGT) Set(q kyber.Point) kyber.Point {
+	p.e = new(bls.E).Set(q.(*pointGT).e)
+	return p
+}
+
+func (p *pointGT) Clone() kyber.Point {
+	return &pointGT{e: new(bls.E).Set(p.e)}
+}
+
+func (p *pointGT) EmbedLen() int                                  { return 0 }
+func (p *pointGT) Embed(data []byte, r cipher.Stream) kyber.Point { return p.Pick(r) }
+func (p *pointGT) Data() ([]byte, error)                          { return nil, nil }
+
+func (p *pointGT) Add(a, b kyber.Point) kyber.Point {
+	r := new(bls.E)
+	bls.NewGT().Mul(r, a.(*pointGT).e, b.(*pointGT).e)
+	p.e = r
+	return p
+}
+
+func (p *pointGT) Sub(a, b kyber.Point) kyber.Point {
+	inv := new(bls.E)
+	bls.NewGT().Inverse(inv, b.(*pointGT).e)
+	r := new(bls.E)
+	bls.NewGT().Mul(r, a.(*pointGT).e, inv)
+	p.e = r
+	return p
+}
+
+func (p *pointGT) Neg(a kyber.Point) kyber.Point {
+	r := new(bls.E)
+	bls.NewGT().Inverse(r, a.(*pointGT).e)
+	p.e = r
+	return p
+}
+
+func (p *pointGT) Mul(s kyber.Scalar, q kyber.Point) kyber.Point {
+	base := gtBase
+	if q != nil {
+		base = q.(*pointGT).e
+	}
+	r := new(bls.E)
+	bls.NewGT().Exp(r, base, scalarToBig(s))
+	p.e = r
+	return p
+}
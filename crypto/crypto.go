@@ -1,12 +1,21 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 
 	"github.com/nmohnblatt/contact_discovery2/crypto/dedishash"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/share"
+	"golang.org/x/crypto/hkdf"
 )
 
 // ConstrainingKeys holds the left and right constaining keys. Both are Kyber points
@@ -31,48 +40,177 @@ type SharedKeys struct {
 	Incoming kyber.Point
 }
 
-// DerivePublicKeys takes an identifier as input and returns the corresponding public keys
-func DerivePublicKeys(suite pairing.Suite, identifier string) PublicKeys {
+// IdentifierDST is the domain separation tag used when hashing discovery identifiers to points of bn256
+var IdentifierDST = []byte("CONTACT-DISCOVERY2-V01-CS01-with-BN256_XMD:SHA-256_SVDW_RO_")
+
+// identifierDSTs holds the domain separation tags of the other suites, by suite name. As RFC 9380 requires,
+// each names the hash to curve suite used
+var identifierDSTs = map[string][]byte{
+	"bls12381": []byte("CONTACT-DISCOVERY2-V01-CS01-with-BLS12381_XMD:SHA-256_SSWU_RO_"),
+}
+
+// identifierDST returns the domain separation tag for hashing identifiers with suite
+func identifierDST(suite pairing.Suite) []byte {
+	if dst, found := identifierDSTs[fmt.Sprint(suite)]; found {
+		return dst
+	}
+	return IdentifierDST
+}
+
+// EpochIdentifier returns the message hashed to derive the public keys of identifier during epoch: the
+// epoch as 8 big endian bytes followed by the identifier. Keys, and so meeting points, change every epoch
+func EpochIdentifier(epoch uint64, identifier string) []byte {
+	msg := make([]byte, 8, 8+len(identifier))
+	binary.BigEndian.PutUint64(msg, epoch)
+	return append(msg, identifier...)
+}
+
+// DerivePublicKeys takes an epoch and an identifier as input and returns the corresponding public keys
+func DerivePublicKeys(suite pairing.Suite, epoch uint64, identifier string) PublicKeys {
 	var keys PublicKeys
 
-	keys.Left, _ = dedishash.Hash(suite, suite.G1(), []byte(identifier))
-	keys.Right, _ = dedishash.Hash(suite, suite.G2(), []byte(identifier))
+	msg, dst := EpochIdentifier(epoch, identifier), identifierDST(suite)
+	keys.Left, _ = dedishash.Hash(suite, suite.G1(), msg, dst)
+	keys.Right, _ = dedishash.Hash(suite, suite.G2(), msg, dst)
 
 	return keys
 }
 
-// DeriveSharedKeys returns shared keys between users A and B:
+// DeriveSharedKeys returns shared keys between users A and B for an epoch:
 // shared12 = e(H1(idA)^s, H2(idB)) = e(H1(idA), H2(idB))^s
 // shared21 = e(H1(idB), H2(idA)^s) = e(H1(idB), H2(idA))^s
-func DeriveSharedKeys(suite pairing.Suite, aliceKeys ConstrainingKeys, contactIdentifier string) (kyber.Point, kyber.Point) {
-	bobPk := DerivePublicKeys(suite, contactIdentifier)
+func DeriveSharedKeys(suite pairing.Suite, epoch uint64, aliceKeys ConstrainingKeys, contactIdentifier string) (kyber.Point, kyber.Point) {
+	bobPk := DerivePublicKeys(suite, epoch, contactIdentifier)
 	sharedA1B2 := suite.Pair(aliceKeys.Left, bobPk.Right)
 	sharedB1A2 := suite.Pair(bobPk.Left, aliceKeys.Right)
 
 	return sharedA1B2, sharedB1A2
 }
 
-// xorBytes is a bytewise XOR operation for same-sized slices of bytes
-func xorBytes(a, b []byte) ([]byte, error) {
-	var c []byte
-	if len(a) != len(b) {
-		return nil, errors.New("xorBytes: arguments must be of the same length")
+// ProtocolVersion is bound into every key derived by KeyDerivationFunction
+const ProtocolVersion = 1
+
+// DerivedKeyLength is the length in bytes of each output of KeyDerivationFunction
+const DerivedKeyLength = 32
+
+// Domain separation labels for the outputs of KeyDerivationFunction
+const (
+	kdfSalt            = "contact_discovery2 key derivation"
+	labelMeetingTag    = "meeting point tag"
+	labelEncryptionKey = "encryption key"
+	labelMACKey        = "mac key"
+)
+
+// DerivedKeys holds the key material two contacts derive from their shared keys
+type DerivedKeys struct {
+	MeetingTag    []byte
+	EncryptionKey []byte
+	MACKey        []byte
+}
+
+// appendLengthPrefixed appends a 2-byte big endian length followed by b
+func appendLengthPrefixed(dst, b []byte) []byte {
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(len(b)))
+	dst = append(dst, length[:]...)
+	return append(dst, b...)
+}
+
+// sortPair returns a and b in lexicographic order
+func sortPair(a, b []byte) ([]byte, []byte) {
+	if bytes.Compare(a, b) > 0 {
+		return b, a
 	}
+	return a, b
+}
 
-	for i := 0; i < len(a); i++ {
-		buf := (int(a[i]) + int(b[i])) % 256
-		c = append(c, byte(buf))
+// KeyDerivationFunction takes the shared points computed by a user with one of their contacts and returns
+// key material derived with HKDF-SHA256. The info string binds a label, the protocol version and both
+// identifiers. Points and identifiers are sorted first, so Alice and Bob derive the same keys.
+func KeyDerivationFunction(sharedAB, sharedBA kyber.Point, identifierA, identifierB string) (DerivedKeys, error) {
+	bytesSharedAB, err := sharedAB.MarshalBinary()
+	if err != nil {
+		return DerivedKeys{}, err
+	}
+	bytesSharedBA, err := sharedBA.MarshalBinary()
+	if err != nil {
+		return DerivedKeys{}, err
 	}
 
-	return c, nil
+	first, second := sortPair(bytesSharedAB, bytesSharedBA)
+	secret := appendLengthPrefixed(appendLengthPrefixed(nil, first), second)
+	prk := hkdf.Extract(sha256.New, secret, []byte(kdfSalt))
+
+	id1, id2 := sortPair([]byte(identifierA), []byte(identifierB))
+	expand := func(label string) ([]byte, error) {
+		info := appendLengthPrefixed(nil, []byte(label))
+		info = append(info, byte(ProtocolVersion>>8), byte(ProtocolVersion))
+		info = appendLengthPrefixed(appendLengthPrefixed(info, id1), id2)
+
+		out := make([]byte, DerivedKeyLength)
+		if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, info), out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	var keys DerivedKeys
+	if keys.MeetingTag, err = expand(labelMeetingTag); err != nil {
+		return DerivedKeys{}, err
+	}
+	if keys.EncryptionKey, err = expand(labelEncryptionKey); err != nil {
+		return DerivedKeys{}, err
+	}
+	if keys.MACKey, err = expand(labelMACKey); err != nil {
+		return DerivedKeys{}, err
+	}
+
+	return keys, nil
+}
+
+// meetingAdditionalData binds a sealed meeting payload to its meeting point and to the direction of the message
+func meetingAdditionalData(keys DerivedKeys, sender, recipient string) []byte {
+	ad := appendLengthPrefixed(nil, []byte("meeting point payload"))
+	ad = append(ad, byte(ProtocolVersion>>8), byte(ProtocolVersion))
+	ad = appendLengthPrefixed(ad, keys.MeetingTag)
+	return appendLengthPrefixed(appendLengthPrefixed(ad, []byte(sender)), []byte(recipient))
+}
+
+func newMeetingAEAD(keys DerivedKeys) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(keys.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
 }
 
-// KeyDerivationFunction takes the shared points computed by a user and returns some key material.
-// We would normally want a secure KDF however for this POC we just XOR the key material we obtained
-func KeyDerivationFunction(sharedAB, sharedBA kyber.Point) ([]byte, error) {
-	bytesSharedAB, _ := sharedAB.MarshalBinary()
-	bytesSharedBA, _ := sharedBA.MarshalBinary()
+// SealMeetingPayload encrypts and authenticates a payload left by sender for recipient at their meeting point.
+// The output is the random nonce followed by the AES-GCM ciphertext
+func SealMeetingPayload(keys DerivedKeys, sender, recipient string, payload []byte) ([]byte, error) {
+	aead, err := newMeetingAEAD(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, payload, meetingAdditionalData(keys, sender, recipient)), nil
+}
+
+// OpenMeetingPayload decrypts a payload left by sender for recipient. Successful decryption proves that
+// the sender holds the same derived keys as the recipient
+func OpenMeetingPayload(keys DerivedKeys, sender, recipient string, sealed []byte) ([]byte, error) {
+	aead, err := newMeetingAEAD(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("meeting: sealed payload is too short")
+	}
 
-	keymaterial, err := xorBytes(bytesSharedAB, bytesSharedBA)
-	return keymaterial, err
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, meetingAdditionalData(keys, sender, recipient))
 }
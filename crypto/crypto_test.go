@@ -0,0 +1,122 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto/bls12381"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+// testSuites lists the pairings every test runs against
+var testSuites = []struct {
+	name  string
+	suite pairing.Suite
+}{
+	{"bn256", bn256.NewSuite()},
+	{"bls12381", bls12381.NewSuite()},
+}
+
+// forEachSuite runs test once per pairing of testSuites
+func forEachSuite(t *testing.T, test func(*testing.T, pairing.Suite)) {
+	for _, s := range testSuites {
+		suite := s.suite
+		t.Run(s.name, func(t *testing.T) { test(t, suite) })
+	}
+}
+
+func TestKeyDerivationFunctionSymmetric(t *testing.T) {
+	forEachSuite(t, testKeyDerivationFunctionSymmetric)
+}
+
+func testKeyDerivationFunctionSymmetric(t *testing.T, suite pairing.Suite) {
+	sharedAB := suite.GT().Point().Pick(random.New())
+	sharedBA := suite.GT().Point().Pick(random.New())
+
+	alice, err := KeyDerivationFunction(sharedAB, sharedBA, "alice", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := KeyDerivationFunction(sharedBA, sharedAB, "bob", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(alice.MeetingTag, bob.MeetingTag) || !bytes.Equal(alice.EncryptionKey, bob.EncryptionKey) || !bytes.Equal(alice.MACKey, bob.MACKey) {
+		t.Errorf("Alice and Bob derived different keys")
+	}
+	if len(alice.MeetingTag) != DerivedKeyLength || len(alice.EncryptionKey) != DerivedKeyLength || len(alice.MACKey) != DerivedKeyLength {
+		t.Errorf("Derived keys have the wrong length")
+	}
+	if bytes.Equal(alice.MeetingTag, alice.EncryptionKey) || bytes.Equal(alice.EncryptionKey, alice.MACKey) || bytes.Equal(alice.MeetingTag, alice.MACKey) {
+		t.Errorf("Outputs are not domain separated")
+	}
+}
+
+func TestKeyDerivationFunctionBindsIdentifiers(t *testing.T) {
+	forEachSuite(t, testKeyDerivationFunctionBindsIdentifiers)
+}
+
+func testKeyDerivationFunctionBindsIdentifiers(t *testing.T, suite pairing.Suite) {
+	sharedAB := suite.GT().Point().Pick(random.New())
+	sharedBA := suite.GT().Point().Pick(random.New())
+
+	alice, err := KeyDerivationFunction(sharedAB, sharedBA, "alice", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eve, err := KeyDerivationFunction(sharedAB, sharedBA, "alice", "eve")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(alice.MeetingTag, eve.MeetingTag) {
+		t.Errorf("Identifiers are not bound into the derived keys")
+	}
+}
+
+func TestMeetingPayloadDirection(t *testing.T) { forEachSuite(t, testMeetingPayloadDirection) }
+
+func testMeetingPayloadDirection(t *testing.T, suite pairing.Suite) {
+	keys, err := KeyDerivationFunction(suite.GT().Point().Pick(random.New()), suite.GT().Point().Pick(random.New()), "alice", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := SealMeetingPayload(keys, "alice", "bob", []byte("card"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := OpenMeetingPayload(keys, "alice", "bob", sealed)
+	if err != nil || !bytes.Equal(payload, []byte("card")) {
+		t.Errorf("Could not open the payload")
+	}
+	if _, err := OpenMeetingPayload(keys, "bob", "alice", sealed); err == nil {
+		t.Errorf("Payload opened in the wrong direction")
+	}
+}
+
+func TestPublicKeysChangeEveryEpoch(t *testing.T) { forEachSuite(t, testPublicKeysChangeEveryEpoch) }
+
+func testPublicKeysChangeEveryEpoch(t *testing.T, suite pairing.Suite) {
+	first := DerivePublicKeys(suite, 1, "alice")
+	if !first.Left.Equal(DerivePublicKeys(suite, 1, "alice").Left) {
+		t.Errorf("Public keys are not deterministic")
+	}
+	second := DerivePublicKeys(suite, 2, "alice")
+	if first.Left.Equal(second.Left) || first.Right.Equal(second.Right) {
+		t.Errorf("Public keys did not change with the epoch")
+	}
+}
+
+func BenchmarkDeriveSharedKeys(b *testing.B) {
+	suite := bn256.NewSuite()
+	keys := randomConstrainingKeys(suite)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		DeriveSharedKeys(suite, 0, keys, "bob")
+	}
+}
@@ -0,0 +1,52 @@
+package dedishash
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+// expandMessageXMD implements expand_message_xmd with SHA-256 as specified in
+// https://www.rfc-editor.org/rfc/rfc9380#section-5.3.1
+func expandMessageXMD(msg, dst []byte, lenInBytes int) ([]byte, error) {
+	const bInBytes = sha256.Size
+	const sInBytes = sha256.BlockSize
+
+	ell := (lenInBytes + bInBytes - 1) / bInBytes
+	if ell > 255 || lenInBytes > 65535 {
+		return nil, errors.New("expand: requested output is too long")
+	}
+	if len(dst) > 255 {
+		return nil, errors.New("expand: domain separation tag is too long")
+	}
+	dstPrime := append(append([]byte{}, dst...), byte(len(dst)))
+
+	h := sha256.New()
+	h.Write(make([]byte, sInBytes))
+	h.Write(msg)
+	h.Write([]byte{byte(lenInBytes >> 8), byte(lenInBytes), 0})
+	h.Write(dstPrime)
+	b0 := h.Sum(nil)
+
+	h.Reset()
+	h.Write(b0)
+	h.Write([]byte{1})
+	h.Write(dstPrime)
+	bi := h.Sum(nil)
+
+	uniform := append(make([]byte, 0, ell*bInBytes), bi...)
+	for i := 2; i <= ell; i++ {
+		xored := make([]byte, bInBytes)
+		for j := range xored {
+			xored[j] = b0[j] ^ bi[j]
+		}
+
+		h.Reset()
+		h.Write(xored)
+		h.Write([]byte{byte(i)})
+		h.Write(dstPrime)
+		bi = h.Sum(nil)
+		uniform = append(uniform, bi...)
+	}
+
+	return uniform[:lenInBytes], nil
+}
@@ -0,0 +1,186 @@
+package dedishash
+
+import (
+	"math/big"
+)
+
+// element is an element of the prime field (one coordinate) or of its quadratic extension
+// GF(p²) = GF(p)[i]/(i²+1) (two coordinates, the value is c[0] + c[1]*i)
+type element []*big.Int
+
+// field holds the arithmetic needed by the map to curve
+type field interface {
+	fromInt(int64) element
+	zero() element
+	one() element
+	add(a, b element) element
+	sub(a, b element) element
+	mul(a, b element) element
+	neg(a element) element
+	inv0(a element) element
+	equal(a, b element) bool
+	isZero(a element) bool
+	isSquare(a element) bool
+	sqrt(a element) element
+	sgn0(a element) int
+	fromBytes(b []byte) element
+	degree() int
+}
+
+// fp is the prime field GF(p)
+type fp struct {
+	p *big.Int
+}
+
+func (f fp) reduce(a *big.Int) *big.Int { return a.Mod(a, f.p) }
+func (f fp) degree() int                { return 1 }
+func (f fp) zero() element              { return element{new(big.Int)} }
+func (f fp) one() element               { return element{big.NewInt(1)} }
+
+func (f fp) fromInt(i int64) element { return element{f.reduce(big.NewInt(i))} }
+
+func (f fp) fromBytes(b []byte) element { return element{f.reduce(new(big.Int).SetBytes(b))} }
+
+func (f fp) add(a, b element) element {
+	return element{f.reduce(new(big.Int).Add(a[0], b[0]))}
+}
+
+func (f fp) sub(a, b element) element {
+	return element{f.reduce(new(big.Int).Sub(a[0], b[0]))}
+}
+
+func (f fp) mul(a, b element) element {
+	return element{f.reduce(new(big.Int).Mul(a[0], b[0]))}
+}
+
+func (f fp) neg(a element) element {
+	return element{f.reduce(new(big.Int).Neg(a[0]))}
+}
+
+// inv0 returns the inverse of a, or 0 if a is 0
+func (f fp) inv0(a element) element {
+	if a[0].Sign() == 0 {
+		return f.zero()
+	}
+	return element{new(big.Int).ModInverse(a[0], f.p)}
+}
+
+func (f fp) equal(a, b element) bool { return a[0].Cmp(b[0]) == 0 }
+func (f fp) isZero(a element) bool   { return a[0].Sign() == 0 }
+
+func (f fp) isSquare(a element) bool {
+	return a[0].Sign() == 0 || big.Jacobi(a[0], f.p) == 1
+}
+
+// sqrt returns a square root of a, or nil if a is not a square
+func (f fp) sqrt(a element) element {
+	r := new(big.Int).ModSqrt(a[0], f.p)
+	if r == nil {
+		return nil
+	}
+	return element{r}
+}
+
+func (f fp) sgn0(a element) int { return int(a[0].Bit(0)) }
+
+// fp2 is the quadratic extension GF(p²) with i² = -1, which requires p = 3 mod 4
+type fp2 struct {
+	base fp
+}
+
+func (f fp2) degree() int   { return 2 }
+func (f fp2) zero() element { return element{new(big.Int), new(big.Int)} }
+func (f fp2) one() element  { return element{big.NewInt(1), new(big.Int)} }
+func (f fp2) lift(a *big.Int) element {
+	return element{a, new(big.Int)}
+}
+
+func (f fp2) fromInt(i int64) element { return f.lift(f.base.fromInt(i)[0]) }
+
+func (f fp2) fromBytes(b []byte) element {
+	half := len(b) / 2
+	return element{f.base.fromBytes(b[:half])[0], f.base.fromBytes(b[half:])[0]}
+}
+
+func (f fp2) add(a, b element) element {
+	return element{f.base.add(a[:1], b[:1])[0], f.base.add(a[1:], b[1:])[0]}
+}
+
+func (f fp2) sub(a, b element) element {
+	return element{f.base.sub(a[:1], b[:1])[0], f.base.sub(a[1:], b[1:])[0]}
+}
+
+func (f fp2) neg(a element) element {
+	return element{f.base.neg(a[:1])[0], f.base.neg(a[1:])[0]}
+}
+
+// mul computes (a0 + a1*i)(b0 + b1*i) = (a0*b0 - a1*b1) + (a0*b1 + a1*b0)*i
+func (f fp2) mul(a, b element) element {
+	c0 := new(big.Int).Sub(new(big.Int).Mul(a[0], b[0]), new(big.Int).Mul(a[1], b[1]))
+	c1 := new(big.Int).Add(new(big.Int).Mul(a[0], b[1]), new(big.Int).Mul(a[1], b[0]))
+	return element{f.base.reduce(c0), f.base.reduce(c1)}
+}
+
+// norm returns a0² + a1², the norm of a0 + a1*i over GF(p)
+func (f fp2) norm(a element) element {
+	n := new(big.Int).Add(new(big.Int).Mul(a[0], a[0]), new(big.Int).Mul(a[1], a[1]))
+	return element{f.base.reduce(n)}
+}
+
+func (f fp2) inv0(a element) element {
+	if f.isZero(a) {
+		return f.zero()
+	}
+	n := f.base.inv0(f.norm(a))
+	return element{f.base.mul(a[:1], n)[0], f.base.mul(f.base.neg(a[1:]), n)[0]}
+}
+
+func (f fp2) equal(a, b element) bool { return a[0].Cmp(b[0]) == 0 && a[1].Cmp(b[1]) == 0 }
+func (f fp2) isZero(a element) bool   { return a[0].Sign() == 0 && a[1].Sign() == 0 }
+
+// isSquare uses the fact that a is a square in GF(p²) iff its norm is a square in GF(p)
+func (f fp2) isSquare(a element) bool {
+	return f.base.isSquare(f.norm(a))
+}
+
+// sqrt returns a square root of a, or nil if a is not a square
+func (f fp2) sqrt(a element) element {
+	if a[1].Sign() == 0 {
+		if r := f.base.sqrt(a[:1]); r != nil {
+			return f.lift(r[0])
+		}
+		// a0 is not a square in GF(p) so -a0 is, and sqrt(a0) = sqrt(-a0)*i
+		r := f.base.sqrt(f.base.neg(a[:1]))
+		return element{new(big.Int), r[0]}
+	}
+
+	alpha := f.base.sqrt(f.norm(a))
+	if alpha == nil {
+		return nil
+	}
+	half := f.base.inv0(f.base.fromInt(2))
+	delta := f.base.mul(f.base.add(a[:1], alpha), half)
+	if !f.base.isSquare(delta) {
+		delta = f.base.mul(f.base.sub(a[:1], alpha), half)
+	}
+	x0 := f.base.sqrt(delta)
+	if x0 == nil || f.base.isZero(x0) {
+		return nil
+	}
+	x1 := f.base.mul(a[1:], f.base.inv0(f.base.add(x0, x0)))
+
+	r := element{x0[0], x1[0]}
+	if !f.equal(f.mul(r, r), a) {
+		return nil
+	}
+	return r
+}
+
+func (f fp2) sgn0(a element) int {
+	sign0 := a[0].Bit(0)
+	zero0 := uint(0)
+	if a[0].Sign() == 0 {
+		zero0 = 1
+	}
+	return int(sign0 | (zero0 & a[1].Bit(0)))
+}
@@ -1,45 +1,143 @@
+// Package dedishash hashes messages to points of the bn256 groups of the kyber library.
+// It follows the hash_to_curve random oracle construction of RFC 9380
+// (https://www.rfc-editor.org/rfc/rfc9380) with the Shallue-van de Woestijne map.
+//
+// Note that kyber's bn256 is not the BN254 curve for which the RFC publishes a suite,
+// so there are no published test vectors for the points themselves.
+//
+// Groups that implement PointHasher, such as those of the bls12381 package, hash with their own method.
 package dedishash
 
 import (
 	"errors"
-	"log"
+	"math/big"
+	"sync"
 
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
-	"go.dedis.ch/kyber/v3/xof/blake2xb"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
 )
 
-type hashablePoint interface {
-	Hash([]byte) kyber.Point
-}
+// bn256P is the prime over which kyber's bn256 curve is defined
+var bn256P, _ = new(big.Int).SetString("65000549695646603732796438742359905742825358107623003571877145026864184071783", 10)
 
-// hashtoG1 securely hashes a message into a point on G1
-func hashtoG1(suite pairing.Suite, msg []byte) kyber.Point {
-	hashable, ok := suite.G1().Point().(hashablePoint)
-	if !ok {
-		log.Printf("Point cannot be hashed")
-	}
-	hashed := hashable.Hash(msg)
-	return hashed
+// curve holds what is needed to hash to one of the groups
+type curve struct {
+	m *svdwMap
+	// encode returns the kyber encoding of the affine point (x, y)
+	encode func(x, y element) []byte
+	// cofactor is nil when it is 1
+	cofactor *big.Int
 }
 
-// insecureHashtoG2 hashes a message to a point in G2 by using the message as a seed for the Pick method
-// !!! Unsure whether this is collision resistant !!!
-// To be replaced by a secure version that follows https://tools.ietf.org/html/draft-irtf-cfrg-hash-to-curve-07
-func insecureHashtoG2(suite pairing.Suite, msg []byte) kyber.Point {
-	seed := blake2xb.New(msg)
-	hashed := suite.G2().Point().Pick(seed)
+var (
+	curvesOnce sync.Once
+	curveG1    *curve
+	curveG2    *curve
+	curvesErr  error
+)
+
+func initCurves() {
+	base := fp{p: bn256P}
+	mapG1, err := newSVDWMap(base, base.fromInt(3))
+	if err != nil {
+		curvesErr = err
+		return
+	}
+	curveG1 = &curve{
+		m:      mapG1,
+		encode: func(x, y element) []byte { return append(fieldToBytes(x, 0), fieldToBytes(y, 0)...) },
+	}
 
-	return hashed
+	// the twist is y² = x³ + 3/ξ with ξ = i + 3
+	ext := fp2{base: base}
+	twistB := ext.mul(ext.fromInt(3), ext.inv0(element{big.NewInt(3), big.NewInt(1)}))
+	mapG2, err := newSVDWMap(ext, twistB)
+	if err != nil {
+		curvesErr = err
+		return
+	}
+	curveG2 = &curve{
+		m: mapG2,
+		// kyber writes the imaginary part of each coordinate first
+		encode:   func(x, y element) []byte { return append(fieldToBytes(x, 1, 0), fieldToBytes(y, 1, 0)...) },
+		cofactor: cofactorG2(bn256P, bn256.Order),
+	}
 }
 
-// Hash hashes a msg to a point on the requested curve
-func Hash(suite pairing.Suite, group kyber.Group, msg []byte) (kyber.Point, error) {
+func curveFor(group kyber.Group) (*curve, error) {
+	curvesOnce.Do(initCurves)
+	if curvesErr != nil {
+		return nil, curvesErr
+	}
+
 	if group.String() == "bn256.G1" {
-		return hashtoG1(suite, msg), nil
+		return curveG1, nil
 	} else if group.String() == "bn256.G2" {
-		return insecureHashtoG2(suite, msg), nil
-	} else {
-		return nil, errors.New("hash: group not recognised")
+		return curveG2, nil
+	}
+	return nil, errors.New("hash: group not recognised")
+}
+
+// mapToPoint maps a field element to a point of the curve, not necessarily in the prime order subgroup
+func (c *curve) mapToPoint(group kyber.Group, u element) (kyber.Point, error) {
+	x, y := c.m.mapToCurve(u)
+
+	point := group.Point()
+	if err := point.UnmarshalBinary(c.encode(x, y)); err != nil {
+		return nil, err
 	}
+	return point, nil
+}
+
+// mulBig computes k * P for an integer k that may exceed the group order
+func mulBig(group kyber.Group, k *big.Int, P kyber.Point) kyber.Point {
+	acc := group.Point().Null()
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		acc = group.Point().Add(acc, acc)
+		if k.Bit(i) == 1 {
+			acc = group.Point().Add(acc, P)
+		}
+	}
+	return acc
+}
+
+// PointHasher is implemented by groups that provide their own hash to curve
+type PointHasher interface {
+	HashToPoint(msg, dst []byte) (kyber.Point, error)
+}
+
+// Hash hashes a msg to a point on the requested curve. dst is the domain separation tag, which
+// must be unique to the application and to the use of the hash within it
+func Hash(suite pairing.Suite, group kyber.Group, msg, dst []byte) (kyber.Point, error) {
+	if len(dst) == 0 {
+		return nil, errors.New("hash: empty domain separation tag")
+	}
+	if h, ok := group.(PointHasher); ok {
+		return h.HashToPoint(msg, dst)
+	}
+	c, err := curveFor(group)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := hashToField(c.m.f, msg, dst, 2)
+	if err != nil {
+		return nil, err
+	}
+	q0, err := c.mapToPoint(group, u[0])
+	if err != nil {
+		return nil, err
+	}
+	q1, err := c.mapToPoint(group, u[1])
+	if err != nil {
+		return nil, err
+	}
+
+	hashed := group.Point().Add(q0, q1)
+	if c.cofactor != nil {
+		hashed = mulBig(group, c.cofactor, hashed)
+	}
+
+	return hashed, nil
 }
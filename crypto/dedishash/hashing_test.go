@@ -1,18 +1,158 @@
 package dedishash
 
 import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
 	"testing"
 
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing/bn256"
 )
 
-func TestHashToG2(t *testing.T) {
+var testDST = []byte("CONTACT-DISCOVERY2-TEST-V01-CS01-with-BN256_XMD:SHA-256_SVDW_RO_")
+
+// Test vectors from https://www.rfc-editor.org/rfc/rfc9380#appendix-K.1
+func TestExpandMessageXMD(t *testing.T) {
+	dst := []byte("QUUX-V01-CS02-with-expander-SHA256-128")
+	vectors := []struct {
+		msg     string
+		len     int
+		uniform string
+	}{
+		{"", 0x20, "68a985b87eb6b46952128911f2a4412bbc302a9d759667f87f7a21d803f07235"},
+		{"abc", 0x20, "d8ccab23b5985ccea865c6c97b6e5b8350e794e603b4b97902f53a8a0d605615"},
+		{"abcdef0123456789", 0x20, "eff31487c770a893cfb36f912fbfcbff40d5661771ca4b2cb4eafe524333f5c1"},
+		{"q128_" + strings.Repeat("q", 128), 0x20, "b23a1d2b4d97b2ef7785562a7e8bac7eed54ed6e97e29aa51bfe3f12ddad1ff9"},
+		{"a512_" + strings.Repeat("a", 512), 0x20, "4623227bcc01293b8c130bf771da8c298dede7383243dc0993d2d94823958c4c"},
+		{"", 0x80, "af84c27ccfd45d41914fdff5df25293e221afc53d8ad2ac06d5e3e29485dadbee0d121587713a3e0dd4d5e69e93eb7cd4f5df4cd103e188cf60cb02edc3edf18eda8576c412b18ffb658e3dd6ec849469b979d444cf7b26911a08e63cf31f9dcc541708d3491184472c2c29bb749d4286b004ceb5ee6b9a7fa5b646c993f0ced"},
+		{"abc", 0x80, "abba86a6129e366fc877aab32fc4ffc70120d8996c88aee2fe4b32d6c7b6437a647e6c3163d40b76a73cf6a5674ef1d890f95b664ee0afa5359a5c4e07985635bbecbac65d747d3d2da7ec2b8221b17b0ca9dc8a1ac1c07ea6a1e60583e2cb00058e77b7b72a298425cd1b941ad4ec65e8afc50303a22c0f99b0509b4c895f40"},
+		{"abcdef0123456789", 0x80, "ef904a29bffc4cf9ee82832451c946ac3c8f8058ae97d8d629831a74c6572bd9ebd0df635cd1f208e2038e760c4994984ce73f0d55ea9f22af83ba4734569d4bc95e18350f740c07eef653cbb9f87910d833751825f0ebefa1abe5420bb52be14cf489b37fe1a72f7de2d10be453b2c9d9eb20c7e3f6edc5a60629178d9478df"},
+		{"q128_" + strings.Repeat("q", 128), 0x80, "80be107d0884f0d881bb460322f0443d38bd222db8bd0b0a5312a6fedb49c1bbd88fd75d8b9a09486c60123dfa1d73c1cc3169761b17476d3c6b7cbbd727acd0e2c942f4dd96ae3da5de368d26b32286e32de7e5a8cb2949f866a0b80c58116b29fa7fabb3ea7d520ee603e0c25bcaf0b9a5e92ec6a1fe4e0391d1cdbce8c68a"},
+		{"a512_" + strings.Repeat("a", 512), 0x80, "546aff5444b5b79aa6148bd81728704c32decb73a3ba76e9e75885cad9def1d06d6792f8a7d12794e90efed817d96920d728896a4510864370c207f99bd4a608ea121700ef01ed879745ee3e4ceef777eda6d9e5e38b90c86ea6fb0b36504ba4a45d22e86f6db5dd43d98a294bebb9125d5b794e9d2a81181066eb954966a487"},
+	}
+
+	for _, v := range vectors {
+		out, err := expandMessageXMD([]byte(v.msg), dst, v.len)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := hex.DecodeString(v.uniform)
+		if !bytes.Equal(out, want) {
+			t.Errorf("expand_message_xmd(%q, %d) does not match the test vector", v.msg[:min(len(v.msg), 8)], v.len)
+		}
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// inSubgroup checks that n * P is the identity by computing (n-1) * P + P
+func inSubgroup(group kyber.Group, P kyber.Point) bool {
+	nMinusOne := new(big.Int).Sub(bn256.Order, big.NewInt(1))
+	return group.Point().Add(mulBig(group, nMinusOne, P), P).Equal(group.Point().Null())
+}
+
+func TestTwistMatchesKyber(t *testing.T) {
 	suite := bn256.NewSuite()
-	testMsg := "this is a test message"
-	hash1 := insecureHashtoG2(suite, []byte(testMsg))
-	hash2 := insecureHashtoG2(suite, []byte(testMsg))
+	if _, err := curveFor(suite.G2()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the base points of kyber must satisfy our curve equations
+	for _, group := range []kyber.Group{suite.G1(), suite.G2()} {
+		c, _ := curveFor(group)
+		buf, _ := group.Point().Base().MarshalBinary()
+		var x, y element
+		if group == suite.G1() {
+			x, y = c.m.f.fromBytes(buf[:32]), c.m.f.fromBytes(buf[32:])
+		} else {
+			f := fp{p: bn256P}
+			x = element{f.fromBytes(buf[32:64])[0], f.fromBytes(buf[0:32])[0]}
+			y = element{f.fromBytes(buf[96:128])[0], f.fromBytes(buf[64:96])[0]}
+		}
+		if !c.m.f.equal(c.m.f.mul(y, y), c.m.g(x)) {
+			t.Errorf("%s: base point is not on the curve used for hashing", group.String())
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	suite := bn256.NewSuite()
+	testMsg := []byte("this is a test message")
+
+	for _, group := range []kyber.Group{suite.G1(), suite.G2()} {
+		hash1, err := Hash(suite, group, testMsg, testDST)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash2, _ := Hash(suite, group, testMsg, testDST)
+		if !hash1.Equal(hash2) {
+			t.Errorf("%s: hashing the same message yield different points", group.String())
+		}
 
-	if !hash1.Equal(hash2) {
-		t.Errorf("Hashing the same message yield different points")
+		other, _ := Hash(suite, group, []byte("this is another test message"), testDST)
+		if hash1.Equal(other) {
+			t.Errorf("%s: different messages hash to the same point", group.String())
+		}
+
+		separated, _ := Hash(suite, group, testMsg, []byte("ANOTHER-DST"))
+		if hash1.Equal(separated) {
+			t.Errorf("%s: domain separation tag is ignored", group.String())
+		}
+
+		if hash1.Equal(group.Point().Null()) || !inSubgroup(group, hash1) {
+			t.Errorf("%s: hashed point is not in the prime order subgroup", group.String())
+		}
+	}
+
+	if _, err := Hash(suite, suite.G1(), testMsg, nil); err == nil {
+		t.Errorf("Hashing accepted an empty domain separation tag")
+	}
+	if _, err := Hash(suite, suite.GT(), testMsg, testDST); err == nil {
+		t.Errorf("Hashing to GT should not be supported")
+	}
+}
+
+func TestMapToCurveIsOnCurve(t *testing.T) {
+	suite := bn256.NewSuite()
+	for _, group := range []kyber.Group{suite.G1(), suite.G2()} {
+		c, err := curveFor(group)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := int64(0); i < 20; i++ {
+			u := c.m.f.fromInt(i)
+			x, y := c.m.mapToCurve(u)
+			if !c.m.f.equal(c.m.f.mul(y, y), c.m.g(x)) {
+				t.Errorf("%s: map_to_curve(%d) is not on the curve", group.String(), i)
+			}
+			if c.m.f.sgn0(u) != c.m.f.sgn0(y) {
+				t.Errorf("%s: map_to_curve(%d) has the wrong sign", group.String(), i)
+			}
+		}
+	}
+}
+
+func BenchmarkHashG1(b *testing.B) {
+	suite := bn256.NewSuite()
+	for n := 0; n < b.N; n++ {
+		if _, err := Hash(suite, suite.G1(), []byte("alice"), testDST); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHashG2(b *testing.B) {
+	suite := bn256.NewSuite()
+	for n := 0; n < b.N; n++ {
+		if _, err := Hash(suite, suite.G2(), []byte("alice"), testDST); err != nil {
+			b.Fatal(err)
+		}
 	}
 }
@@ -0,0 +1,136 @@
+package dedishash
+
+import (
+	"errors"
+	"math/big"
+)
+
+// svdwMap implements the Shallue-van de Woestijne map to a curve y² = x³ + B as specified in
+// https://www.rfc-editor.org/rfc/rfc9380#section-6.6.1 (the curves used here have A = 0)
+type svdwMap struct {
+	f              field
+	b              element
+	z              element
+	c1, c2, c3, c4 element
+}
+
+// g evaluates the curve equation x³ + B
+func (m *svdwMap) g(x element) element {
+	return m.f.add(m.f.mul(m.f.mul(x, x), x), m.b)
+}
+
+// newSVDWMap computes the constants of the map, Z is found as in the RFC's find_z_svdw
+func newSVDWMap(f field, b element) (*svdwMap, error) {
+	m := &svdwMap{f: f, b: b}
+	three, four := f.fromInt(3), f.fromInt(4)
+	half := f.inv0(f.fromInt(2))
+
+	for ctr := int64(1); ctr < 1000 && m.z == nil; ctr++ {
+		for _, z := range []element{f.fromInt(ctr), f.fromInt(-ctr)} {
+			gz := m.g(z)
+			if f.isZero(gz) {
+				continue
+			}
+			threeZ2 := f.mul(three, f.mul(z, z))
+			h := f.neg(f.mul(threeZ2, f.inv0(f.mul(four, gz))))
+			if f.isZero(h) || !f.isSquare(h) {
+				continue
+			}
+			if !f.isSquare(gz) && !f.isSquare(m.g(f.neg(f.mul(z, half)))) {
+				continue
+			}
+			m.z = z
+			break
+		}
+	}
+	if m.z == nil {
+		return nil, errors.New("svdw: no suitable Z found")
+	}
+
+	gz := m.g(m.z)
+	threeZ2 := f.mul(three, f.mul(m.z, m.z))
+	m.c1 = gz
+	m.c2 = f.neg(f.mul(m.z, half))
+	m.c3 = f.sqrt(f.neg(f.mul(gz, threeZ2)))
+	if m.c3 == nil {
+		return nil, errors.New("svdw: constant c3 is not defined")
+	}
+	if f.sgn0(m.c3) == 1 {
+		m.c3 = f.neg(m.c3)
+	}
+	m.c4 = f.neg(f.mul(f.mul(four, gz), f.inv0(threeZ2)))
+
+	return m, nil
+}
+
+// mapToCurve maps a field element to a point (x, y) of the curve
+func (m *svdwMap) mapToCurve(u element) (element, element) {
+	f := m.f
+
+	tv1 := f.mul(f.mul(u, u), m.c1)
+	tv2 := f.add(f.one(), tv1)
+	tv1 = f.sub(f.one(), tv1)
+	tv3 := f.inv0(f.mul(tv1, tv2))
+	tv4 := f.mul(f.mul(f.mul(u, tv1), tv3), m.c3)
+
+	x1 := f.sub(m.c2, tv4)
+	e1 := f.isSquare(m.g(x1))
+	x2 := f.add(m.c2, tv4)
+	e2 := f.isSquare(m.g(x2)) && !e1
+
+	x3 := f.mul(tv2, tv2)
+	x3 = f.mul(x3, tv3)
+	x3 = f.mul(x3, x3)
+	x3 = f.add(f.mul(x3, m.c4), m.z)
+
+	x := x3
+	if e1 {
+		x = x1
+	} else if e2 {
+		x = x2
+	}
+
+	y := f.sqrt(m.g(x))
+	if f.sgn0(u) != f.sgn0(y) {
+		y = f.neg(y)
+	}
+
+	return x, y
+}
+
+// hashToField implements hash_to_field from https://www.rfc-editor.org/rfc/rfc9380#section-5.2
+// with expand_message_xmd and L = 48 bytes per coordinate (128 bits of security over a 256 bits prime)
+func hashToField(f field, msg, dst []byte, count int) ([]element, error) {
+	const l = 48
+	m := f.degree()
+
+	uniform, err := expandMessageXMD(msg, dst, count*m*l)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]element, count)
+	for i := range out {
+		out[i] = f.fromBytes(uniform[i*m*l : (i+1)*m*l])
+	}
+
+	return out, nil
+}
+
+// fieldToBytes writes each coordinate of e as a 32 bytes big endian integer, in the given order
+func fieldToBytes(e element, order ...int) []byte {
+	out := make([]byte, 0, 32*len(order))
+	for _, i := range order {
+		buf := make([]byte, 32)
+		b := e[i].Bytes()
+		copy(buf[32-len(b):], b)
+		out = append(out, buf...)
+	}
+	return out
+}
+
+// cofactorG2 returns the cofactor 2p - n of the group of points of the sextic twist of a BN curve
+func cofactorG2(p, n *big.Int) *big.Int {
+	h := new(big.Int).Lsh(p, 1)
+	return h.Sub(h, n)
+}
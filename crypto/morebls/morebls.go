@@ -1,7 +1,5 @@
 // Package morebls mirrors the kyber/bls package.
 // Here, signatures are points on G2 and public keys are points on G1.
-//
-// WARNING: relies on an insecure hash-to-G2 function !
 package morebls
 
 import (
@@ -13,6 +11,9 @@ import (
 	"go.dedis.ch/kyber/v3/pairing"
 )
 
+// DST is the domain separation tag used to hash messages to G2
+var DST = []byte("BLS_SIG_BN256G2_XMD:SHA-256_SVDW_RO_NUL_")
+
 // NewKeyPair2 creates a new BLS signing key pair. The private key x is a scalar
 // and the public key X is a point on curve G1.
 func NewKeyPair2(suite pairing.Suite, random cipher.Stream) (kyber.Scalar, kyber.Point) {
@@ -24,7 +25,7 @@ func NewKeyPair2(suite pairing.Suite, random cipher.Stream) (kyber.Scalar, kyber
 // Sign2 creates a BLS signature S = x * H(m) on a message m using the private
 // key x. The signature S is a point on curve G2.
 func Sign2(suite pairing.Suite, x kyber.Scalar, msg []byte) ([]byte, error) {
-	HM, _ := dedishash.Hash(suite, suite.G2(), msg)
+	HM, _ := dedishash.Hash(suite, suite.G2(), msg, DST)
 	xHM := HM.Mul(x, HM)
 
 	s, err := xHM.MarshalBinary()
@@ -39,7 +40,7 @@ func Sign2(suite pairing.Suite, x kyber.Scalar, msg []byte) ([]byte, error) {
 // e(B1, x*H(m)) == e(B1, S) holds where e is the pairing operation and B1 is
 // the base point from curve G1.
 func Verify2(suite pairing.Suite, X kyber.Point, msg, sig []byte) error {
-	HM, _ := dedishash.Hash(suite, suite.G2(), msg)
+	HM, _ := dedishash.Hash(suite, suite.G2(), msg, DST)
 	left := suite.Pair(X, HM)
 	s := suite.G2().Point()
 	if err := s.UnmarshalBinary(sig); err != nil {
@@ -3,13 +3,33 @@ package morebls
 import (
 	"testing"
 
+	"github.com/nmohnblatt/contact_discovery2/crypto/bls12381"
+	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/pairing/bn256"
 	"go.dedis.ch/kyber/v3/util/random"
 )
 
-func TestBLS(t *testing.T) {
+// testSuites lists the pairings every test runs against
+var testSuites = []struct {
+	name  string
+	suite pairing.Suite
+}{
+	{"bn256", bn256.NewSuite()},
+	{"bls12381", bls12381.NewSuite()},
+}
+
+// forEachSuite runs test once per pairing of testSuites
+func forEachSuite(t *testing.T, test func(*testing.T, pairing.Suite)) {
+	for _, s := range testSuites {
+		suite := s.suite
+		t.Run(s.name, func(t *testing.T) { test(t, suite) })
+	}
+}
+
+func TestBLS(t *testing.T) { forEachSuite(t, testBLS) }
+
+func testBLS(t *testing.T, suite pairing.Suite) {
 	msg := []byte("Hello Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
 	private, public := NewKeyPair2(suite, random.New())
 	sig, err := Sign2(suite, private, msg)
 	if err != nil {
@@ -21,9 +41,10 @@ func TestBLS(t *testing.T) {
 	}
 }
 
-func TestBLSFailSig(t *testing.T) {
+func TestBLSFailSig(t *testing.T) { forEachSuite(t, testBLSFailSig) }
+
+func testBLSFailSig(t *testing.T, suite pairing.Suite) {
 	msg := []byte("Hello Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
 	private, public := NewKeyPair2(suite, random.New())
 	sig, err := Sign2(suite, private, msg)
 	if err != nil {
@@ -35,9 +56,10 @@ func TestBLSFailSig(t *testing.T) {
 	}
 }
 
-func TestBLSFailKey(t *testing.T) {
+func TestBLSFailKey(t *testing.T) { forEachSuite(t, testBLSFailKey) }
+
+func testBLSFailKey(t *testing.T, suite pairing.Suite) {
 	msg := []byte("Hello Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
 	private, _ := NewKeyPair2(suite, random.New())
 	sig, err := Sign2(suite, private, msg)
 	if err != nil {
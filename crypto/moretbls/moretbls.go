@@ -1,8 +1,6 @@
 // Package moretbls mirrors the tbls package from the kyber library.
 // It implements a (t,n)-threshold BLS signature scheme.
 // Here, signatures are points on G2 and public keys are points on G1
-//
-// WARNING: relies on morebls package, which makes use of an insecure hash-to-G2 function
 package moretbls
 
 import (
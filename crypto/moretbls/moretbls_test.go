@@ -3,15 +3,35 @@ package moretbls
 import (
 	"testing"
 
+	"github.com/nmohnblatt/contact_discovery2/crypto/bls12381"
 	"github.com/nmohnblatt/contact_discovery2/crypto/morebls"
+	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/pairing/bn256"
 	"go.dedis.ch/kyber/v3/share"
 )
 
-func TestTBLS(test *testing.T) {
+// testSuites lists the pairings every test runs against
+var testSuites = []struct {
+	name  string
+	suite pairing.Suite
+}{
+	{"bn256", bn256.NewSuite()},
+	{"bls12381", bls12381.NewSuite()},
+}
+
+// forEachSuite runs test once per pairing of testSuites
+func forEachSuite(t *testing.T, test func(*testing.T, pairing.Suite)) {
+	for _, s := range testSuites {
+		suite := s.suite
+		t.Run(s.name, func(t *testing.T) { test(t, suite) })
+	}
+}
+
+func TestTBLS(t *testing.T) { forEachSuite(t, testTBLS) }
+
+func testTBLS(test *testing.T, suite pairing.Suite) {
 	var err error
 	msg := []byte("Hello threshold Boneh-Lynn-Shacham")
-	suite := bn256.NewSuite()
 	n := 10
 	t := n/2 + 1
 	secret := suite.G1().Scalar().Pick(suite.RandomStream())
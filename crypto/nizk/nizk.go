@@ -0,0 +1,218 @@
+// Package nizk implements non-interactive zero-knowledge proofs (sigma protocols made
+// non-interactive with the Fiat-Shamir transform) over the groups of a pairing suite
+package nizk
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/random"
+	"go.dedis.ch/kyber/v3/xof/blake2xb"
+)
+
+// challenge derives the Fiat-Shamir challenge from a label, a context and the points of the transcript
+func challenge(group kyber.Group, label string, context []byte, points ...kyber.Point) (kyber.Scalar, error) {
+	h := sha256.New()
+	h.Write([]byte(label))
+	h.Write(context)
+	for _, p := range points {
+		buf, err := p.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		h.Write(buf)
+	}
+
+	return group.Scalar().Pick(blake2xb.New(h.Sum(nil))), nil
+}
+
+// ProveDLog proves knowledge of x such that X = x * B (Schnorr proof) where B and X are points of group.
+// The context is bound into the proof so that it cannot be replayed elsewhere
+func ProveDLog(group kyber.Group, B kyber.Point, x kyber.Scalar, X kyber.Point, context []byte) ([]byte, error) {
+	k := group.Scalar().Pick(random.New())
+	T := group.Point().Mul(k, B)
+
+	c, err := challenge(group, "dlog", context, B, X, T)
+	if err != nil {
+		return nil, err
+	}
+	z := group.Scalar().Add(k, group.Scalar().Mul(c, x))
+
+	proof, err := T.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	zBytes, err := z.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(proof, zBytes...), nil
+}
+
+// VerifyDLog checks a proof output by ProveDLog: z * B == T + c * X
+func VerifyDLog(group kyber.Group, B, X kyber.Point, proof, context []byte) error {
+	if len(proof) != group.PointLen()+group.ScalarLen() {
+		return errors.New("nizk: malformed proof")
+	}
+	T := group.Point()
+	if err := T.UnmarshalBinary(proof[:group.PointLen()]); err != nil {
+		return err
+	}
+	z := group.Scalar()
+	if err := z.UnmarshalBinary(proof[group.PointLen():]); err != nil {
+		return err
+	}
+
+	c, err := challenge(group, "dlog", context, B, X, T)
+	if err != nil {
+		return err
+	}
+
+	left := group.Point().Mul(z, B)
+	right := group.Point().Add(T, group.Point().Mul(c, X))
+	if !left.Equal(right) {
+		return errors.New("nizk: invalid proof")
+	}
+
+	return nil
+}
+
+// ProveDLEQ proves knowledge of x such that X1 = x * B1 and X2 = x * B2 (Chaum-Pedersen proof).
+// B1 is a point of g1 and B2 a point of g2: the groups may differ as long as they share the same
+// scalar field, as G1 and G2 of a pairing do
+func ProveDLEQ(g1, g2 kyber.Group, B1, B2 kyber.Point, x kyber.Scalar, X1, X2 kyber.Point, context []byte) ([]byte, error) {
+	k := g1.Scalar().Pick(random.New())
+	T1 := g1.Point().Mul(k, B1)
+	T2 := g2.Point().Mul(k, B2)
+
+	c, err := challenge(g1, "dleq", context, B1, B2, X1, X2, T1, T2)
+	if err != nil {
+		return nil, err
+	}
+	z := g1.Scalar().Add(k, g1.Scalar().Mul(c, x))
+
+	proof := make([]byte, 0, g1.PointLen()+g2.PointLen()+g1.ScalarLen())
+	for _, m := range []interface{ MarshalBinary() ([]byte, error) }{T1, T2, z} {
+		buf, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		proof = append(proof, buf...)
+	}
+
+	return proof, nil
+}
+
+// VerifyDLEQ checks a proof output by ProveDLEQ: z * B1 == T1 + c * X1 and z * B2 == T2 + c * X2
+func VerifyDLEQ(g1, g2 kyber.Group, B1, B2, X1, X2 kyber.Point, proof, context []byte) error {
+	if len(proof) != g1.PointLen()+g2.PointLen()+g1.ScalarLen() {
+		return errors.New("nizk: malformed proof")
+	}
+	T1 := g1.Point()
+	if err := T1.UnmarshalBinary(proof[:g1.PointLen()]); err != nil {
+		return err
+	}
+	T2 := g2.Point()
+	if err := T2.UnmarshalBinary(proof[g1.PointLen() : g1.PointLen()+g2.PointLen()]); err != nil {
+		return err
+	}
+	z := g1.Scalar()
+	if err := z.UnmarshalBinary(proof[g1.PointLen()+g2.PointLen():]); err != nil {
+		return err
+	}
+
+	c, err := challenge(g1, "dleq", context, B1, B2, X1, X2, T1, T2)
+	if err != nil {
+		return err
+	}
+
+	if !g1.Point().Mul(z, B1).Equal(g1.Point().Add(T1, g1.Point().Mul(c, X1))) {
+		return errors.New("nizk: invalid proof")
+	}
+	if !g2.Point().Mul(z, B2).Equal(g2.Point().Add(T2, g2.Point().Mul(c, X2))) {
+		return errors.New("nizk: invalid proof")
+	}
+
+	return nil
+}
+
+// ProveBlindedOpening proves that X1 and X2 blind the openings of the commitments C1 and C2 by the same
+// factor: X1 = a * (C1 - r1 * B1) and X2 = a * (C2 - r2 * B2), where C1 = M1 + r1 * B1 commits to the point
+// M1 of g1 and C2 = M2 + r2 * B2 to the point M2 of g2. Neither M1 nor M2 is revealed: the proof is one of
+// knowledge of a, s1 = a * r1 and s2 = a * r2 such that X1 = a * C1 - s1 * B1 and X2 = a * C2 - s2 * B2
+func ProveBlindedOpening(g1, g2 kyber.Group, B1, B2, C1, C2 kyber.Point, a, r1, r2 kyber.Scalar, X1, X2 kyber.Point, context []byte) ([]byte, error) {
+	s1 := g1.Scalar().Mul(a, r1)
+	s2 := g1.Scalar().Mul(a, r2)
+
+	k := g1.Scalar().Pick(random.New())
+	k1 := g1.Scalar().Pick(random.New())
+	k2 := g1.Scalar().Pick(random.New())
+	T1 := g1.Point().Sub(g1.Point().Mul(k, C1), g1.Point().Mul(k1, B1))
+	T2 := g2.Point().Sub(g2.Point().Mul(k, C2), g2.Point().Mul(k2, B2))
+
+	c, err := challenge(g1, "blinded opening", context, B1, B2, C1, C2, X1, X2, T1, T2)
+	if err != nil {
+		return nil, err
+	}
+	z := g1.Scalar().Add(k, g1.Scalar().Mul(c, a))
+	z1 := g1.Scalar().Add(k1, g1.Scalar().Mul(c, s1))
+	z2 := g1.Scalar().Add(k2, g1.Scalar().Mul(c, s2))
+
+	proof := make([]byte, 0, g1.PointLen()+g2.PointLen()+3*g1.ScalarLen())
+	for _, m := range []interface{ MarshalBinary() ([]byte, error) }{T1, T2, z, z1, z2} {
+		buf, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		proof = append(proof, buf...)
+	}
+
+	return proof, nil
+}
+
+// VerifyBlindedOpening checks a proof output by ProveBlindedOpening: z * C1 - z1 * B1 == T1 + c * X1 and
+// z * C2 - z2 * B2 == T2 + c * X2. X1 and X2 must not be the identity, which any commitment opens to with a
+// zero blinding factor
+func VerifyBlindedOpening(g1, g2 kyber.Group, B1, B2, C1, C2, X1, X2 kyber.Point, proof, context []byte) error {
+	scalarLen := g1.ScalarLen()
+	if len(proof) != g1.PointLen()+g2.PointLen()+3*scalarLen {
+		return errors.New("nizk: malformed proof")
+	}
+	if X1.Equal(g1.Point().Null()) || X2.Equal(g2.Point().Null()) {
+		return errors.New("nizk: blinded points at infinity")
+	}
+	T1 := g1.Point()
+	if err := T1.UnmarshalBinary(proof[:g1.PointLen()]); err != nil {
+		return err
+	}
+	proof = proof[g1.PointLen():]
+	T2 := g2.Point()
+	if err := T2.UnmarshalBinary(proof[:g2.PointLen()]); err != nil {
+		return err
+	}
+	proof = proof[g2.PointLen():]
+	z, z1, z2 := g1.Scalar(), g1.Scalar(), g1.Scalar()
+	for i, s := range []kyber.Scalar{z, z1, z2} {
+		if err := s.UnmarshalBinary(proof[i*scalarLen : (i+1)*scalarLen]); err != nil {
+			return err
+		}
+	}
+
+	c, err := challenge(g1, "blinded opening", context, B1, B2, C1, C2, X1, X2, T1, T2)
+	if err != nil {
+		return err
+	}
+
+	left1 := g1.Point().Sub(g1.Point().Mul(z, C1), g1.Point().Mul(z1, B1))
+	if !left1.Equal(g1.Point().Add(T1, g1.Point().Mul(c, X1))) {
+		return errors.New("nizk: invalid proof")
+	}
+	left2 := g2.Point().Sub(g2.Point().Mul(z, C2), g2.Point().Mul(z2, B2))
+	if !left2.Equal(g2.Point().Add(T2, g2.Point().Mul(c, X2))) {
+		return errors.New("nizk: invalid proof")
+	}
+
+	return nil
+}
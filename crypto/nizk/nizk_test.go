@@ -0,0 +1,146 @@
+package nizk
+
+import (
+	"testing"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto/bls12381"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+// testSuites lists the pairings every test runs against
+var testSuites = []struct {
+	name  string
+	suite pairing.Suite
+}{
+	{"bn256", bn256.NewSuite()},
+	{"bls12381", bls12381.NewSuite()},
+}
+
+// forEachSuite runs test once per pairing of testSuites
+func forEachSuite(t *testing.T, test func(*testing.T, pairing.Suite)) {
+	for _, s := range testSuites {
+		suite := s.suite
+		t.Run(s.name, func(t *testing.T) { test(t, suite) })
+	}
+}
+
+func TestDLog(t *testing.T) { forEachSuite(t, testDLog) }
+
+func testDLog(t *testing.T, suite pairing.Suite) {
+	context := []byte("test")
+
+	for _, group := range []kyber.Group{suite.G1(), suite.G2()} {
+		B := group.Point().Pick(random.New())
+		x := group.Scalar().Pick(random.New())
+		X := group.Point().Mul(x, B)
+
+		proof, err := ProveDLog(group, B, x, X, context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyDLog(group, B, X, proof, context); err != nil {
+			t.Errorf("%s: valid proof was rejected", group.String())
+		}
+		if err := VerifyDLog(group, B, X, proof, []byte("other")); err == nil {
+			t.Errorf("%s: proof accepted in another context", group.String())
+		}
+		if err := VerifyDLog(group, group.Point().Pick(random.New()), X, proof, context); err == nil {
+			t.Errorf("%s: proof accepted for another base", group.String())
+		}
+
+		wrong, _ := ProveDLog(group, B, group.Scalar().Pick(random.New()), X, context)
+		if err := VerifyDLog(group, B, X, wrong, context); err == nil {
+			t.Errorf("%s: proof accepted for the wrong witness", group.String())
+		}
+	}
+}
+
+func TestDLEQAcrossGroups(t *testing.T) { forEachSuite(t, testDLEQAcrossGroups) }
+
+func testDLEQAcrossGroups(t *testing.T, suite pairing.Suite) {
+	g1, g2 := suite.G1(), suite.G2()
+	context := []byte("test")
+
+	B1 := g1.Point().Pick(random.New())
+	B2 := g2.Point().Pick(random.New())
+	x := g1.Scalar().Pick(random.New())
+	X1 := g1.Point().Mul(x, B1)
+	X2 := g2.Point().Mul(x, B2)
+
+	proof, err := ProveDLEQ(g1, g2, B1, B2, x, X1, X2, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyDLEQ(g1, g2, B1, B2, X1, X2, proof, context); err != nil {
+		t.Errorf("Valid proof was rejected")
+	}
+	if err := VerifyDLEQ(g1, g2, B1, B2, X1, X2, proof, []byte("other")); err == nil {
+		t.Errorf("Proof accepted in another context")
+	}
+
+	// Different exponents in each group must be rejected
+	y := g1.Scalar().Pick(random.New())
+	Y2 := g2.Point().Mul(y, B2)
+	mixed, _ := ProveDLEQ(g1, g2, B1, B2, x, X1, Y2, context)
+	if err := VerifyDLEQ(g1, g2, B1, B2, X1, Y2, mixed, context); err == nil {
+		t.Errorf("Proof accepted for different exponents")
+	}
+
+	// A proof for another base in one of the groups must be rejected
+	other := g2.Point().Pick(random.New())
+	if err := VerifyDLEQ(g1, g2, B1, other, X1, X2, proof, context); err == nil {
+		t.Errorf("Proof accepted for another base")
+	}
+}
+
+func TestBlindedOpening(t *testing.T) { forEachSuite(t, testBlindedOpening) }
+
+func testBlindedOpening(t *testing.T, suite pairing.Suite) {
+	g1, g2 := suite.G1(), suite.G2()
+	B1, B2 := g1.Point().Base(), g2.Point().Base()
+	context := []byte("test")
+
+	// commitments to M1 and M2, blinded by a
+	M1, M2 := g1.Point().Pick(random.New()), g2.Point().Pick(random.New())
+	r1, r2 := g1.Scalar().Pick(random.New()), g1.Scalar().Pick(random.New())
+	C1 := g1.Point().Add(M1, g1.Point().Mul(r1, B1))
+	C2 := g2.Point().Add(M2, g2.Point().Mul(r2, B2))
+	a := g1.Scalar().Pick(random.New())
+	X1, X2 := g1.Point().Mul(a, M1), g2.Point().Mul(a, M2)
+
+	proof, err := ProveBlindedOpening(g1, g2, B1, B2, C1, C2, a, r1, r2, X1, X2, context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyBlindedOpening(g1, g2, B1, B2, C1, C2, X1, X2, proof, context); err != nil {
+		t.Errorf("Valid proof was rejected: %s", err)
+	}
+	if err := VerifyBlindedOpening(g1, g2, B1, B2, C1, C2, X1, X2, proof, []byte("other")); err == nil {
+		t.Errorf("Proof accepted in another context")
+	}
+
+	// A point of g2 that does not open C2 must be rejected, even with a proof made for it
+	other := g2.Point().Pick(random.New())
+	Y2 := g2.Point().Mul(a, other)
+	mixed, _ := ProveBlindedOpening(g1, g2, B1, B2, C1, C2, a, r1, r2, X1, Y2, context)
+	if err := VerifyBlindedOpening(g1, g2, B1, B2, C1, C2, X1, Y2, mixed, context); err == nil {
+		t.Errorf("Proof accepted for a point that does not open the commitment")
+	}
+
+	// Different blinding factors in each group must be rejected
+	b := g1.Scalar().Pick(random.New())
+	Z2 := g2.Point().Mul(b, M2)
+	if err := VerifyBlindedOpening(g1, g2, B1, B2, C1, C2, X1, Z2, proof, context); err == nil {
+		t.Errorf("Proof accepted for different blinding factors")
+	}
+
+	// A zero blinding factor opens any commitment
+	zero := g1.Scalar().Zero()
+	null, _ := ProveBlindedOpening(g1, g2, B1, B2, C1, C2, zero, r1, r2, g1.Point().Null(), g2.Point().Null(), context)
+	if err := VerifyBlindedOpening(g1, g2, B1, B2, C1, C2, g1.Point().Null(), g2.Point().Null(), null, context); err == nil {
+		t.Errorf("Proof accepted for points at infinity")
+	}
+}
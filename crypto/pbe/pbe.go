@@ -0,0 +1,84 @@
+// Package pbe implements passphrase-based encryption: an AES-GCM key is derived from a passphrase with scrypt.
+// The KDF parameters are stored next to the ciphertext so that the cost can be raised without breaking old files
+package pbe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrWrongPassphrase is returned by Open when the ciphertext cannot be decrypted
+var ErrWrongPassphrase = errors.New("pbe: wrong passphrase or corrupted data")
+
+// Largest scrypt cost parameters AEAD accepts. The parameters are read from files that may have been crafted,
+// the bounds keep the key derivation from using up the memory or CPU of the machine before the passphrase is
+// even checked. scrypt needs 128·N·r bytes of memory, 128 MiB at most
+const (
+	MaxN = 1 << 20
+	MaxR = 8
+	MaxP = 16
+)
+
+// KDF holds the parameters of the key derivation
+type KDF struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// NewKDF returns scrypt parameters with the given cost and a fresh random salt
+func NewKDF(n, r, p int) (KDF, error) {
+	k := KDF{Name: "scrypt", Salt: make([]byte, 16), N: n, R: r, P: p}
+	if _, err := rand.Read(k.Salt); err != nil {
+		return KDF{}, err
+	}
+	return k, nil
+}
+
+// AEAD derives the key from the passphrase and returns the corresponding AES-GCM instance
+func (k KDF) AEAD(passphrase []byte) (cipher.AEAD, error) {
+	if k.Name != "scrypt" {
+		return nil, fmt.Errorf("pbe: unsupported key derivation %q", k.Name)
+	}
+	if k.N > MaxN || k.R > MaxR || k.P > MaxP {
+		return nil, fmt.Errorf("pbe: key derivation cost N=%d r=%d p=%d is too high", k.N, k.R, k.P)
+	}
+	key, err := scrypt.Key(passphrase, k.Salt, k.N, k.R, k.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts and authenticates plaintext and additionalData under a random nonce
+func Seal(aead cipher.AEAD, plaintext, additionalData []byte) (nonce, ciphertext []byte, err error) {
+	nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts a ciphertext output by Seal
+func Open(aead cipher.AEAD, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
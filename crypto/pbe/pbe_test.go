@@ -0,0 +1,45 @@
+package pbe
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	kdf, err := NewKDF(1<<10, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := kdf.AEAD([]byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce, ciphertext, err := Seal(aead, []byte("secret"), []byte("header"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := Open(aead, nonce, ciphertext, []byte("header"))
+	if err != nil || !bytes.Equal(plaintext, []byte("secret")) {
+		t.Errorf("Could not open the ciphertext: %v", err)
+	}
+	if _, err := Open(aead, nonce, ciphertext, []byte("other header")); err != ErrWrongPassphrase {
+		t.Errorf("Opened with the wrong additional data")
+	}
+
+	wrong, _ := kdf.AEAD([]byte("wrong horse"))
+	if _, err := Open(wrong, nonce, ciphertext, []byte("header")); err != ErrWrongPassphrase {
+		t.Errorf("Opened with the wrong passphrase")
+	}
+
+	expensive := kdf
+	expensive.N = MaxN * 2
+	if _, err := expensive.AEAD([]byte("correct horse")); err == nil {
+		t.Errorf("Key derivation above the cost bounds accepted")
+	}
+
+	kdf.Name = "md5"
+	if _, err := kdf.AEAD([]byte("correct horse")); err == nil {
+		t.Errorf("Unknown key derivation accepted")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nmohnblatt/contact_discovery2/identity"
+	"github.com/nmohnblatt/contact_discovery2/meetingstore"
+	"github.com/nmohnblatt/contact_discovery2/normalise"
+	"github.com/nmohnblatt/contact_discovery2/quota"
+	"go.dedis.ch/kyber/v3/share"
+)
+
+// runDemo runs the PoC: servers and a couple of users run in-process, then the person at the keyboard
+// signs up and looks for their contacts
+func runDemo(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("demo")
+	servers := fs.Int("servers", 9, "number of servers `n`")
+	threshold := fs.Int("threshold", 3, "number of servers `t` needed to issue keys")
+	suite := fs.String("suite", "bn256", "pairing `suite`: bn256 or bls12381")
+	region := fs.String("region", "", "default `region` of phone numbers written without a country code, e.g. GB")
+	keystoreDir := fs.String("keystore", "", "`directory` of the servers' encrypted key shares, created on first run (the passphrase is read from $"+passphraseVariable+")")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+
+	// 1) SETUP SERVERS
+	// Set public parameters
+	var parameters publicParameters
+	parameters.TotalServers = *servers // this can be decided at setup
+	parameters.Threshold = *threshold  // t-of-n, 3-of-9 by default
+	var err error
+	if parameters.Suite, err = newSuite(*suite); err != nil {
+		return err
+	}
+
+	// Servers run a DKG protocol. They all live in this process, which could rebuild the master secret.
+	// With a keystore, the shares survive restarts and the DKG only runs on the first start
+	var serverList []*server
+	var pub1, pub2 *share.PubPoly
+	var passphrase []byte
+	if *keystoreDir != "" {
+		if passphrase, err = readPassphrase(""); err != nil {
+			return err
+		}
+	}
+	if *keystoreDir != "" && keystoresExist(parameters, *keystoreDir) {
+		serverList, pub1, pub2, err = loadThresholdServers(parameters, *keystoreDir, passphrase)
+	} else {
+		serverList, pub1, pub2, err = setupThresholdServers(parameters)
+		if err == nil && *keystoreDir != "" {
+			err = saveServerKeys(parameters, serverList, *keystoreDir, passphrase)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	parameters.PublicPolynomials[0], parameters.PublicPolynomials[1] = pub1, pub2
+
+	// Servers only issue keys to users who prove they own their identifier.
+	// The demo uses a stub identity provider that vouches for any identifier
+	issuer, err := identity.NewStubIssuer(parameters.Suite, stubIssuerTTL)
+	if err != nil {
+		return err
+	}
+	// They also rate limit each account and cap the number of identifiers it may obtain keys for
+	for _, s := range serverList {
+		s.verifier = issuer.Verifier()
+		s.limiter = quota.New(quota.Config{Rate: 1, Burst: 5, GlobalRate: 100, GlobalBurst: 1000, MaxIdentifiers: 5})
+	}
+
+	// run servers, each server is a network service listening on its own localhost port
+	endpoints, shutdown, err := startLoopbackServers(parameters, serverList)
+	if err != nil {
+		return err
+	}
+	defer shutdown()
+
+	// 2) SETUP ONLINE CACHE FOR MEETING POINTS
+	onlineCache := meetingstore.NewMemoryStore()
+
+	// 3) SETUP USERS
+	electra := newUser(parameters, "electra", []string{"arke", "thaumas"})
+	thaumas := newUser(parameters, "thaumas", []string{"arke", "electra"})
+
+	users := []*user{electra, thaumas}
+
+	for _, u := range users {
+		if err := u.attest(context.Background(), issuer); err != nil {
+			return err
+		}
+		if err := u.requestContrainingKeys(context.Background(), parameters, endpoints); err != nil {
+			return err
+		}
+		if err := u.computeSharedKeys(parameters); err != nil {
+			return err
+		}
+		for _, contact := range u.contacts {
+			if err := u.secureMeet(context.Background(), contact, onlineCache); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 4) DISCOVERY!
+	fmt.Fprintln(stdout, "PoC for the privacy preserving contact discovery service. In this demo you will be prompted to sign up to the service by using a username and entering some contacts. You may enter any identifiers you desire. To test the functionality, some users have already been built in to the platform and are expecting the arrival of one special guest, can you find who it is?")
+	fmt.Fprintln(stdout, "\nPlease enter your discovery identifier (username, mobile number, etc...):")
+	reader := bufio.NewReader(os.Stdin)
+	identifier, _ := reader.ReadString('\n')
+	if identifier, err = normalise.Identifier(identifier, *region); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "\nEnter your contacts' discovery identifiers separated by spaces:")
+	contactString, _ := reader.ReadString('\n')
+	contactString = strings.TrimSuffix(contactString, "\n")
+	contacts := strings.Fields(contactString)
+
+	externalUser := newUser(parameters, identifier, contacts)
+	externalUser.region = *region
+	fmt.Fprintf(stdout, "\nWelcome %s!\n\n", externalUser.DiscoveryIdentifier)
+
+	if err := externalUser.attest(context.Background(), issuer); err != nil {
+		return err
+	}
+	if err := externalUser.requestContrainingKeys(context.Background(), parameters, endpoints); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Successfully fetched your constraining keys from %d out of %d servers\n", parameters.Threshold, parameters.TotalServers)
+	for id, err := range externalUser.faultyServers {
+		fmt.Fprintf(stdout, "Server %d was skipped: %s\n", id, err)
+	}
+
+	if err := externalUser.computeSharedKeys(parameters); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Your constraining keys were used locally to derive shared secrets with your contacts. Checking meeting points...\n")
+
+	totalSignedUp := 0
+	for _, contact := range externalUser.contacts {
+		if err := externalUser.secureMeet(context.Background(), contact, onlineCache); err != nil {
+			return err
+		}
+		if present, found := externalUser.contactPresence[contact]; found {
+			if present {
+				fmt.Fprintf(stdout, "Your friend %s has already signed up and searched for you\n", contact)
+				totalSignedUp++
+			}
+		}
+	}
+
+	fmt.Fprintf(stdout, "\nFound %d contacts\n", totalSignedUp)
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/share"
+	dkg "go.dedis.ch/kyber/v3/share/dkg/pedersen"
+	"go.dedis.ch/kyber/v3/util/random"
+	"go.dedis.ch/kyber/v3/xof/blake2xb"
+)
+
+// dkgSuite exposes one group of a pairing suite with the primitives required by kyber's DKG
+type dkgSuite struct {
+	kyber.Group
+}
+
+func (dkgSuite) Hash() hash.Hash               { return sha256.New() }
+func (dkgSuite) XOF(seed []byte) kyber.XOF     { return blake2xb.New(seed) }
+func (dkgSuite) RandomStream() cipher.Stream   { return random.New() }
+func newDKGSuite(suite pairing.Suite) dkgSuite { return dkgSuite{suite.G2()} }
+
+// dkgParticipant is the state a server keeps while running the distributed key generation
+type dkgParticipant struct {
+	longterm  kyber.Scalar
+	Public    kyber.Point
+	generator *dkg.DistKeyGenerator
+}
+
+// newDKGParticipant picks the long-term key pair a server uses to authenticate and encrypt its deals
+func newDKGParticipant(suite pairing.Suite) *dkgParticipant {
+	group := newDKGSuite(suite)
+	longterm := group.Scalar().Pick(random.New())
+
+	return &dkgParticipant{
+		longterm: longterm,
+		Public:   group.Point().Mul(longterm, nil),
+	}
+}
+
+// joinDKG prepares the server to run the DKG with the given participants (identified by their long-term public keys)
+func (s *server) joinDKG(parameters publicParameters, participants []kyber.Point) error {
+	if s.participant == nil {
+		return errors.New("dkg: server has no long-term key")
+	}
+
+	generator, err := dkg.NewDistKeyGenerator(newDKGSuite(parameters.Suite), s.participant.longterm, participants, parameters.Threshold)
+	if err != nil {
+		return err
+	}
+	s.participant.generator = generator
+
+	return nil
+}
+
+// finishDKG returns the server's share of the distributed key and the public commitments in G2. The
+// share is not installed yet: callers install it with installShare once every server has finished
+func (s *server) finishDKG() (*share.PriShare, []kyber.Point, error) {
+	if s.participant == nil || s.participant.generator == nil {
+		return nil, nil, errors.New("dkg: server has not joined a DKG")
+	}
+	if !s.participant.generator.Certified() {
+		return nil, nil, fmt.Errorf("dkg: server %d is not certified", s.ID)
+	}
+
+	distKey, err := s.participant.generator.DistKeyShare()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.participant.generator = nil
+
+	return distKey.Share, distKey.Commits, nil
+}
+
+// installShare makes the server sign with sh. The same share is used to sign in both groups
+func (s *server) installShare(sh *share.PriShare) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = crypto.MasterSecretShares{
+		&share.PriShare{I: sh.I, V: sh.V.Clone()},
+		&share.PriShare{I: sh.I, V: sh.V.Clone()},
+	}
+}
+
+// abortDKG drops the generators of the servers once a run is over, so that a failed run leaves nothing
+// behind. Shares are not touched
+func abortDKG(servers []*server) {
+	for _, s := range servers {
+		if s.participant != nil {
+			s.participant.generator = nil
+		}
+	}
+}
+
+// runDKG runs a Pedersen distributed key generation among servers held in this process. Messages are
+// routed in memory between the servers' generators, so the process sees every share and could rebuild
+// the master secret: it must be trusted like a dealer, and forget the shares once they are saved. It
+// returns the public polynomials in G2 (verifies signatures on G1) and in G1 (verifies signatures on G2)
+func runDKG(parameters publicParameters, servers []*server) (*share.PubPoly, *share.PubPoly, error) {
+	participants := make([]kyber.Point, len(servers))
+	for i, s := range servers {
+		participants[i] = s.participant.Public
+	}
+
+	defer abortDKG(servers)
+	for _, s := range servers {
+		if err := s.joinDKG(parameters, participants); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 1) each server deals a share of its own secret to every other server
+	responses := make([]*dkg.Response, 0)
+	for _, s := range servers {
+		deals, err := s.participant.generator.Deals()
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, deal := range deals {
+			resp, err := servers[i].participant.generator.ProcessDeal(deal)
+			if err != nil {
+				return nil, nil, err
+			}
+			responses = append(responses, resp)
+		}
+	}
+
+	// 2) responses are broadcast, any complaint must be answered by a justification
+	justifications := make([]*dkg.Justification, 0)
+	for _, resp := range responses {
+		for i, s := range servers {
+			if resp.Response.Index == uint32(i) {
+				continue
+			}
+			j, err := s.participant.generator.ProcessResponse(resp)
+			if err != nil {
+				return nil, nil, err
+			}
+			if j != nil {
+				justifications = append(justifications, j)
+			}
+		}
+	}
+	for _, j := range justifications {
+		for _, s := range servers {
+			if err := s.participant.generator.ProcessJustification(j); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	// 3) every server computes its share, all must agree on the public polynomial
+	var commits []kyber.Point
+	shares := make([]*share.PriShare, len(servers))
+	for i, s := range servers {
+		sh, c, err := s.finishDKG()
+		if err != nil {
+			return nil, nil, err
+		}
+		shares[i] = sh
+		if commits == nil {
+			commits = c
+			continue
+		}
+		if !share.NewPubPoly(parameters.Suite.G2(), nil, c).Equal(share.NewPubPoly(parameters.Suite.G2(), nil, commits)) {
+			return nil, nil, errors.New("dkg: servers disagree on the public polynomial")
+		}
+	}
+	pubPoly1 := share.NewPubPoly(parameters.Suite.G2(), parameters.Suite.G2().Point().Base(), commits)
+
+	pubShares := make([]*share.PubShare, len(shares))
+	for i, sh := range shares {
+		pubShares[i] = &share.PubShare{I: sh.I, V: parameters.Suite.G1().Point().Mul(sh.V, nil)}
+	}
+	pubPoly2, err := recoverPubPolyG1(parameters, pubPoly1, pubShares)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, s := range servers {
+		s.installShare(shares[i])
+	}
+
+	return pubPoly1, pubPoly2, nil
+}
+
+// recoverPubPolyG1 interpolates the public polynomial in G1 from the servers' public shares x_i*B1. Each
+// share is first checked against the G2 polynomial: e(x_i*B1, B2) == e(B1, x_i*B2)
+func recoverPubPolyG1(parameters publicParameters, pubPolyG2 *share.PubPoly, pubShares []*share.PubShare) (*share.PubPoly, error) {
+	suite := parameters.Suite
+	for _, sh := range pubShares {
+		left := suite.Pair(sh.V, suite.G2().Point().Base())
+		right := suite.Pair(suite.G1().Point().Base(), pubPolyG2.Eval(sh.I).V)
+		if !left.Equal(right) {
+			return nil, fmt.Errorf("dkg: share %d is inconsistent with the public polynomial", sh.I)
+		}
+	}
+
+	recovered, err := share.RecoverPubPoly(suite.G1(), pubShares, parameters.Threshold, parameters.TotalServers)
+	if err != nil {
+		return nil, err
+	}
+	_, commits := recovered.Info()
+
+	return share.NewPubPoly(suite.G1(), suite.G1().Point().Base(), commits), nil
+}
@@ -2,5 +2,11 @@ module github.com/nmohnblatt/contact_discovery2
 
 go 1.14
 
-require go.dedis.ch/kyber/v3 v3.0.13
-
+require (
+	github.com/kilic/bls12-381 v0.1.0
+	go.dedis.ch/fixbuf v1.0.3
+	go.dedis.ch/kyber/v3 v3.0.13
+	golang.org/x/crypto v0.14.0
+	golang.org/x/net v0.17.0
+	golang.org/x/text v0.13.0
+)
@@ -0,0 +1,66 @@
+package identity
+
+import (
+	"errors"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+// Opening holds the randomness of a commitment made by Commit, in G1 and in G2
+type Opening struct {
+	Left, Right kyber.Scalar
+}
+
+// Commit commits to the public keys of identifier during epoch: C1 = H1(epoch||identifier) + r1*B1 in G1
+// and C2 = H2(epoch||identifier) + r2*B2 in G2, where B1 and B2 are the base points. The commitment hides
+// the identifier as long as r1 and r2 are secret, and binds it as long as no one knows the discrete log of
+// a hashed identifier. It returns C1 followed by C2, and the opening (r1, r2)
+func Commit(suite pairing.Suite, epoch uint64, identifier string) ([]byte, Opening, error) {
+	keys := crypto.DerivePublicKeys(suite, epoch, identifier)
+	opening := Opening{Left: suite.G1().Scalar().Pick(random.New()), Right: suite.G2().Scalar().Pick(random.New())}
+
+	C1 := suite.G1().Point().Add(keys.Left, suite.G1().Point().Mul(opening.Left, nil))
+	C2 := suite.G2().Point().Add(keys.Right, suite.G2().Point().Mul(opening.Right, nil))
+	left, err := C1.MarshalBinary()
+	if err != nil {
+		return nil, Opening{}, err
+	}
+	right, err := C2.MarshalBinary()
+	if err != nil {
+		return nil, Opening{}, err
+	}
+
+	return append(left, right...), opening, nil
+}
+
+// CommittedPoints returns the commitments C1 and C2 held in the token
+func (t *Token) CommittedPoints(suite pairing.Suite) (kyber.Point, kyber.Point, error) {
+	if len(t.Commitment) != suite.G1().PointLen()+suite.G2().PointLen() {
+		return nil, nil, errors.New("identity: malformed commitment")
+	}
+	C1 := suite.G1().Point()
+	if err := C1.UnmarshalBinary(t.Commitment[:suite.G1().PointLen()]); err != nil {
+		return nil, nil, err
+	}
+	C2 := suite.G2().Point()
+	if err := C2.UnmarshalBinary(t.Commitment[suite.G1().PointLen():]); err != nil {
+		return nil, nil, err
+	}
+
+	return C1, C2, nil
+}
+
+// Opens reports whether opening opens the token's commitment to identifier
+func (t *Token) Opens(suite pairing.Suite, identifier string, opening Opening) bool {
+	C1, C2, err := t.CommittedPoints(suite)
+	if err != nil || opening.Left == nil || opening.Right == nil {
+		return false
+	}
+	keys := crypto.DerivePublicKeys(suite, t.Epoch, identifier)
+
+	return C1.Equal(suite.G1().Point().Add(keys.Left, suite.G1().Point().Mul(opening.Left, nil))) &&
+		C2.Equal(suite.G2().Point().Add(keys.Right, suite.G2().Point().Mul(opening.Right, nil)))
+}
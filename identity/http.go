@@ -0,0 +1,151 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"go.dedis.ch/kyber/v3/pairing"
+)
+
+// issuePath is the endpoint credentials are requested from
+const issuePath = "/issue"
+
+// maxRequestSize bounds the size of a request accepted by the HTTP handler
+const maxRequestSize = 4096
+
+// AccountIssuer is an Issuer that ties the credentials it hands out to an account
+type AccountIssuer interface {
+	Issuer
+	IssueForAccount(ctx context.Context, account string, epoch uint64, identifier string) (*Credential, error)
+}
+
+// issueRequest asks for a credential for an identifier held by an account
+type issueRequest struct {
+	Account    string `json:"account,omitempty"`
+	Epoch      uint64 `json:"epoch"`
+	Identifier string `json:"identifier"`
+}
+
+// credentialInTransport is the encoding of a Credential, the opening holds the marshalled scalars r1 and r2
+type credentialInTransport struct {
+	Token   *Token    `json:"token"`
+	Opening [2][]byte `json:"opening"`
+}
+
+// NewHandler exposes an issuer over HTTP: POST on /issue. Ownership of the identifier is the issuer's to
+// check, a StubIssuer attests any identifier to anyone who asks
+func NewHandler(issuer AccountIssuer) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(issuePath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "identity: method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req issueRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Identifier == "" {
+			http.Error(w, "identity: no identifier", http.StatusBadRequest)
+			return
+		}
+
+		credential, err := issuer.IssueForAccount(r.Context(), req.Account, req.Epoch, req.Identifier)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var msg credentialInTransport
+		msg.Token = credential.Token
+		if msg.Opening[0], err = credential.Opening.Left.MarshalBinary(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if msg.Opening[1], err = credential.Opening.Right.MarshalBinary(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(msg)
+	})
+
+	return mux
+}
+
+// HTTPIssuer requests credentials from an issuer exposed by NewHandler
+type HTTPIssuer struct {
+	suite   pairing.Suite
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPIssuer returns a client for the issuer served at baseURL, whose commitments are made with suite
+func NewHTTPIssuer(suite pairing.Suite, baseURL string) *HTTPIssuer {
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "http://" + baseURL
+	}
+
+	return &HTTPIssuer{
+		suite:   suite,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{},
+	}
+}
+
+// Issue implements Issuer
+func (i *HTTPIssuer) Issue(ctx context.Context, epoch uint64, identifier string) (*Credential, error) {
+	return i.IssueForAccount(ctx, "", epoch, identifier)
+}
+
+// IssueForAccount implements AccountIssuer
+func (i *HTTPIssuer) IssueForAccount(ctx context.Context, account string, epoch uint64, identifier string) (*Credential, error) {
+	body, err := json.Marshal(issueRequest{Account: account, Epoch: epoch, Identifier: identifier})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, i.baseURL+issuePath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := i.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("identity: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	var msg credentialInTransport
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, err
+	}
+	if msg.Token == nil {
+		return nil, errors.New("identity: no token in the response")
+	}
+
+	opening := Opening{Left: i.suite.G1().Scalar(), Right: i.suite.G2().Scalar()}
+	if err := opening.Left.UnmarshalBinary(msg.Opening[0]); err != nil {
+		return nil, err
+	}
+	if err := opening.Right.UnmarshalBinary(msg.Opening[1]); err != nil {
+		return nil, err
+	}
+
+	// the servers would refuse a token that does not commit to the identifier, refuse it now
+	if msg.Token.Epoch != epoch || !msg.Token.Opens(i.suite, identifier, opening) {
+		return nil, errors.New("identity: the credential does not commit to the identifier")
+	}
+
+	return &Credential{Token: msg.Token, Opening: opening}, nil
+}
@@ -0,0 +1,177 @@
+// Package identity attests that a user controls the discovery identifier they request keys for.
+// An Issuer checks ownership of the identifier out of band (SMS code, email link, ...) and hands out a
+// signed Token, which servers check with a Verifier before issuing constraining keys. The token holds a
+// hiding commitment to the identifier rather than the identifier, so that key issuance stays blind
+package identity
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"go.dedis.ch/kyber/v3/pairing"
+)
+
+// Token attests that its holder controls the identifier committed to in Commitment until Expiry. The
+// identifier itself is not part of the token, so that the servers checking it learn nothing about it.
+// Account names the client the identifier was verified for, several identifiers may belong to the same
+// account
+type Token struct {
+	// Epoch is the epoch the committed identifier is hashed for
+	Epoch uint64 `json:"epoch"`
+	// Commitment hides the points the identifier hashes to in G1 and G2 (see Commit)
+	Commitment []byte `json:"commitment"`
+	// Tag tells the identifiers of an account apart without revealing them, so that quotas can count
+	// them. It changes every epoch
+	Tag       []byte    `json:"tag"`
+	Account   string    `json:"account,omitempty"`
+	Expiry    time.Time `json:"expiry"`
+	Signature []byte    `json:"signature"`
+}
+
+// AccountID returns the account the token was issued to. Tokens issued without an account belong to an
+// account named after their tag
+func (t *Token) AccountID() string {
+	if t.Account == "" {
+		return hex.EncodeToString(t.Tag)
+	}
+	return t.Account
+}
+
+// signedMessage returns the bytes covered by the token's signature
+func (t *Token) signedMessage() []byte {
+	msg := []byte("contact_discovery2 identity token")
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], t.Epoch)
+	msg = append(msg, buf[:]...)
+	binary.BigEndian.PutUint64(buf[:], uint64(t.Expiry.Unix()))
+	msg = append(msg, buf[:]...)
+	for _, field := range [][]byte{[]byte(t.Account), t.Tag} {
+		binary.BigEndian.PutUint64(buf[:], uint64(len(field)))
+		msg = append(msg, buf[:]...)
+		msg = append(msg, field...)
+	}
+	return append(msg, t.Commitment...)
+}
+
+// Credential is what an issuer hands to the user: the token shown to the servers and the opening of its
+// commitment, which only the user keeps
+type Credential struct {
+	Token   *Token
+	Opening Opening
+}
+
+// Issuer hands out credentials to users who proved control of an identifier. The token commits to the
+// identifier hashed for epoch
+type Issuer interface {
+	Issue(ctx context.Context, epoch uint64, identifier string) (*Credential, error)
+}
+
+// Verifier checks a token before keys are issued for its identifier
+type Verifier interface {
+	Verify(token *Token) error
+}
+
+// Ed25519Verifier checks tokens signed by an issuer's Ed25519 key
+type Ed25519Verifier struct {
+	PublicKey ed25519.PublicKey
+	// Now returns the current time, it defaults to time.Now
+	Now func() time.Time
+}
+
+// Verify implements Verifier
+func (v *Ed25519Verifier) Verify(token *Token) error {
+	if token == nil {
+		return errors.New("identity: missing token")
+	}
+	if !ed25519.Verify(v.PublicKey, token.signedMessage(), token.Signature) {
+		return errors.New("identity: invalid token signature")
+	}
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	if now().After(token.Expiry) {
+		return errors.New("identity: token has expired")
+	}
+
+	return nil
+}
+
+// StubIssuer issues a token for any identifier without checking ownership. It is meant for tests and demos
+type StubIssuer struct {
+	suite pairing.Suite
+	key   ed25519.PrivateKey
+	// tagKey keys the tags of the identifiers
+	tagKey []byte
+	ttl    time.Duration
+}
+
+// NewStubIssuer returns an issuer whose tokens commit to identifiers hashed with suite and are valid for ttl
+func NewStubIssuer(suite pairing.Suite, ttl time.Duration) (*StubIssuer, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+
+	return NewStubIssuerFromSeed(suite, seed, ttl)
+}
+
+// NewStubIssuerFromSeed returns an issuer whose keys are derived from a 32-byte seed, as returned by Seed
+func NewStubIssuerFromSeed(suite pairing.Suite, seed []byte, ttl time.Duration) (*StubIssuer, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("identity: invalid seed length")
+	}
+	mac := hmac.New(sha256.New, seed)
+	mac.Write([]byte("contact_discovery2 identifier tag"))
+
+	return &StubIssuer{suite: suite, key: ed25519.NewKeyFromSeed(seed), tagKey: mac.Sum(nil), ttl: ttl}, nil
+}
+
+// Seed returns the seed of the issuer's keys, so that the same issuer can be restored later
+func (s *StubIssuer) Seed() []byte {
+	return s.key.Seed()
+}
+
+// Issue implements Issuer
+func (s *StubIssuer) Issue(ctx context.Context, epoch uint64, identifier string) (*Credential, error) {
+	return s.IssueForAccount(ctx, "", epoch, identifier)
+}
+
+// IssueForAccount issues a credential for an identifier held by the given account
+func (s *StubIssuer) IssueForAccount(ctx context.Context, account string, epoch uint64, identifier string) (*Credential, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	commitment, opening, err := Commit(s.suite, epoch, identifier)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, s.tagKey)
+	mac.Write(crypto.EpochIdentifier(epoch, identifier))
+
+	token := &Token{
+		Epoch:      epoch,
+		Commitment: commitment,
+		Tag:        mac.Sum(nil),
+		Account:    account,
+		Expiry:     time.Now().Add(s.ttl),
+	}
+	token.Signature = ed25519.Sign(s.key, token.signedMessage())
+
+	return &Credential{Token: token, Opening: opening}, nil
+}
+
+// Verifier returns a verifier for the tokens issued by s
+func (s *StubIssuer) Verifier() *Ed25519Verifier {
+	return &Ed25519Verifier{PublicKey: s.key.Public().(ed25519.PublicKey)}
+}
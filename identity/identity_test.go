@@ -0,0 +1,173 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+)
+
+func TestStubIssuer(t *testing.T) {
+	suite := bn256.NewSuite()
+	issuer, err := NewStubIssuer(suite, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := issuer.Verifier()
+	ctx := context.Background()
+
+	credential, err := issuer.Issue(ctx, 7, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := credential.Token
+	if err := verifier.Verify(token); err != nil {
+		t.Errorf("Valid token was rejected: %s", err)
+	}
+
+	forged := *token
+	bob, _, _ := Commit(suite, 7, "bob")
+	forged.Commitment = bob
+	if err := verifier.Verify(&forged); err == nil {
+		t.Errorf("Token accepted for another commitment")
+	}
+	forged = *token
+	forged.Epoch++
+	if err := verifier.Verify(&forged); err == nil {
+		t.Errorf("Token accepted for another epoch")
+	}
+
+	shared, err := issuer.IssueForAccount(ctx, "family", 7, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shared.Token.AccountID() != "family" || token.AccountID() == "alice" || token.AccountID() == "" {
+		t.Errorf("Wrong account: got %q and %q", shared.Token.AccountID(), token.AccountID())
+	}
+	moved := *shared.Token
+	moved.Account = "mallory"
+	if err := verifier.Verify(&moved); err == nil {
+		t.Errorf("Token accepted for another account")
+	}
+
+	verifier.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if err := verifier.Verify(token); err == nil {
+		t.Errorf("Expired token was accepted")
+	}
+
+	other, _ := NewStubIssuer(suite, time.Hour)
+	if err := other.Verifier().Verify(token); err == nil {
+		t.Errorf("Token accepted by another issuer's verifier")
+	}
+}
+
+func TestTokenHidesIdentifier(t *testing.T) {
+	suite := bn256.NewSuite()
+	issuer, err := NewStubIssuer(suite, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	first, err := issuer.Issue(ctx, 7, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := issuer.Issue(ctx, 7, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first.Token.Commitment, second.Token.Commitment) {
+		t.Errorf("Commitments to the same identifier are equal")
+	}
+	if !bytes.Equal(first.Token.Tag, second.Token.Tag) {
+		t.Errorf("Tags of the same identifier differ within an epoch")
+	}
+	if next, _ := issuer.Issue(ctx, 8, "alice"); bytes.Equal(first.Token.Tag, next.Token.Tag) {
+		t.Errorf("Tags of an identifier are the same in two epochs")
+	}
+
+	// The commitment opens to the hashed identifier, which does not appear in the token
+	C1, C2, err := first.Token.CommittedPoints(suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := crypto.DerivePublicKeys(suite, 7, "alice")
+	opened1 := suite.G1().Point().Sub(C1, suite.G1().Point().Mul(first.Opening.Left, nil))
+	opened2 := suite.G2().Point().Sub(C2, suite.G2().Point().Mul(first.Opening.Right, nil))
+	if !opened1.Equal(keys.Left) || !opened2.Equal(keys.Right) {
+		t.Errorf("Commitment does not open to the identifier")
+	}
+	left, _ := keys.Left.MarshalBinary()
+	right, _ := keys.Right.MarshalBinary()
+	for _, field := range [][]byte{first.Token.Commitment, first.Token.Tag, []byte(first.Token.AccountID())} {
+		if bytes.Contains(field, []byte("alice")) || bytes.Contains(field, left) || bytes.Contains(field, right) {
+			t.Errorf("Token reveals the identifier")
+		}
+	}
+}
+
+func TestStubIssuerFromSeed(t *testing.T) {
+	suite := bn256.NewSuite()
+	issuer, err := NewStubIssuer(suite, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewStubIssuerFromSeed(suite, issuer.Seed(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential, err := restored.Issue(context.Background(), 0, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := issuer.Verifier().Verify(credential.Token); err != nil {
+		t.Errorf("Restored issuer does not sign with the same key: %s", err)
+	}
+	original, _ := issuer.Issue(context.Background(), 0, "alice")
+	if !bytes.Equal(original.Token.Tag, credential.Token.Tag) {
+		t.Errorf("Restored issuer does not tag identifiers with the same key")
+	}
+
+	if _, err := NewStubIssuerFromSeed(suite, []byte("short"), time.Hour); err == nil {
+		t.Errorf("Issuer created from an invalid seed")
+	}
+}
+
+func TestHTTPIssuer(t *testing.T) {
+	suite := bn256.NewSuite()
+	issuer, err := NewStubIssuer(suite, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(NewHandler(issuer))
+	defer ts.Close()
+	client := NewHTTPIssuer(suite, ts.URL)
+	ctx := context.Background()
+
+	credential, err := client.IssueForAccount(ctx, "family", 7, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := issuer.Verifier().Verify(credential.Token); err != nil {
+		t.Errorf("Token issued over HTTP was rejected: %s", err)
+	}
+	if credential.Token.AccountID() != "family" || credential.Token.Epoch != 7 {
+		t.Errorf("Token issued for the wrong account or epoch")
+	}
+	if !credential.Token.Opens(suite, "alice", credential.Opening) {
+		t.Errorf("Credential issued over HTTP does not open to the identifier")
+	}
+	if credential.Token.Opens(suite, "bob", credential.Opening) {
+		t.Errorf("Credential opens to another identifier")
+	}
+
+	if _, err := client.Issue(ctx, 7, ""); err == nil {
+		t.Errorf("Credential issued without an identifier")
+	}
+}
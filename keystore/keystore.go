@@ -0,0 +1,219 @@
+// Package keystore stores a server's shares of the master secret on disk, so that a restarted server
+// keeps serving the same constraining keys. Shares are encrypted under a passphrase (see package pbe).
+// The public commitments to the shares are kept in the clear, and authenticated as additional data,
+// so that they can be exported without the passphrase
+package keystore
+
+import (
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"github.com/nmohnblatt/contact_discovery2/crypto/pbe"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/share"
+)
+
+// Version is the version of the file format written by Save
+const Version = 1
+
+// scrypt cost parameters used by Save. Load reads them from the file
+var (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrWrongPassphrase is returned by Load when the file cannot be decrypted
+var ErrWrongPassphrase = pbe.ErrWrongPassphrase
+
+// Commitments are the public commitments to a server's shares: Shares[0] signs in G1 and is committed
+// to in G2, Shares[1] signs in G2 and is committed to in G1
+type Commitments struct {
+	ServerID int                `json:"server_id"`
+	Index    int                `json:"index"`
+	G2       []byte             `json:"g2"`
+	G1       []byte             `json:"g1"`
+	Shares   [2]*share.PubShare `json:"-"`
+}
+
+// header is the clear part of a keystore file, it is authenticated as the AEAD's additional data
+type header struct {
+	Version     int         `json:"version"`
+	KDF         pbe.KDF     `json:"kdf"`
+	Commitments Commitments `json:"commitments"`
+}
+
+type file struct {
+	header
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func commit(suite pairing.Suite, serverID int, shares crypto.MasterSecretShares) (Commitments, error) {
+	if shares[0] == nil || shares[1] == nil || shares[0].I != shares[1].I {
+		return Commitments{}, errors.New("keystore: incomplete shares")
+	}
+
+	c := Commitments{ServerID: serverID, Index: shares[0].I}
+	c.Shares[0] = &share.PubShare{I: shares[0].I, V: suite.G2().Point().Mul(shares[0].V, nil)}
+	c.Shares[1] = &share.PubShare{I: shares[1].I, V: suite.G1().Point().Mul(shares[1].V, nil)}
+
+	var err error
+	if c.G2, err = c.Shares[0].V.MarshalBinary(); err != nil {
+		return Commitments{}, err
+	}
+	if c.G1, err = c.Shares[1].V.MarshalBinary(); err != nil {
+		return Commitments{}, err
+	}
+
+	return c, nil
+}
+
+func (h *header) aead(passphrase []byte) (cipher.AEAD, []byte, error) {
+	aead, err := h.KDF.AEAD(passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	additionalData, err := json.Marshal(h)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return aead, additionalData, nil
+}
+
+// Save encrypts a server's shares under the passphrase and writes them to path. The file is replaced atomically
+func Save(path string, passphrase []byte, suite pairing.Suite, serverID int, shares crypto.MasterSecretShares) error {
+	commitments, err := commit(suite, serverID, shares)
+	if err != nil {
+		return err
+	}
+
+	kdf, err := pbe.NewKDF(scryptN, scryptR, scryptP)
+	if err != nil {
+		return err
+	}
+	f := file{header: header{Version: Version, KDF: kdf, Commitments: commitments}}
+	aead, additionalData, err := f.aead(passphrase)
+	if err != nil {
+		return err
+	}
+
+	var plaintext []byte
+	for _, s := range shares {
+		buf, err := s.V.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		plaintext = append(plaintext, buf...)
+	}
+	if f.Nonce, f.Ciphertext, err = pbe.Seal(aead, plaintext, additionalData); err != nil {
+		return err
+	}
+
+	buf, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func read(path string) (*file, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return nil, fmt.Errorf("keystore: %s: %v", path, err)
+	}
+	if f.Version != Version {
+		return nil, fmt.Errorf("keystore: %s: unsupported version %d", path, f.Version)
+	}
+
+	return &f, nil
+}
+
+// Load decrypts the shares stored at path and checks them against the stored commitments
+func Load(path string, passphrase []byte, suite pairing.Suite) (int, crypto.MasterSecretShares, error) {
+	f, err := read(path)
+	if err != nil {
+		return 0, crypto.MasterSecretShares{}, err
+	}
+	aead, additionalData, err := f.aead(passphrase)
+	if err != nil {
+		return 0, crypto.MasterSecretShares{}, err
+	}
+	plaintext, err := pbe.Open(aead, f.Nonce, f.Ciphertext, additionalData)
+	if err != nil {
+		return 0, crypto.MasterSecretShares{}, err
+	}
+
+	scalarLen := suite.G1().ScalarLen()
+	if len(plaintext) != 2*scalarLen {
+		return 0, crypto.MasterSecretShares{}, errors.New("keystore: malformed shares")
+	}
+	var shares crypto.MasterSecretShares
+	for i := range shares {
+		v := suite.G1().Scalar()
+		if err := v.UnmarshalBinary(plaintext[i*scalarLen : (i+1)*scalarLen]); err != nil {
+			return 0, crypto.MasterSecretShares{}, err
+		}
+		shares[i] = &share.PriShare{I: f.Commitments.Index, V: v}
+	}
+
+	// The commitments were authenticated, check that they match the shares
+	expected, err := commit(suite, f.Commitments.ServerID, shares)
+	if err != nil {
+		return 0, crypto.MasterSecretShares{}, err
+	}
+	if string(expected.G2) != string(f.Commitments.G2) || string(expected.G1) != string(f.Commitments.G1) {
+		return 0, crypto.MasterSecretShares{}, errors.New("keystore: shares do not match their commitments")
+	}
+
+	return f.Commitments.ServerID, shares, nil
+}
+
+// ReadCommitments returns the public commitments stored at path without decrypting the shares.
+// They are only authenticated when the shares are loaded with the passphrase
+func ReadCommitments(path string, suite pairing.Suite) (Commitments, error) {
+	f, err := read(path)
+	if err != nil {
+		return Commitments{}, err
+	}
+
+	c := f.Commitments
+	c.Shares[0] = &share.PubShare{I: c.Index, V: suite.G2().Point()}
+	if err := c.Shares[0].V.UnmarshalBinary(c.G2); err != nil {
+		return Commitments{}, err
+	}
+	c.Shares[1] = &share.PubShare{I: c.Index, V: suite.G1().Point()}
+	if err := c.Shares[1].V.UnmarshalBinary(c.G1); err != nil {
+		return Commitments{}, err
+	}
+
+	return c, nil
+}
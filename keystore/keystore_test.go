@@ -0,0 +1,129 @@
+package keystore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"github.com/nmohnblatt/contact_discovery2/crypto/pbe"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/share"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+func init() {
+	// keep the tests fast
+	scryptN = 1 << 10
+}
+
+func testShares(suite *bn256.Suite) crypto.MasterSecretShares {
+	v := suite.G2().Scalar().Pick(random.New())
+	return crypto.MasterSecretShares{&share.PriShare{I: 3, V: v}, &share.PriShare{I: 3, V: v.Clone()}}
+}
+
+func TestSaveLoad(t *testing.T) {
+	suite := bn256.NewSuite()
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "server.json")
+
+	shares := testShares(suite)
+	if err := Save(path, []byte("correct horse"), suite, 7, shares); err != nil {
+		t.Fatal(err)
+	}
+
+	id, loaded, err := Load(path, []byte("correct horse"), suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 7 {
+		t.Errorf("Wrong server ID: %d", id)
+	}
+	for i := range shares {
+		if loaded[i].I != shares[i].I || !loaded[i].V.Equal(shares[i].V) {
+			t.Errorf("Share %d was not restored", i)
+		}
+	}
+
+	if _, _, err := Load(path, []byte("wrong horse"), suite); err != ErrWrongPassphrase {
+		t.Errorf("Loaded with the wrong passphrase: %v", err)
+	}
+
+	commitments, err := ReadCommitments(path, suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !commitments.Shares[0].V.Equal(suite.G2().Point().Mul(shares[0].V, nil)) || !commitments.Shares[1].V.Equal(suite.G1().Point().Mul(shares[1].V, nil)) {
+		t.Errorf("Wrong commitments")
+	}
+}
+
+func TestTamperedFileRejected(t *testing.T) {
+	suite := bn256.NewSuite()
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "server.json")
+
+	if err := Save(path, []byte("pass"), suite, 1, testShares(suite)); err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := ioutil.ReadFile(path)
+
+	// Swapping the clear commitments breaks the authentication
+	var f file
+	if err := json.Unmarshal(buf, &f); err != nil {
+		t.Fatal(err)
+	}
+	f.Commitments.ServerID = 2
+	tampered, _ := json.Marshal(f)
+	ioutil.WriteFile(path, tampered, 0600)
+	if _, _, err := Load(path, []byte("pass"), suite); err == nil {
+		t.Errorf("Loaded a file with tampered commitments")
+	}
+
+	// Unknown versions are refused
+	f.Version = Version + 1
+	future, _ := json.Marshal(f)
+	ioutil.WriteFile(path, future, 0600)
+	if _, _, err := Load(path, []byte("pass"), suite); err == nil {
+		t.Errorf("Loaded a file with an unknown version")
+	}
+}
+
+func TestExpensiveKDFRejected(t *testing.T) {
+	suite := bn256.NewSuite()
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "server.json")
+
+	if err := Save(path, []byte("pass"), suite, 1, testShares(suite)); err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := ioutil.ReadFile(path)
+
+	// Each cost parameter is checked before the key is derived
+	for _, cost := range [][3]int{{pbe.MaxN * 2, scryptR, scryptP}, {scryptN, pbe.MaxR + 1, scryptP}, {scryptN, scryptR, pbe.MaxP + 1}} {
+		var f file
+		if err := json.Unmarshal(buf, &f); err != nil {
+			t.Fatal(err)
+		}
+		f.KDF.N, f.KDF.R, f.KDF.P = cost[0], cost[1], cost[2]
+		expensive, _ := json.Marshal(f)
+		ioutil.WriteFile(path, expensive, 0600)
+		if _, _, err := Load(path, []byte("pass"), suite); err == nil || err == ErrWrongPassphrase {
+			t.Errorf("Key derivation with N=%d r=%d p=%d was attempted", cost[0], cost[1], cost[2])
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nmohnblatt/contact_discovery2/identity"
+)
+
+// latencyReport summarises the latencies of the enrolments run by the load generator
+type latencyReport struct {
+	latencies []time.Duration
+	failures  map[string]int
+	elapsed   time.Duration
+}
+
+// percentile returns the latency below which a fraction p of the successful enrolments completed
+func (r *latencyReport) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(r.latencies))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(r.latencies) {
+		i = len(r.latencies) - 1
+	}
+	return r.latencies[i]
+}
+
+func (r *latencyReport) print(w io.Writer) {
+	failed := 0
+	for _, count := range r.failures {
+		failed += count
+	}
+	total := len(r.latencies) + failed
+	fmt.Fprintf(w, "%d enrolments in %s (%.1f/s), %d failed\n", total, r.elapsed.Round(time.Millisecond), float64(total)/r.elapsed.Seconds(), failed)
+	if len(r.latencies) > 0 {
+		fmt.Fprintf(w, "latency p50 %s  p90 %s  p99 %s  max %s\n",
+			r.percentile(0.50).Round(time.Microsecond), r.percentile(0.90).Round(time.Microsecond),
+			r.percentile(0.99).Round(time.Microsecond), r.latencies[len(r.latencies)-1].Round(time.Microsecond))
+	}
+	errs := make([]string, 0, len(r.failures))
+	for err := range r.failures {
+		errs = append(errs, err)
+	}
+	sort.Strings(errs)
+	for _, err := range errs {
+		fmt.Fprintf(w, "  %d x %s\n", r.failures[err], err)
+	}
+}
+
+// generateLoad enrols users "<prefix>-0" to "<prefix>-<users-1>" against the servers, concurrency at a time,
+// and measures how long each requestContrainingKeys round takes. Identity tokens are obtained before the
+// clock starts
+func generateLoad(ctx context.Context, parameters publicParameters, endpoints []*serverEndpoint, issuer identity.Issuer, prefix string, users, concurrency int, timeout time.Duration) (*latencyReport, error) {
+	if users < 1 || concurrency < 1 {
+		return nil, errors.New("loadgen: need at least one user and one worker")
+	}
+
+	userList := make([]*user, users)
+	for i := range userList {
+		userList[i] = newUser(parameters, fmt.Sprintf("%s-%d", prefix, i), nil)
+		if err := userList[i].attest(ctx, issuer); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &latencyReport{failures: make(map[string]int)}
+	var mu sync.Mutex
+	jobs := make(chan *user)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range jobs {
+				requestCtx, cancel := context.WithTimeout(ctx, timeout)
+				began := time.Now()
+				err := u.requestContrainingKeys(requestCtx, parameters, endpoints)
+				latency := time.Since(began)
+				cancel()
+
+				mu.Lock()
+				if err != nil {
+					report.failures[err.Error()]++
+				} else {
+					report.latencies = append(report.latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, u := range userList {
+		jobs <- u
+	}
+	close(jobs)
+	wg.Wait()
+	report.elapsed = time.Since(start)
+
+	sort.Slice(report.latencies, func(i, j int) bool { return report.latencies[i] < report.latencies[j] })
+	return report, nil
+}
+
+// runLoadgen drives many concurrent enrolments against running servers and reports latency percentiles
+func runLoadgen(args []string, stdout io.Writer) error {
+	fs, config := newFlagSet("loadgen")
+	parametersPath := fs.String("parameters", filepath.Join("deployment", parametersFile), "public parameters `file`")
+	fingerprint := fs.String("fingerprint", "", "expected fingerprint of the public parameters")
+	issuerURL := fs.String("issuer", defaultIssuerURL, "`URL` of the identity provider attesting the identifiers")
+	users := fs.Int("users", 100, "number of users to enroll")
+	concurrency := fs.Int("concurrency", 10, "number of users enrolling at the same time")
+	prefix := fs.String("prefix", "loadgen", "prefix of the generated identifiers")
+	timeout := fs.Duration("timeout", shareCollectionTimeout, "time allowed to each enrolment")
+	if err := parseFlags(fs, config, args); err != nil {
+		return err
+	}
+
+	parameters, endpoints, err := loadParametersFile(*parametersPath, *fingerprint)
+	if err != nil {
+		return err
+	}
+	issuer := identity.NewHTTPIssuer(parameters.Suite, *issuerURL)
+
+	report, err := generateLoad(context.Background(), parameters, endpoints, issuer, *prefix, *users, *concurrency, *timeout)
+	if err != nil {
+		return err
+	}
+	report.print(stdout)
+	return nil
+}
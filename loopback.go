@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net"
+)
+
+// startLoopbackServers runs each server as a network service on its own localhost port.
+// It returns the endpoints users should talk to and a function that shuts all servers down
+func startLoopbackServers(parameters publicParameters, servers []*server) ([]*serverEndpoint, func(), error) {
+	endpoints := make([]*serverEndpoint, 0, len(servers))
+	listeners := make([]net.Listener, 0, len(servers))
+
+	shutdown := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+
+	for _, s := range servers {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			shutdown()
+			return nil, nil, err
+		}
+		listeners = append(listeners, l)
+
+		go s.serve(parameters, l)
+		endpoints = append(endpoints, newServerEndpoint(s.ID, l.Addr().String()))
+	}
+
+	return endpoints, shutdown, nil
+}
@@ -1,46 +1,178 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"github.com/nmohnblatt/contact_discovery2/crypto/blindtbls"
+	"github.com/nmohnblatt/contact_discovery2/crypto/bls12381"
+	"github.com/nmohnblatt/contact_discovery2/crypto/nizk"
+	"github.com/nmohnblatt/contact_discovery2/identity"
+	"github.com/nmohnblatt/contact_discovery2/meetingstore"
+	"github.com/nmohnblatt/contact_discovery2/quota"
+	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/share"
 	"go.dedis.ch/kyber/v3/util/random"
 )
 
-func TestSharedKeyDerivationLocal(t *testing.T) {
-	// 1) SETUP
+// testSuites lists the pairings the protocol tests run against
+var testSuites = []struct {
+	name  string
+	suite pairing.Suite
+}{
+	{"bn256", bn256.NewSuite()},
+	{"bls12381", bls12381.NewSuite()},
+}
 
-	// Set public parameters
-	var parameters publicParameters
-	parameters.TotalServers = 9 // this can be decided at setup
-	parameters.Threshold = 3    // t-of-n, using 1/3 as an example
-	parameters.Suite = bn256.NewSuite()
+// forEachSuite runs test once per pairing of testSuites
+func forEachSuite(t *testing.T, test func(*testing.T, pairing.Suite)) {
+	for _, s := range testSuites {
+		suite := s.suite
+		t.Run(s.name, func(t *testing.T) { test(t, suite) })
+	}
+}
+
+// testDeployment is a set of servers that ran a DKG and serve on localhost ports until the test ends
+type testDeployment struct {
+	parameters publicParameters
+	servers    []*server
+	endpoints  []*serverEndpoint
+	// issuer is a stub identity provider trusted by the servers
+	issuer *identity.StubIssuer
+}
+
+// corruptServer1 gives the second server a share that does not match its public commitment
+func corruptServer1(d *testDeployment) {
+	bad := &share.PriShare{I: d.servers[1].keys[0].I, V: d.parameters.Suite.G2().Scalar().Pick(random.New())}
+	d.servers[1].keys = crypto.MasterSecretShares{bad, bad}
+}
 
-	// Ideally servers would run a DKG protocol
-	// Instead here we generate a master secret key and will share it
-	masterSecret := parameters.Suite.G1().Scalar().Pick(random.New())
-	serverList := make([]*server, parameters.TotalServers)
-	serverList, parameters.PublicPolynomials[0], parameters.PublicPolynomials[1] = setupThresholdServers(parameters, masterSecret)
+// newTestDeployment runs a DKG among n servers with the given threshold and starts serving them. The
+// options are applied to the deployment in between, e.g. to configure the servers
+func newTestDeployment(tb testing.TB, suite pairing.Suite, n, threshold int, options ...func(*testDeployment)) *testDeployment {
+	tb.Helper()
+	d := &testDeployment{}
+	d.parameters.TotalServers = n
+	d.parameters.Threshold = threshold
+	d.parameters.Suite = suite
 
-	// run servers, each server is its own go-routine
-	for _, s := range serverList {
-		go s.runServer(parameters)
+	var err error
+	if d.servers, d.parameters.PublicPolynomials[0], d.parameters.PublicPolynomials[1], err = setupThresholdServers(d.parameters); err != nil {
+		tb.Fatal(err)
+	}
+	if d.issuer, err = identity.NewStubIssuer(suite, time.Hour); err != nil {
+		tb.Fatal(err)
+	}
+	for _, s := range d.servers {
+		s.verifier = d.issuer.Verifier()
+	}
+	for _, option := range options {
+		option(d)
 	}
 
-	// 2) USERS
+	endpoints, shutdown, err := startLoopbackServers(d.parameters, d.servers)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(shutdown)
+	d.endpoints = endpoints
+
+	return d
+}
 
-	arke := newUser(parameters, "arke", []string{"thaumas", "electra"})
-	electra := newUser(parameters, "electra", []string{"arke", "thaumas"})
-	thaumas := newUser(parameters, "thaumas", []string{"arke", "iris"})
-	rando := newUser(parameters, "rando", []string{"arke", "thaumas", "electra"})
+// testReshareToken authorises the coordinator of the reshares of test deployments
+const testReshareToken = "reshare token"
 
-	users := []*user{arke, electra, thaumas, rando}
-	family := []*user{arke, electra, thaumas}
+// allowReshares lets the servers of a deployment take part in reshares
+func allowReshares(d *testDeployment) {
+	for _, s := range d.servers {
+		s.resharing = newReshareState([]byte(testReshareToken))
+	}
+}
+
+// coordinator returns copies of endpoints that authenticate to the servers' reshare endpoints
+func coordinator(endpoints []*serverEndpoint) []*serverEndpoint {
+	authenticated := make([]*serverEndpoint, len(endpoints))
+	for i, e := range endpoints {
+		authenticated[i] = newServerEndpoint(e.ID, e.Address)
+		authenticated[i].token = testReshareToken
+	}
+	return authenticated
+}
+
+// join starts n servers without a share, which can join the committee of the deployment in a reshare. It
+// returns the servers and their endpoints as seen by the coordinator
+func (d *testDeployment) join(tb testing.TB, n int) ([]*server, []*serverEndpoint) {
+	tb.Helper()
+	servers := make([]*server, n)
+	for i := range servers {
+		servers[i] = newServer(len(d.servers)+i, nil, nil)
+		servers[i].verifier = d.issuer.Verifier()
+		servers[i].resharing = newReshareState([]byte(testReshareToken))
+	}
+	endpoints, shutdown, err := startLoopbackServers(d.parameters, servers)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(shutdown)
+
+	return servers, coordinator(endpoints)
+}
+
+// enroll creates a user, attests their identifier, obtains their constraining keys from every server and
+// derives the keys shared with their contacts
+func (d *testDeployment) enroll(tb testing.TB, identifier string, contacts ...string) *user {
+	tb.Helper()
+	u := newUser(d.parameters, identifier, contacts)
+	d.attest(tb, u)
+	if err := u.requestContrainingKeys(context.Background(), d.parameters, d.endpoints); err != nil {
+		tb.Fatal(err)
+	}
+	if err := u.computeSharedKeys(d.parameters); err != nil {
+		tb.Fatal(err)
+	}
+
+	return u
+}
 
+// attest obtains credentials from the deployment's issuer for every identifier of the users
+func (d *testDeployment) attest(tb testing.TB, users ...*user) {
+	tb.Helper()
 	for _, u := range users {
-		u.requestContrainingKeys(parameters, chooseTofNservers(parameters, serverList))
-		u.computeSharedKeys(parameters)
+		if err := u.attest(context.Background(), d.issuer); err != nil {
+			tb.Fatal(err)
+		}
 	}
+}
+
+func TestSharedKeyDerivationLocal(t *testing.T) { forEachSuite(t, testSharedKeyDerivationLocal) }
+
+func testSharedKeyDerivationLocal(t *testing.T, suite pairing.Suite) {
+	// Servers run a DKG protocol, no single party ever knows the master secret
+	d := newTestDeployment(t, suite, 9, 3)
+
+	arke := d.enroll(t, "arke", "thaumas", "electra")
+	electra := d.enroll(t, "electra", "arke", "thaumas")
+	thaumas := d.enroll(t, "thaumas", "arke", "iris")
+	rando := d.enroll(t, "rando", "arke", "thaumas", "electra")
+	family := []*user{arke, electra, thaumas}
 
 	for _, u := range family {
 		for _, val := range u.sharedKeys {
@@ -54,45 +186,1565 @@ func TestSharedKeyDerivationLocal(t *testing.T) {
 
 }
 
-func TestConstrainingKeys(t *testing.T) {
+func TestConstrainingKeys(t *testing.T) { forEachSuite(t, testConstrainingKeys) }
+
+func testConstrainingKeys(t *testing.T, suite pairing.Suite) {
 	// 1) SETUP
 
 	// Set public parameters
-	var parameters publicParameters
-	parameters.TotalServers = 9 // this can be decided at setup
-	parameters.Threshold = 3    // t-of-n, using 1/3 as an example
-	parameters.Suite = bn256.NewSuite()
-
-	// Ideally servers would run a DKG protocol
-	// Instead here we generate a master secret key and will share it
-	masterSecret := parameters.Suite.G1().Scalar().Pick(random.New())
-	serverList := make([]*server, parameters.TotalServers)
-	serverList, parameters.PublicPolynomials[0], parameters.PublicPolynomials[1] = setupThresholdServers(parameters, masterSecret)
-
-	// run servers, each server is its own go-routine
-	for _, s := range serverList {
-		go s.runServer(parameters)
-	}
+	d := newTestDeployment(t, suite, 9, 3)
+	parameters, serverList, endpoints := d.parameters, d.servers, d.endpoints
 
 	// 2) USERS
 
 	u1 := newUser(parameters, "nmohnblatt", []string{"mom", "dad"})
+	d.attest(t, u1)
 
 	// Obtain constraining keys from t servers
-	u1.requestContrainingKeys(parameters, chooseTofNservers(parameters, serverList))
+	if err := u1.requestContrainingKeys(context.Background(), parameters, endpoints); err != nil {
+		t.Fatal(err)
+	}
 
-	// Compute the expected values for Alice's private keys
-	want1 := parameters.Suite.G1().Point().Mul(masterSecret, u1.publicKeys.Left)
-	want2 := parameters.Suite.G2().Point().Mul(masterSecret, u1.publicKeys.Right)
+	// Compute the expected values for Alice's private keys. Only the test reconstructs the master secret
+	shares := make([]*share.PriShare, len(serverList))
+	for i, s := range serverList {
+		shares[i] = s.keys[0]
+	}
+	masterSecret, err := share.RecoverSecret(parameters.Suite.G1(), shares, parameters.Threshold, parameters.TotalServers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want1 := parameters.Suite.G1().Point().Mul(masterSecret, u1.identifiers[0].publicKeys.Left)
+	want2 := parameters.Suite.G2().Point().Mul(masterSecret, u1.identifiers[0].publicKeys.Right)
 
 	// Check the value recovered from servers matches the expected value
-	if !u1.constrainingKeys.Left.Equal(want1) {
+	if !u1.identifiers[0].constrainingKeys.Left.Equal(want1) {
 		t.Errorf("Did not compute correct private key 1")
 	} else {
 		t.Log("private key 1 OK")
 	}
-	if !u1.constrainingKeys.Right.Equal(want2) {
+	if !u1.identifiers[0].constrainingKeys.Right.Equal(want2) {
 		t.Errorf("Did not compute correct private key 2")
 	}
 
 }
+
+func TestSignEndpointRejectsMalformedPoints(t *testing.T) {
+	forEachSuite(t, testSignEndpointRejectsMalformedPoints)
+}
+
+func testSignEndpointRejectsMalformedPoints(t *testing.T, suite pairing.Suite) {
+	d := newTestDeployment(t, suite, 3, 2)
+	parameters, serverList, endpoints := d.parameters, d.servers, d.endpoints
+
+	if _, err := endpoints[0].requestSignature(context.Background(), keysInTransport{Left: []byte("not a point"), Right: []byte("not a point")}); err == nil {
+		t.Errorf("Server signed a malformed blinded point")
+	}
+
+	// The identity decodes fine, but it is not a valid blinded point
+	left, _ := suite.G1().Point().Null().MarshalBinary()
+	right, _ := suite.G2().Point().Null().MarshalBinary()
+	if _, err := serverList[0].sign(parameters, keysInTransport{Left: left, Right: right}); err == nil {
+		t.Errorf("Server signed the identity")
+	}
+
+	// Users reject signature shares that are not in the group either
+	leftShare, _ := blindtbls.PubSharetoSigShare(&share.PubShare{I: 0, V: suite.G1().Point().Null()})
+	rightShare, _ := blindtbls.PubSharetoSigShare(&share.PubShare{I: 0, V: suite.G2().Point().Null()})
+	blinded := crypto.DerivePublicKeys(suite, 0, "alice")
+	if _, _, err := verifySignatureShares(parameters, blinded, keysInTransport{Left: leftShare, Right: rightShare}); err == nil {
+		t.Errorf("User accepted the identity as a signature share")
+	}
+}
+
+func TestDKGPublicKeysMatch(t *testing.T) { forEachSuite(t, testDKGPublicKeysMatch) }
+
+func testDKGPublicKeysMatch(t *testing.T, suite pairing.Suite) {
+	var parameters publicParameters
+	parameters.TotalServers = 5
+	parameters.Threshold = 3
+	parameters.Suite = suite
+
+	serverList, pub1, pub2, err := setupThresholdServers(parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both polynomials must commit to the same master secret
+	left := parameters.Suite.Pair(pub2.Commit(), parameters.Suite.G2().Point().Base())
+	right := parameters.Suite.Pair(parameters.Suite.G1().Point().Base(), pub1.Commit())
+	if !left.Equal(right) {
+		t.Errorf("Public polynomials do not share the same secret")
+	}
+
+	for _, s := range serverList {
+		if !pub1.Check(s.keys[0]) || !pub2.Check(s.keys[1]) {
+			t.Errorf("Share of server %d does not match the public polynomials", s.ID)
+		}
+	}
+}
+
+func TestReshareKeepsConstrainingKeys(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 5, 3, allowReshares)
+	parameters := d.parameters
+	ctx := context.Background()
+	before := d.enroll(t, "nmohnblatt", "mom")
+	keys, err := publicKeyFingerprint(parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := before.toProfile(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Refresh the current committee, then move to a (4, 5) committee that retires two servers and adds two
+	refreshed, endpoints, err := reshare(ctx, parameters, coordinator(d.endpoints), coordinator(d.endpoints), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.PublicPolynomials[0].Equal(parameters.PublicPolynomials[0]) {
+		t.Errorf("Public polynomial was not re-randomised")
+	}
+	_, joining := d.join(t, 2)
+	newCommittee := append(append([]*serverEndpoint{}, endpoints[2:]...), joining...)
+	resharedParameters, newEndpoints, err := reshare(ctx, refreshed, endpoints, newCommittee, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resharedParameters.PublicPolynomials[0].Commit().Equal(parameters.PublicPolynomials[0].Commit()) {
+		t.Errorf("Public key changed after resharing")
+	}
+	if _, err := d.servers[0].sign(parameters, keysInTransport{}); err == nil {
+		t.Errorf("Retired server can still sign")
+	}
+	if _, err := d.servers[0].share(); err == nil {
+		t.Errorf("Retired server still holds a share")
+	}
+	if d.servers[2].ID != 0 {
+		t.Errorf("Server 2 was not renumbered after the servers before it left: %d", d.servers[2].ID)
+	}
+
+	after := newUser(resharedParameters, "nmohnblatt", []string{"mom"})
+	d.attest(t, after)
+	if err := after.requestContrainingKeys(ctx, resharedParameters, newEndpoints); err != nil {
+		t.Fatal(err)
+	}
+	if !before.identifiers[0].constrainingKeys.Left.Equal(after.identifiers[0].constrainingKeys.Left) || !before.identifiers[0].constrainingKeys.Right.Equal(after.identifiers[0].constrainingKeys.Right) {
+		t.Errorf("Constraining keys changed after resharing")
+	}
+
+	// The parameters changed, but profiles saved before the reshare are still accepted
+	oldFingerprint, _ := parametersFingerprint(parameters, d.endpoints)
+	newFingerprint, _ := parametersFingerprint(resharedParameters, newEndpoints)
+	if oldFingerprint == newFingerprint {
+		t.Errorf("Parameters fingerprint did not change with the committee")
+	}
+	if keys, err = publicKeyFingerprint(resharedParameters); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := userFromProfile(resharedParameters, keys, p); err != nil {
+		t.Errorf("Profile refused after a reshare: %s", err)
+	}
+}
+
+func TestFailedReshareKeepsShares(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 5, 3, allowReshares)
+	parameters := d.parameters
+	ctx := context.Background()
+	before := make([]*share.PriShare, len(d.servers))
+	for i, s := range d.servers {
+		var err error
+		if before[i], err = s.share(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	joiningServers, joining := d.join(t, 2)
+	newCommittee := append(append([]*serverEndpoint{}, coordinator(d.endpoints)[2:]...), joining...)
+
+	// The coordinator must hold the servers' reshare token
+	if _, _, err := reshare(ctx, parameters, d.endpoints, newCommittee, 4); err == nil {
+		t.Errorf("Servers reshared for a coordinator without the token")
+	}
+	// The committee cannot reproduce the G1 public key of another deployment: the reshare only fails
+	// once every new server has computed its share
+	other := newTestDeployment(t, bn256.NewSuite(), 5, 3)
+	wrong := parameters
+	wrong.PublicPolynomials = [2]*share.PubPoly{parameters.PublicPolynomials[0], other.parameters.PublicPolynomials[1]}
+	if _, _, err := reshare(ctx, wrong, coordinator(d.endpoints), newCommittee, 4); err == nil {
+		t.Fatal("Reshare to the wrong public key succeeded")
+	}
+	// Nor can servers be made to reshare the secret of another public key
+	if _, _, err := reshare(ctx, other.parameters, coordinator(d.endpoints), newCommittee, 4); err == nil {
+		t.Fatal("Servers reshared the secret of another public key")
+	}
+
+	for i, s := range d.servers {
+		if sh, err := s.share(); err != nil || !sh.V.Equal(before[i].V) {
+			t.Errorf("Server %d changed its share during a failed reshare", s.ID)
+		}
+	}
+	for _, s := range joiningServers {
+		if _, err := s.share(); err == nil {
+			t.Errorf("Server %d joined the committee during a failed reshare", s.ID)
+		}
+	}
+
+	// The old committee still serves users and can reshare again
+	d.enroll(t, "nmohnblatt", "mom")
+	if _, _, err := reshare(ctx, parameters, coordinator(d.endpoints), newCommittee, 4); err != nil {
+		t.Errorf("Could not reshare after a failed reshare: %s", err)
+	}
+}
+
+func TestSecureMeet(t *testing.T) { forEachSuite(t, testSecureMeet) }
+
+func testSecureMeet(t *testing.T, suite pairing.Suite) {
+	d := newTestDeployment(t, suite, 3, 2)
+	alice := d.enroll(t, "alice", "bob")
+	bob := d.enroll(t, "bob", "alice")
+	alice.card = []byte("alice's contact card")
+
+	ctx := context.Background()
+	onlineCache := meetingstore.NewMemoryStore()
+	if err := alice.secureMeet(ctx, "bob", onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	points, err := onlineCache.List(ctx)
+	if err != nil || len(points) != 1 {
+		t.Fatalf("Expected exactly one meeting point")
+	}
+	sealed, _ := onlineCache.Get(ctx, points[0])
+	if bytes.Contains(sealed, alice.card) {
+		t.Errorf("Meeting point holds the payload in the clear")
+	}
+
+	// Alice finding her own payload does not mean Bob is here
+	if err := alice.secureMeet(ctx, "bob", onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	if alice.contactPresence["bob"] {
+		t.Errorf("Alice discovered Bob before he signed up")
+	}
+
+	if err := bob.secureMeet(ctx, "alice", onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	if !bob.contactPresence["alice"] {
+		t.Errorf("Bob did not discover Alice")
+	}
+	if !bytes.Equal(bob.contactCards["alice"], alice.card) {
+		t.Errorf("Bob did not receive Alice's contact card")
+	}
+
+	// A tampered payload must be rejected
+	sealed[len(sealed)-1] ^= 0x01
+	if err := onlineCache.Put(ctx, points[0], sealed); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.secureMeet(ctx, "alice", onlineCache); err == nil {
+		t.Errorf("Tampered meeting point was accepted")
+	}
+}
+
+func TestAttestationRequired(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2)
+	parameters, endpoints, issuer := d.parameters, d.endpoints, d.issuer
+	ctx := context.Background()
+
+	// No credential
+	alice := newUser(parameters, "alice", []string{"bob"})
+	if b, err := newBlindedRequest(parameters, alice.identifiers[0].publicKeys, nil); err == nil {
+		if _, err := endpoints[0].requestSignature(ctx, b.request); err == nil {
+			t.Errorf("Servers issued keys without an attestation")
+		}
+	}
+	if err := alice.requestContrainingKeys(ctx, parameters, endpoints); err == nil {
+		t.Errorf("Keys were obtained without an attestation")
+	}
+
+	// Credential for someone else's identifier
+	mallory := newUser(parameters, "alice", []string{"bob"})
+	var err error
+	if mallory.identifiers[0].attestation, err = issuer.Issue(ctx, mallory.epoch, "mallory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mallory.requestContrainingKeys(ctx, parameters, endpoints); err == nil {
+		t.Errorf("Servers issued keys for an identifier that was not attested")
+	}
+
+	// Credential from an issuer the servers do not trust
+	other, err := identity.NewStubIssuer(parameters.Suite, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.attest(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.requestContrainingKeys(ctx, parameters, endpoints); err == nil {
+		t.Errorf("Servers issued keys attested by an unknown issuer")
+	}
+
+	// Valid credential
+	if err := alice.attest(ctx, issuer); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+		t.Errorf("Attested user was refused keys: %s", err)
+	}
+
+	// A server that cannot check attestations refuses to sign, even attested requests
+	b, err := newBlindedRequest(parameters, alice.identifiers[0].publicKeys, alice.identifiers[0].attestation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchecked := newServer(d.servers[0].ID, d.servers[0].keys[0], d.servers[0].keys[1])
+	if _, err := unchecked.sign(parameters, b.request); !errors.Is(err, errNotAttested) {
+		t.Errorf("Server without a verifier signed: %v", err)
+	}
+	if _, err := unchecked.signBatch(parameters, batchInTransport{Requests: []keysInTransport{b.request}}); !errors.Is(err, errNotAttested) {
+		t.Errorf("Server without a verifier signed a batch: %v", err)
+	}
+}
+
+func TestServersNeverSeeIdentifiers(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2)
+	parameters, endpoints := d.parameters, d.endpoints
+
+	// Every request is recorded on its way to the servers
+	var mu sync.Mutex
+	var requests []keysInTransport
+	var bodies [][]byte
+	for i, e := range endpoints {
+		target := e.Address
+		recorder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			var batch batchInTransport
+			if r.URL.Path == signBatchEndpoint {
+				json.Unmarshal(body, &batch)
+			} else {
+				batch.Requests = make([]keysInTransport, 1)
+				json.Unmarshal(body, &batch.Requests[0])
+			}
+			mu.Lock()
+			bodies = append(bodies, body)
+			requests = append(requests, batch.Requests...)
+			mu.Unlock()
+			resp, err := http.Post(target+r.URL.Path, "application/json", bytes.NewReader(body))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+		}))
+		defer recorder.Close()
+		endpoints[i] = newServerEndpoint(e.ID, recorder.URL)
+	}
+
+	identifiers := []string{"tel:+447700900123", "mailto:alice@example.org"}
+	alice := newUser(parameters, identifiers[0], nil)
+	d.attest(t, alice)
+	if err := alice.requestContrainingKeys(context.Background(), parameters, endpoints); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.addIdentifier(parameters, identifiers[1]); err != nil {
+		t.Fatal(err)
+	}
+	d.attest(t, alice)
+	if err := alice.requestContrainingKeys(context.Background(), parameters, endpoints); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the identifiers nor the points they hash to, which anyone can recompute, are sent
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) < 3*parameters.Threshold {
+		t.Fatalf("Expected at least %d requests to be recorded, got %d", 3*parameters.Threshold, len(requests))
+	}
+	for _, id := range identifiers {
+		keys := crypto.DerivePublicKeys(parameters.Suite, alice.epoch, id)
+		left, _ := keys.Left.MarshalBinary()
+		right, _ := keys.Right.MarshalBinary()
+		for _, body := range bodies {
+			if bytes.Contains(body, []byte(id)) {
+				t.Errorf("A request holds the identifier %s", id)
+			}
+		}
+		for _, request := range requests {
+			token := request.Attestation
+			for _, field := range [][]byte{request.Left, request.Right, request.Proof, token.Commitment, token.Tag, token.Signature, []byte(token.AccountID())} {
+				if bytes.Contains(field, left) || bytes.Contains(field, right) || bytes.Contains(field, []byte(id)) {
+					t.Errorf("A request reveals the identifier %s", id)
+				}
+			}
+		}
+	}
+}
+
+func TestMixedIdentitiesRejected(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2)
+	parameters, serverList := d.parameters, d.servers
+	suite := parameters.Suite
+	ctx := context.Background()
+	epoch := parameters.currentEpoch()
+	credential, err := d.issuer.Issue(ctx, epoch, "mallory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, opening := credential.Token, credential.Opening
+	C1, C2, err := token.CommittedPoints(suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	B1, B2 := suite.G1().Point().Base(), suite.G2().Point().Base()
+
+	// Blind H1("mallory") and H2("alice") with the same factor and try to pass them off as mallory's
+	a := suite.G1().Scalar().Pick(random.New())
+	mallory := crypto.DerivePublicKeys(suite, epoch, "mallory")
+	alice := crypto.DerivePublicKeys(suite, epoch, "alice")
+	left := suite.G1().Point().Mul(a, mallory.Left)
+	right := suite.G2().Point().Mul(a, alice.Right)
+
+	request := keysInTransport{Attestation: token}
+	request.Left, _ = left.MarshalBinary()
+	request.Right, _ = right.MarshalBinary()
+	request.Proof, err = nizk.ProveBlindedOpening(suite.G1(), suite.G2(), B1, B2, C1, C2, a, opening.Left, opening.Right, left, right, attestationContext(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := serverList[0].sign(parameters, request); !errors.Is(err, errNotAttested) {
+		t.Errorf("Server signed blinded points hiding different identifiers")
+	}
+
+	// A proof over the hashed identifiers themselves is not accepted in place of one over the commitments
+	request.Proof, err = nizk.ProveDLEQ(suite.G1(), suite.G2(), mallory.Left, alice.Right, a, left, right, attestationContext(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := serverList[0].sign(parameters, request); !errors.Is(err, errNotAttested) {
+		t.Errorf("Server signed blinded points with a proof that does not open the commitments")
+	}
+
+	// The honest request goes through
+	right = suite.G2().Point().Mul(a, mallory.Right)
+	request.Right, _ = right.MarshalBinary()
+	request.Proof, err = nizk.ProveBlindedOpening(suite.G1(), suite.G2(), B1, B2, C1, C2, a, opening.Left, opening.Right, left, right, attestationContext(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := serverList[0].sign(parameters, request); err != nil {
+		t.Errorf("Server refused an honest request: %s", err)
+	}
+}
+
+func TestMisbehavingServerSkipped(t *testing.T) {
+	// Server 1 signs with a share that does not match its public commitment
+	d := newTestDeployment(t, bn256.NewSuite(), 4, 2, corruptServer1)
+	parameters, serverList, endpoints := d.parameters, d.servers, d.endpoints
+	ctx := context.Background()
+
+	// With only the bad server and one honest server, recovery must fail and name the bad server
+	u := newUser(parameters, "alice", []string{"bob"})
+	d.attest(t, u)
+	if err := u.requestContrainingKeys(ctx, parameters, endpoints[:2]); err == nil {
+		t.Errorf("Recovered keys from an invalid share")
+	}
+	if _, found := u.faultyServers[1]; !found || len(u.faultyServers) != 1 {
+		t.Errorf("Misbehaving server was not identified: %v", u.faultyServers)
+	}
+
+	// Given more servers, the user skips the bad one and recovers the right keys
+	if err := u.requestContrainingKeys(ctx, parameters, endpoints[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := u.faultyServers[1]; !found {
+		t.Errorf("Misbehaving server was not identified: %v", u.faultyServers)
+	}
+	secret, err := share.RecoverSecret(parameters.Suite.G2(), []*share.PriShare{serverList[0].keys[0], serverList[2].keys[0]}, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := parameters.Suite.G1().Point().Mul(secret, u.identifiers[0].publicKeys.Left)
+	if !u.identifiers[0].constrainingKeys.Left.Equal(want) {
+		t.Errorf("Recovered the wrong constraining key")
+	}
+}
+
+func TestBatchSigning(t *testing.T) { forEachSuite(t, testBatchSigning) }
+
+func testBatchSigning(t *testing.T, suite pairing.Suite) {
+	// Server 1 signs with a share that does not match its public commitment
+	d := newTestDeployment(t, suite, 4, 2, corruptServer1)
+	parameters, endpoints, issuer := d.parameters, d.endpoints, d.issuer
+	ctx := context.Background()
+
+	// One person enrolls three identifiers with one request per server
+	alice := newUser(parameters, "tel:+447700900123", []string{"bob"})
+	for _, id := range []string{"alice@example.org", "@alice"} {
+		if err := alice.addIdentifier(parameters, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := alice.attest(ctx, issuer); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.requestContrainingKeys(ctx, parameters, endpoints[:2]); err == nil {
+		t.Errorf("Recovered keys from an invalid batch of shares")
+	}
+	if _, found := alice.faultyServers[1]; !found || len(alice.faultyServers) != 1 {
+		t.Errorf("Misbehaving server was not identified: %v", alice.faultyServers)
+	}
+	if err := alice.requestContrainingKeys(ctx, parameters, endpoints[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The keys are those obtained one identifier at a time
+	for _, id := range alice.identifiers {
+		single := newUser(parameters, id.identifier, nil)
+		single.identifiers[0].attestation = id.attestation
+		if err := single.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+			t.Fatal(err)
+		}
+		if !id.constrainingKeys.Left.Equal(single.identifiers[0].constrainingKeys.Left) || !id.constrainingKeys.Right.Equal(single.identifiers[0].constrainingKeys.Right) {
+			t.Errorf("%s: batch and single requests gave different keys", id.identifier)
+		}
+	}
+
+	// A single request without a valid attestation spoils the whole batch
+	if err := alice.addIdentifier(parameters, "mallory"); err != nil {
+		t.Fatal(err)
+	}
+	alice.identifier("mallory").attestation = alice.identifiers[0].attestation
+	if err := alice.requestContrainingKeys(ctx, parameters, endpoints); err == nil {
+		t.Errorf("Servers signed a batch holding an identifier that was not attested")
+	}
+
+	// Batches are bounded
+	var oversized batchInTransport
+	for i := 0; i <= maxBatchSize; i++ {
+		oversized.Requests = append(oversized.Requests, keysInTransport{})
+	}
+	if _, err := endpoints[0].requestSignatures(ctx, oversized); err == nil {
+		t.Errorf("Server signed an oversized batch")
+	}
+}
+
+func TestShareCollectionTimeout(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2)
+	parameters, endpoints := d.parameters, d.endpoints
+
+	// Server 0 never answers
+	release := make(chan struct{})
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer dead.Close()
+	defer close(release)
+	endpoints[0] = newServerEndpoint(0, dead.URL)
+
+	u := newUser(parameters, "alice", []string{"bob"})
+	d.attest(t, u)
+
+	// The honest servers are enough to meet the threshold
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := u.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without them, the request gives up at the deadline and reports the dead server
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := u.requestContrainingKeys(ctx, parameters, endpoints[:2]); err == nil {
+		t.Errorf("Recovered keys from fewer than a threshold of servers")
+	}
+	if u.faultyServers[0] != errServerTimeout {
+		t.Errorf("Dead server was not reported as timed out: %v", u.faultyServers)
+	}
+
+	// A request cancelled by the caller does not blame the servers
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if err := u.requestContrainingKeys(ctx, parameters, endpoints[:2]); !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancelled request returned %v", err)
+	}
+	if len(u.faultyServers) != 0 {
+		t.Errorf("Servers blamed for a cancelled request: %v", u.faultyServers)
+	}
+}
+
+func TestLateInvalidShareReported(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2, corruptServer1)
+	parameters, endpoints := d.parameters, d.endpoints
+
+	// The bad server answers after the honest ones have met the threshold
+	bad := endpoints[1].Address
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		http.Redirect(w, r, bad+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	defer slow.Close()
+	endpoints[1] = newServerEndpoint(1, slow.URL)
+
+	u := newUser(parameters, "alice", []string{"bob"})
+	d.attest(t, u)
+	if err := u.requestContrainingKeys(context.Background(), parameters, endpoints); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := u.faultyServers[1]; !found || len(u.faultyServers) != 1 {
+		t.Errorf("Late invalid share was not reported: %v", u.faultyServers)
+	}
+}
+
+func TestQuotaEnforced(t *testing.T) {
+	clock := quota.NewFakeClock(time.Now())
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2, func(d *testDeployment) {
+		for _, s := range d.servers {
+			s.limiter = quota.New(quota.Config{Rate: 1, Burst: 2, MaxIdentifiers: 2, Clock: clock})
+		}
+	})
+	parameters, endpoints, issuer := d.parameters, d.endpoints, d.issuer
+	ctx := context.Background()
+	var err error
+
+	// An account enumerating identifiers is stopped at the cap
+	for i, id := range []string{"+447700900001", "+447700900002", "+447700900003"} {
+		u := newUser(parameters, id, nil)
+		if u.identifiers[0].attestation, err = issuer.IssueForAccount(ctx, "mallory", u.epoch, id); err != nil {
+			t.Fatal(err)
+		}
+		// Let the rate limit recover so that only the identifier cap is hit
+		clock.Advance(time.Hour)
+
+		err := u.requestContrainingKeys(ctx, parameters, endpoints)
+		if i < 2 && err != nil {
+			t.Errorf("Request for identifier %d was refused: %s", i, err)
+		} else if i == 2 && err == nil {
+			t.Errorf("Keys were issued for more identifiers than the cap")
+		}
+	}
+
+	// Repeated requests for the same identifier hit the rate limit
+	alice := newUser(parameters, "alice", nil)
+	if err := alice.attest(ctx, issuer); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := alice.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+			t.Fatalf("Request %d within the burst was refused: %s", i, err)
+		}
+	}
+	if err := alice.requestContrainingKeys(ctx, parameters, endpoints); err == nil {
+		t.Errorf("Request over the rate limit was served")
+	}
+
+	// Rejections show up in the metrics
+	resp, err := http.Get(endpoints[0].Address + metricsEndpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var metrics quota.Metrics
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.TooManyIdentifiers == 0 || metrics.RateLimited == 0 {
+		t.Errorf("Rejections missing from the metrics: %+v", metrics)
+	}
+}
+
+func TestRejectedRequestsAreFree(t *testing.T) {
+	clock := quota.NewFakeClock(time.Now())
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2, func(d *testDeployment) {
+		for _, s := range d.servers {
+			s.limiter = quota.New(quota.Config{Rate: 1, Burst: 2, MaxIdentifiers: 2, Clock: clock})
+		}
+	})
+	parameters, s := d.parameters, d.servers[0]
+	ctx := context.Background()
+
+	requests := make([]keysInTransport, 3)
+	for i, id := range []string{"+447700900001", "+447700900002", "+447700900003"} {
+		epoch := parameters.currentEpoch()
+		credential, err := d.issuer.IssueForAccount(ctx, "mallory", epoch, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := newBlindedRequest(parameters, crypto.DerivePublicKeys(parameters.Suite, epoch, id), credential)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests[i] = b.request
+	}
+
+	// The third identifier goes over the cap, so the first two must not be charged either
+	if _, err := s.signBatch(parameters, batchInTransport{Requests: requests}); !errors.Is(err, quota.ErrTooManyIdentifiers) {
+		t.Fatalf("Batch over the identifier cap was not rejected: %v", err)
+	}
+	if _, err := s.signBatch(parameters, batchInTransport{Requests: requests[:2]}); err != nil {
+		t.Errorf("Rejected batch used up quota: %s", err)
+	}
+}
+
+func TestKeystoreRestart(t *testing.T) {
+	var parameters publicParameters
+	parameters.TotalServers = 3
+	parameters.Threshold = 2
+	parameters.Suite = bn256.NewSuite()
+
+	serverList, pub1, pub2, err := setupThresholdServers(parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passphrase := []byte("correct horse battery staple")
+
+	if keystoresExist(parameters, dir) {
+		t.Errorf("Empty directory reported as holding keystores")
+	}
+	if err := saveServerKeys(parameters, serverList, dir, passphrase); err != nil {
+		t.Fatal(err)
+	}
+	if !keystoresExist(parameters, dir) {
+		t.Errorf("Saved keystores were not found")
+	}
+
+	// A restart restores the same shares and public polynomials
+	restored, restoredPub1, restoredPub2, err := loadThresholdServers(parameters, dir, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restoredPub1.Equal(pub1) || !restoredPub2.Equal(pub2) {
+		t.Errorf("Public polynomials were not restored")
+	}
+	for i, s := range restored {
+		if s.ID != serverList[i].ID || !s.keys[0].V.Equal(serverList[i].keys[0].V) || s.keys[0].I != serverList[i].keys[0].I {
+			t.Errorf("Server %d was not restored", i)
+		}
+	}
+
+	if _, _, _, err := loadThresholdServers(parameters, dir, []byte("wrong")); err == nil {
+		t.Errorf("Keystores loaded with the wrong passphrase")
+	}
+
+	// Restored servers can refresh their shares, unless they were not given a reshare token
+	parameters.PublicPolynomials[0], parameters.PublicPolynomials[1] = restoredPub1, restoredPub2
+	for _, s := range restored[1:] {
+		s.resharing = newReshareState([]byte(testReshareToken))
+	}
+	endpoints, shutdown, err := startLoopbackServers(parameters, restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown()
+	if _, _, err := reshare(context.Background(), parameters, coordinator(endpoints), coordinator(endpoints), 2); err == nil {
+		t.Errorf("A server without a reshare token took part in a reshare")
+	}
+	restored[0].resharing = newReshareState([]byte(testReshareToken))
+	restarted, shutdown2, err := startLoopbackServers(parameters, restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown2()
+	if _, _, err := reshare(context.Background(), parameters, coordinator(restarted), coordinator(restarted), 2); err != nil {
+		t.Errorf("Could not reshare after a restart: %s", err)
+	}
+
+	commitments, err := exportCommitments(parameters, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range commitments {
+		if !pub1.Eval(c.Index).V.Equal(c.Shares[0].V) || !pub2.Eval(c.Index).V.Equal(c.Shares[1].V) {
+			t.Errorf("Server %d: exported commitments do not match the public polynomials", c.ServerID)
+		}
+	}
+}
+
+func TestProfileResume(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2)
+	parameters, endpoints := d.parameters, d.endpoints
+	fingerprint, err := publicKeyFingerprint(parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	onlineCache := meetingstore.NewMemoryStore()
+	alice := newUser(parameters, "alice", []string{"bob", "carol"})
+	bob := newUser(parameters, "bob", []string{"alice"})
+	d.attest(t, alice, bob)
+	for _, u := range []*user{alice, bob} {
+		if err := u.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+			t.Fatal(err)
+		}
+		if err := u.computeSharedKeys(parameters); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := alice.checkContacts(ctx, onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := bob.checkContacts(ctx, onlineCache); err != nil || len(found) != 1 {
+		t.Fatalf("Bob did not find alice: %v", err)
+	}
+
+	// Bob's state survives a round trip through his profile
+	p, err := bob.toProfile(fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := userFromProfile(parameters, fingerprint, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !restored.identifiers[0].constrainingKeys.Left.Equal(bob.identifiers[0].constrainingKeys.Left) || !restored.identifiers[0].constrainingKeys.Right.Equal(bob.identifiers[0].constrainingKeys.Right) {
+		t.Errorf("Constraining keys were not restored")
+	}
+	if !restored.contactPresence["alice"] || !restored.discoveredAt["alice"].Equal(bob.discoveredAt["alice"]) {
+		t.Errorf("Discovery status was not restored")
+	}
+	if keys, found := restored.sharedKeys[meeting{"bob", "alice"}]; !found || !keys.Outgoing.Equal(bob.sharedKeys[meeting{"bob", "alice"}].Outgoing) {
+		t.Errorf("Shared keys were not restored")
+	}
+
+	// Contacts already found are not checked again
+	if found, err := restored.checkContacts(ctx, onlineCache); err != nil || len(found) != 0 {
+		t.Errorf("Found contacts were checked again: %v %v", found, err)
+	}
+
+	if _, err := userFromProfile(parameters, "00000000000000000000000000000000", p); err == nil {
+		t.Errorf("Profile accepted under other public parameters")
+	}
+}
+
+func TestMultipleIdentifiers(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2)
+	parameters, endpoints := d.parameters, d.endpoints
+	fingerprint, err := publicKeyFingerprint(parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice knows both of bob's identifiers, bob only knows alice's email address
+	ctx := context.Background()
+	onlineCache := meetingstore.NewMemoryStore()
+	alice := newUser(parameters, "tel:+447700900123", []string{"bob@example.org", "+447700900456"})
+	bob := newUser(parameters, "tel:+447700900456", []string{"alice@example.org"})
+	if err := alice.addIdentifier(parameters, "alice@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.addIdentifier(parameters, "bob@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.addIdentifier(parameters, "alice@example.org"); err == nil {
+		t.Errorf("The same identifier was added twice")
+	}
+	d.attest(t, alice, bob)
+	for _, u := range []*user{alice, bob} {
+		if err := u.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+			t.Fatal(err)
+		}
+		if err := u.computeSharedKeys(parameters); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(alice.sharedKeys) != 4 || len(bob.sharedKeys) != 2 {
+		t.Fatalf("Expected keys for every pair of identifiers, got %d and %d", len(alice.sharedKeys), len(bob.sharedKeys))
+	}
+
+	// Bob leaves his card at the meeting points shared with alice's email address, alice finds it under
+	// both of bob's identifiers
+	if _, err := bob.checkContacts(ctx, onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	found, err := alice.checkContacts(ctx, onlineCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []match{{card: "tel:+447700900456", contacts: []string{"bob@example.org", "+447700900456"}, own: []string{"mailto:alice@example.org"}}}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("Found %v, want %v", found, want)
+	}
+	if string(alice.contactCards["bob@example.org"]) != "tel:+447700900456" {
+		t.Errorf("Alice did not receive bob's card: %q", alice.contactCards["bob@example.org"])
+	}
+
+	// The keys of every identifier and which identifier matched survive a round trip through the profile
+	p, err := alice.toProfile(fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := userFromProfile(parameters, fingerprint, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.identifiers) != 2 || !restored.identifiers[1].constrainingKeys.Left.Equal(alice.identifiers[1].constrainingKeys.Left) {
+		t.Errorf("Identifiers were not restored")
+	}
+	if len(restored.sharedKeys) != 4 || restored.matchedBy["+447700900456"] != "mailto:alice@example.org" {
+		t.Errorf("Discovery state was not restored")
+	}
+
+	// Removing a contact withdraws the payloads alice left under each of her identifiers
+	if _, err := alice.removeContacts(ctx, onlineCache, []string{"bob@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	_, point, _, _ := restored.meetingPoint("tel:+447700900123", "bob@example.org")
+	if _, err := onlineCache.Get(ctx, point); err != meetingstore.ErrNotFound {
+		t.Errorf("Payload was not withdrawn: %v", err)
+	}
+	if len(alice.sharedKeys) != 2 {
+		t.Errorf("Keys of the removed contact were kept")
+	}
+}
+
+func TestNormalisedContacts(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2)
+	parameters, endpoints := d.parameters, d.endpoints
+
+	// Each writes the other's identifier their own way
+	ctx := context.Background()
+	onlineCache := meetingstore.NewMemoryStore()
+	alice := newUser(parameters, "tel:+447700900123", []string{"Bob@Example.org"})
+	bob := newUser(parameters, "mailto:bob@example.org", []string{"07700 900123"})
+	bob.region = "GB"
+	d.attest(t, alice, bob)
+	for _, u := range []*user{alice, bob} {
+		if err := u.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+			t.Fatal(err)
+		}
+		if err := u.computeSharedKeys(parameters); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Bob leaves his card for alice's national number, alice finds it under bob's capitalised address
+	if _, err := bob.checkContacts(ctx, onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.checkContacts(ctx, onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	if !alice.contactPresence["Bob@Example.org"] || string(alice.contactCards["Bob@Example.org"]) != "mailto:bob@example.org" {
+		t.Errorf("Alice did not find bob: %q", alice.contactCards["Bob@Example.org"])
+	}
+
+	// Without a default region a national number is ambiguous and refused
+	if _, err := alice.addContacts(parameters, []string{"carol", "07700 900456"}); err == nil {
+		t.Errorf("National number was accepted without a default region")
+	}
+	if _, known := alice.contactPresence["carol"]; known {
+		t.Errorf("Contacts were added alongside a refused one")
+	}
+
+	// Identifiers added to an account are normalised as well
+	if err := alice.addIdentifier(parameters, "ALICE@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if alice.identifier("mailto:alice@example.org") == nil {
+		t.Errorf("Added identifier was not normalised")
+	}
+}
+
+func TestContactSync(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2)
+	parameters, endpoints := d.parameters, d.endpoints
+
+	// users share the store over HTTP without its token: they may only withdraw their own payloads
+	ctx := context.Background()
+	backend := meetingstore.NewMemoryStore()
+	ts := httptest.NewServer(meetingstore.NewHandler(backend, nil))
+	defer ts.Close()
+	onlineCache := meetingstore.NewHTTPStore(ts.URL, nil)
+	alice := newUser(parameters, "alice", nil)
+	bob := newUser(parameters, "bob", []string{"alice"})
+	d.attest(t, alice, bob)
+	for _, u := range []*user{alice, bob} {
+		if err := u.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if added, err := alice.addContacts(parameters, []string{"bob", "carol", "bob"}); err != nil || len(added) != 2 {
+		t.Fatalf("Expected 2 contacts added, got %v %v", added, err)
+	}
+	if _, err := alice.checkContacts(ctx, onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	carolKeys := alice.sharedKeys[meeting{"alice", "carol"}]
+
+	// Only the new contact gets fresh keys
+	added, removed := alice.diffContacts([]string{"carol", "dave"})
+	if len(added) != 1 || added[0] != "dave" || len(removed) != 1 || removed[0] != "bob" {
+		t.Errorf("Unexpected diff: added %v, removed %v", added, removed)
+	}
+	if _, _, err := alice.syncContacts(ctx, parameters, onlineCache, []string{"carol", "dave"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(alice.contacts) != 2 || alice.sharedKeys[meeting{"alice", "carol"}].Outgoing != carolKeys.Outgoing {
+		t.Errorf("Known contacts were recomputed")
+	}
+	if _, found := alice.sharedKeys[meeting{"alice", "dave"}]; !found {
+		t.Errorf("No shared keys for the new contact")
+	}
+	if _, found := alice.sharedKeys[meeting{"alice", "bob"}]; found {
+		t.Errorf("Removed contact was not forgotten")
+	}
+
+	// Bob arrives after alice removed him and does not find her
+	if err := bob.computeSharedKeys(parameters); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.checkContacts(ctx, onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	if bob.contactPresence["alice"] {
+		t.Errorf("Bob discovered alice after she removed him")
+	}
+
+	// Alice's payload for carol is still there, bob's payload for alice is not hers to withdraw
+	points, _ := backend.List(ctx)
+	if len(points) != 2 {
+		t.Errorf("Expected 2 meeting points, got %d", len(points))
+	}
+	if _, err := alice.removeContacts(ctx, onlineCache, []string{"carol"}); err != nil {
+		t.Fatal(err)
+	}
+	if points, _ := backend.List(ctx); len(points) != 1 {
+		t.Errorf("Meeting point was not withdrawn")
+	}
+}
+
+func TestParametersEncoding(t *testing.T) { forEachSuite(t, testParametersEncoding) }
+
+func testParametersEncoding(t *testing.T, suite pairing.Suite) {
+	var parameters publicParameters
+	parameters.TotalServers = 3
+	parameters.Threshold = 2
+	parameters.Suite = suite
+
+	_, pub1, pub2, err := setupThresholdServers(parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters.PublicPolynomials[0], parameters.PublicPolynomials[1] = pub1, pub2
+	parameters.EpochLength = 24 * time.Hour
+	endpoints := []*serverEndpoint{
+		newServerEndpoint(0, "cd0.example.org:8000"),
+		newServerEndpoint(1, "cd1.example.org:8000"),
+		newServerEndpoint(2, "cd2.example.org:8000"),
+	}
+
+	fingerprint, err := parametersFingerprint(parameters, endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reordered, _ := parametersFingerprint(parameters, []*serverEndpoint{endpoints[2], endpoints[0], endpoints[1]})
+	if reordered != fingerprint {
+		t.Errorf("Fingerprint depends on the order of the endpoints")
+	}
+
+	jsonEncoded, err := marshalParametersJSON(parameters, endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binaryEncoded, err := marshalParametersBinary(parameters, endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoders := map[string]func([]byte, string) (publicParameters, []*serverEndpoint, error){
+		"json":   unmarshalParametersJSON,
+		"binary": unmarshalParametersBinary,
+	}
+	encoded := map[string][]byte{"json": jsonEncoded, "binary": binaryEncoded}
+	for name, decode := range decoders {
+		decoded, decodedEndpoints, err := decode(encoded[name], fingerprint)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if decoded.Threshold != 2 || decoded.TotalServers != 3 || decoded.EpochLength != 24*time.Hour || !decoded.PublicPolynomials[0].Equal(pub1) || !decoded.PublicPolynomials[1].Equal(pub2) {
+			t.Errorf("%s: parameters were not restored", name)
+		}
+		if got, want := fmt.Sprintf("%T", decoded.Suite), fmt.Sprintf("%T", suite); got != want {
+			t.Errorf("%s: decoded a %s suite, want %s", name, got, want)
+		}
+		if len(decodedEndpoints) != 3 || decodedEndpoints[1].Address != endpoints[1].Address {
+			t.Errorf("%s: endpoints were not restored", name)
+		}
+		if _, _, err := decode(encoded[name], "00000000000000000000000000000000"); err == nil {
+			t.Errorf("%s: parameters accepted with the wrong fingerprint", name)
+		}
+	}
+
+	// A version 1 file listing the servers out of order has the fingerprint of the same parameters computed
+	// by enroll and discover, which pin it in profiles
+	var bundle parametersBundle
+	if err := json.Unmarshal(jsonEncoded, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	bundle.Version, bundle.EpochLength = 1, 0
+	bundle.Servers[0], bundle.Servers[2] = bundle.Servers[2], bundle.Servers[0]
+	v1JSON, _ := json.Marshal(bundle)
+	v1Binary, _ := bundle.marshalBinary()
+	v1Parameters := parameters
+	v1Parameters.EpochLength = 0
+	v1Fingerprint, err := parametersFingerprint(v1Parameters, endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, encoded := range map[string][]byte{"json": v1JSON, "binary": v1Binary} {
+		decoded, decodedEndpoints, err := decoders[name](encoded, v1Fingerprint)
+		if err != nil {
+			t.Errorf("%s: version 1 parameters do not match their fingerprint: %s", name, err)
+			continue
+		}
+		if computed, _ := parametersFingerprint(decoded, decodedEndpoints); computed != v1Fingerprint {
+			t.Errorf("%s: fingerprint of the decoded parameters %s differs from the pinned %s", name, computed, v1Fingerprint)
+		}
+	}
+
+	// Parameters with inconsistent polynomials are rejected even without a pinned fingerprint
+	if err := json.Unmarshal(jsonEncoded, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	bundle.Commitments[1][0], _ = parameters.Suite.G1().Point().Pick(random.New()).MarshalBinary()
+	tampered, _ := json.Marshal(bundle)
+	if _, _, err := unmarshalParametersJSON(tampered, ""); err == nil {
+		t.Errorf("Inconsistent public polynomials were accepted")
+	}
+
+	// So are server lists that do not match the committee
+	malformed := map[string][]serverInfo{
+		"missing server":  {{0, "a"}, {1, "b"}},
+		"extra server":    {{0, "a"}, {1, "b"}, {2, "c"}, {3, "d"}},
+		"duplicate ID":    {{0, "a"}, {1, "b"}, {1, "c"}},
+		"ID out of range": {{0, "a"}, {1, "b"}, {3, "c"}},
+		"negative ID":     {{-1, "a"}, {0, "b"}, {1, "c"}},
+	}
+	for name, servers := range malformed {
+		if err := json.Unmarshal(jsonEncoded, &bundle); err != nil {
+			t.Fatal(err)
+		}
+		bundle.Servers = servers
+		if _, _, err := bundle.decode(); err == nil {
+			t.Errorf("Parameters with a %s were accepted", name)
+		}
+	}
+}
+
+func TestEpochs(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2, func(d *testDeployment) { d.parameters.EpochLength = time.Hour })
+	parameters, endpoints := d.parameters, d.endpoints
+
+	current := parameters.currentEpoch()
+	if end := parameters.epochEnd(current); parameters.epochAt(end) != current+1 || parameters.epochAt(end.Add(-time.Nanosecond)) != current {
+		t.Errorf("Epoch %d does not end at %s", current, end)
+	}
+
+	ctx := context.Background()
+	onlineCache := meetingstore.NewMemoryStore()
+	alice := newUser(parameters, "alice", []string{"bob"})
+	bob := newUser(parameters, "bob", []string{"alice"})
+	d.attest(t, alice, bob)
+	for _, u := range []*user{alice, bob} {
+		if err := u.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+			t.Fatal(err)
+		}
+		if err := u.computeSharedKeys(parameters); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Servers only sign for the current and the next epoch
+	for _, epoch := range []uint64{current - 1, current + 2} {
+		alice.startEpoch(parameters, epoch)
+		d.attest(t, alice)
+		if err := alice.requestContrainingKeys(ctx, parameters, endpoints); err == nil {
+			t.Errorf("Servers signed for epoch %d during epoch %d", epoch, current)
+		}
+	}
+
+	// Keys obtained for the next epoch meet at other meeting points
+	alice.startEpoch(parameters, current+1)
+	d.attest(t, alice)
+	if err := alice.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.computeSharedKeys(parameters); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.checkContacts(ctx, onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.checkContacts(ctx, onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	if bob.contactPresence["alice"] {
+		t.Errorf("Bob found alice across epochs")
+	}
+	points, _ := onlineCache.List(ctx)
+	if len(points) != 2 {
+		t.Fatalf("Expected a meeting point in each epoch, got %v", points)
+	}
+	for _, point := range points {
+		if epoch, ok := meetingstore.PointEpoch(point); !ok || (epoch != current && epoch != current+1) {
+			t.Errorf("Meeting point %s is not namespaced by the epoch", point)
+		}
+	}
+
+	// Once the next epoch starts, the meeting point of the current one is collected
+	if deleted, err := meetingstore.CollectGarbage(ctx, onlineCache, current+1); err != nil || deleted != 1 {
+		t.Errorf("Expected one meeting point collected, got %d: %v", deleted, err)
+	}
+}
+
+func TestEpochKeysDoNotCarryOver(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2, func(d *testDeployment) { d.parameters.EpochLength = time.Hour })
+	parameters, endpoints, issuer := d.parameters, d.endpoints, d.issuer
+	current := parameters.currentEpoch()
+
+	ctx := context.Background()
+	onlineCache := meetingstore.NewMemoryStore()
+	alice := newUser(parameters, "alice", []string{"bob"})
+	bob := newUser(parameters, "bob", []string{"alice"})
+	d.attest(t, alice)
+	if err := alice.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+		t.Fatal(err)
+	}
+	bob.startEpoch(parameters, current+1)
+	d.attest(t, bob)
+	if err := bob.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.computeSharedKeys(parameters); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice keeps her keys of the current epoch into the next one: they do not reach bob's meeting points
+	kept := alice.identifiers[0].constrainingKeys
+	credential := alice.identifiers[0].attestation
+	alice.startEpoch(parameters, current+1)
+	alice.identifiers[0].constrainingKeys = kept
+	if err := alice.computeSharedKeys(parameters); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*user{alice, bob} {
+		if _, err := u.checkContacts(ctx, onlineCache); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if alice.contactPresence["bob"] || bob.contactPresence["alice"] {
+		t.Errorf("Keys of epoch %d met at the meeting points of epoch %d", current, current+1)
+	}
+
+	// Her credential of the current epoch does not get her the keys of the next one
+	b, err := newBlindedRequest(parameters, alice.identifiers[0].publicKeys, credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.servers[0].sign(parameters, b.request); !errors.Is(err, errNotAttested) {
+		t.Errorf("Server signed the next epoch's keys with a credential of the current epoch: %v", err)
+	}
+
+	// Neither does a credential for an epoch the servers do not sign in yet
+	for _, epoch := range []uint64{current - 1, current + 2} {
+		ahead, err := issuer.Issue(ctx, epoch, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := newBlindedRequest(parameters, crypto.DerivePublicKeys(parameters.Suite, epoch, "alice"), ahead)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.servers[0].sign(parameters, b.request); !errors.Is(err, errWrongEpoch) {
+			t.Errorf("Server signed for epoch %d during epoch %d: %v", epoch, current, err)
+		}
+	}
+
+	// Keys obtained for the next epoch do meet bob
+	d.attest(t, alice)
+	if err := alice.requestContrainingKeys(ctx, parameters, endpoints); err != nil {
+		t.Fatal(err)
+	}
+	delete(alice.sharedKeys, meeting{"alice", "bob"})
+	if err := alice.computeSharedKeys(parameters); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.checkContacts(ctx, onlineCache); err != nil {
+		t.Fatal(err)
+	}
+	if !alice.contactPresence["bob"] {
+		t.Errorf("Alice did not find bob with the keys of epoch %d", current+1)
+	}
+}
+
+func TestCLI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passphraseFile := filepath.Join(dir, "passphrase")
+	ioutil.WriteFile(passphraseFile, []byte("correct horse battery staple\n"), 0600)
+
+	// Reserve the servers' ports before setup writes them to the parameters
+	listeners := make([]net.Listener, 3)
+	addresses := make([]string, 3)
+	for i := range listeners {
+		if listeners[i], err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		defer listeners[i].Close()
+		addresses[i] = listeners[i].Addr().String()
+	}
+
+	var out bytes.Buffer
+	err = run([]string{"setup", "-servers", "3", "-threshold", "2", "-out", dir, "-addresses", strings.Join(addresses, ","), "-passphrase-file", passphraseFile, "-epoch-length", "24h"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := out.String()[strings.LastIndex(out.String(), " ")+1:]
+	fingerprint = strings.TrimSpace(fingerprint)
+
+	passphrase, _ := readPassphrase(passphraseFile)
+	tokenFile := filepath.Join(dir, "reshare-token")
+	ioutil.WriteFile(tokenFile, []byte(testReshareToken+"\n"), 0600)
+	for i, l := range listeners {
+		s, parameters, _, err := loadServer(serverOptions{
+			parameters:      filepath.Join(dir, parametersFile),
+			fingerprint:     fingerprint,
+			keystore:        dir,
+			id:              i,
+			issuerPublicKey: filepath.Join(dir, issuerPublicKeyFile),
+			passphrase:      passphrase,
+			reshareToken:    []byte(testReshareToken),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.serve(parameters, l)
+	}
+
+	if _, _, _, err := loadServer(serverOptions{
+		parameters:      filepath.Join(dir, parametersFile),
+		fingerprint:     fingerprint,
+		keystore:        dir,
+		issuerPublicKey: filepath.Join(dir, parametersFile),
+		passphrase:      passphrase,
+	}); err == nil {
+		t.Errorf("Server started without a valid identity provider public key")
+	}
+
+	// Only the identity provider holds the key written by setup, the servers hold its public key
+	stub, err := loadStubIssuer(filepath.Join(dir, issuerFile), bn256.NewSuite())
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := httptest.NewServer(identity.NewHandler(stub))
+	defer issuer.Close()
+
+	// Flags shared by the client commands come from a config file
+	config := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(config, []byte(`{
+		"parameters": "`+filepath.Join(dir, parametersFile)+`",
+		"fingerprint": "`+fingerprint+`",
+		"issuer": "`+issuer.URL+`",
+		"store": "`+filepath.Join(dir, "meetings.log")+`",
+		"passphrase-file": "`+passphraseFile+`",
+		"enroll": {"timeout": "5s"}
+	}`), 0600)
+
+	for _, id := range []string{"alice", "bob"} {
+		if err := run([]string{"enroll", "-config", config, "-id", id, "-profile", filepath.Join(dir, id+".profile")}, ioutil.Discard); err != nil {
+			t.Fatalf("enroll %s: %s", id, err)
+		}
+	}
+
+	out.Reset()
+	if err := run([]string{"discover", "-config", config, "-profile", filepath.Join(dir, "alice.profile"), "-contacts", "bob,carol"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Found 0 of 2 contacts") {
+		t.Errorf("Unexpected discovery for alice: %s", out.String())
+	}
+	out.Reset()
+	if err := run([]string{"discover", "-config", config, "-profile", filepath.Join(dir, "bob.profile"), "-contacts", "alice"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Found 1 of 1 contacts") {
+		t.Errorf("Bob did not find alice: %s", out.String())
+	}
+	// Contacts are saved in the profile and need not be listed again
+	out.Reset()
+	if err := run([]string{"discover", "-config", config, "-profile", filepath.Join(dir, "bob.profile")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "alice is on the service") || !strings.Contains(out.String(), "Found 1 of 1 contacts") {
+		t.Errorf("Bob's discovery state was not saved: %s", out.String())
+	}
+	out.Reset()
+	if err := run([]string{"discover", "-config", config, "-profile", filepath.Join(dir, "alice.profile"), "-sync", "-contacts", "carol"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Removed bob") || !strings.Contains(out.String(), "Found 0 of 1 contacts") {
+		t.Errorf("Alice's address book was not synced: %s", out.String())
+	}
+	// Enrolling again, as at the start of an epoch, keeps the contacts
+	if err := run([]string{"enroll", "-config", config, "-profile", filepath.Join(dir, "alice.profile")}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := run([]string{"discover", "-config", config, "-profile", filepath.Join(dir, "alice.profile")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Found 0 of 1 contacts") {
+		t.Errorf("Contacts were lost when enrolling again: %s", out.String())
+	}
+	// Alice adds her email address, which carol knows her by
+	if err := run([]string{"enroll", "-config", config, "-id", "alice,alice@example.org", "-profile", filepath.Join(dir, "alice.profile")}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"enroll", "-config", config, "-id", "carol", "-profile", filepath.Join(dir, "carol.profile")}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"discover", "-config", config, "-profile", filepath.Join(dir, "carol.profile"), "-contacts", "alice@example.org"}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := run([]string{"discover", "-config", config, "-profile", filepath.Join(dir, "alice.profile")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "found with your identifier mailto:alice@example.org") || !strings.Contains(out.String(), "Found 1 of 1 contacts") {
+		t.Errorf("Carol was not found under alice's email address: %s", out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"inspect", "-config", config}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), fingerprint) || !strings.Contains(out.String(), "2 of 3 servers") {
+		t.Errorf("Unexpected inspect output: %s", out.String())
+	}
+
+	// A flag given on the command line takes precedence over the config file
+	if err := run([]string{"inspect", "-config", config, "-fingerprint", "00000000000000000000000000000000"}, ioutil.Discard); err == nil {
+		t.Errorf("Parameters accepted with the wrong fingerprint")
+	}
+	if err := run([]string{"frobnicate"}, ioutil.Discard); err == nil {
+		t.Errorf("Unknown command accepted")
+	}
+
+	// A new server replaces server 0. The servers save their new shares under their new IDs
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	joining, parameters, _, err := loadServer(serverOptions{
+		parameters:      filepath.Join(dir, parametersFile),
+		fingerprint:     fingerprint,
+		keystore:        dir,
+		id:              3,
+		issuerPublicKey: filepath.Join(dir, issuerPublicKeyFile),
+		passphrase:      passphrase,
+		join:            true,
+		reshareToken:    []byte(testReshareToken),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go joining.serve(parameters, l)
+	out.Reset()
+	committee := strings.Join([]string{addresses[1], addresses[2], l.Addr().String()}, ",")
+	if err := run([]string{"reshare", "-config", config, "-addresses", committee, "-token-file", tokenFile}, &out); err != nil {
+		t.Fatal(err)
+	}
+	reshared := strings.TrimSpace(out.String()[strings.LastIndex(out.String(), " ")+1:])
+	if reshared == fingerprint {
+		t.Errorf("Parameters fingerprint did not change with the committee")
+	}
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := loadServer(serverOptions{
+			parameters:      filepath.Join(dir, parametersFile),
+			fingerprint:     reshared,
+			keystore:        dir,
+			id:              i,
+			issuerPublicKey: filepath.Join(dir, issuerPublicKeyFile),
+			passphrase:      passphrase,
+		}); err != nil {
+			t.Errorf("Server %d cannot restart after the reshare: %s", i, err)
+		}
+	}
+
+	// Profiles saved before the reshare remain valid, and the new committee issues keys
+	out.Reset()
+	if err := run([]string{"discover", "-config", config, "-fingerprint", reshared, "-profile", filepath.Join(dir, "bob.profile")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Found 1 of 1 contacts") {
+		t.Errorf("Bob's profile did not survive the reshare: %s", out.String())
+	}
+	if err := run([]string{"enroll", "-config", config, "-fingerprint", reshared, "-id", "dave", "-profile", filepath.Join(dir, "dave.profile")}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"discover", "-config", config, "-fingerprint", reshared, "-profile", filepath.Join(dir, "dave.profile"), "-contacts", "alice"}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := run([]string{"discover", "-config", config, "-fingerprint", reshared, "-profile", filepath.Join(dir, "alice.profile"), "-contacts", "dave"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "dave is on the service") {
+		t.Errorf("Alice did not find dave, enrolled with the new committee: %s", out.String())
+	}
+}
+
+func TestLoadgen(t *testing.T) {
+	d := newTestDeployment(t, bn256.NewSuite(), 3, 2)
+	parameters, endpoints := d.parameters, d.endpoints
+
+	report, err := generateLoad(context.Background(), parameters, endpoints, d.issuer, "loadgen", 6, 3, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.latencies) != 6 || len(report.failures) != 0 {
+		t.Errorf("Expected 6 successful enrolments, got %d and failures %v", len(report.latencies), report.failures)
+	}
+	if report.percentile(0.5) > report.percentile(0.99) || report.percentile(0.99) != report.latencies[5] {
+		t.Errorf("Percentiles are out of order")
+	}
+
+	var out bytes.Buffer
+	report.print(&out)
+	if !strings.Contains(out.String(), "6 enrolments") || !strings.Contains(out.String(), "p99") {
+		t.Errorf("Unexpected report: %s", out.String())
+	}
+}
+
+// BenchmarkRequestConstrainingKeys measures a full enrolment round against 2-of-3 loopback servers
+func BenchmarkRequestConstrainingKeys(b *testing.B) {
+	d := newTestDeployment(b, bn256.NewSuite(), 3, 2)
+	parameters, endpoints := d.parameters, d.endpoints
+
+	alice := newUser(parameters, "alice", nil)
+	d.attest(b, alice)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := alice.requestContrainingKeys(context.Background(), parameters, endpoints); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,15 +1,42 @@
 package main
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"github.com/nmohnblatt/contact_discovery2/meetingstore"
 )
 
-type meetingPlatform map[string][]byte
+// createMeetingPoint returns the address of the meeting point identified by a tag output by the KDF during
+// epoch. The address is namespaced by the epoch so that the store can drop the points of past epochs
+func createMeetingPoint(epoch uint64, tag []byte) string {
+	return meetingstore.EpochPoint(epoch, hex.EncodeToString(tag))
+}
 
-func createMeetingPoint(keymaterial []byte) string {
-	h := sha256.New()
-	h.Write(keymaterial)
+// meetingPointOwner returns the secret tying the payload the user leaves under their identifier own to them.
+// It is derived from the keys shared with the contact so that the payload can be withdrawn in a later run
+func meetingPointOwner(derived crypto.DerivedKeys, own string) []byte {
+	mac := hmac.New(sha256.New, derived.MACKey)
+	mac.Write([]byte("meeting point owner"))
+	mac.Write([]byte(own))
+	return mac.Sum(nil)
+}
+
+// leavePayload puts a payload at a meeting point, as owned by the user if the store is shared
+func leavePayload(ctx context.Context, store meetingstore.MeetingStore, meetingPoint string, payload, owner []byte) error {
+	if owned, ok := store.(meetingstore.OwnedStore); ok {
+		return owned.PutOwned(ctx, meetingPoint, payload, owner)
+	}
+	return store.Put(ctx, meetingPoint, payload)
+}
 
-	return hex.EncodeToString(h.Sum(nil))
+// removePayload deletes the payload the user left at a meeting point
+func removePayload(ctx context.Context, store meetingstore.MeetingStore, meetingPoint string, owner []byte) error {
+	if owned, ok := store.(meetingstore.OwnedStore); ok {
+		return owned.DeleteOwned(ctx, meetingPoint, owner)
+	}
+	return store.Delete(ctx, meetingPoint)
 }
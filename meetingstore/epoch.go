@@ -0,0 +1,49 @@
+package meetingstore
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// EpochPoint namespaces a meeting point by the epoch it was derived in, so that the points of past epochs
+// can be found and removed
+func EpochPoint(epoch uint64, meetingPoint string) string {
+	return strconv.FormatUint(epoch, 10) + "-" + meetingPoint
+}
+
+// PointEpoch returns the epoch of a meeting point built by EpochPoint. ok is false if the meeting point is
+// not namespaced by an epoch
+func PointEpoch(meetingPoint string) (epoch uint64, ok bool) {
+	i := strings.IndexByte(meetingPoint, '-')
+	if i <= 0 {
+		return 0, false
+	}
+	epoch, err := strconv.ParseUint(meetingPoint[:i], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return epoch, true
+}
+
+// CollectGarbage deletes the meeting points of epochs before current, as well as those that are not
+// namespaced by an epoch. It returns the number of meeting points deleted
+func CollectGarbage(ctx context.Context, store MeetingStore, current uint64) (int, error) {
+	points, err := store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, point := range points {
+		if epoch, ok := PointEpoch(point); ok && epoch >= current {
+			continue
+		}
+		if err := store.Delete(ctx, point); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,203 @@
+package meetingstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// record is one line of the append-only log
+type record struct {
+	Op           string `json:"op"`
+	MeetingPoint string `json:"point"`
+	Value        []byte `json:"value,omitempty"`
+}
+
+// FileStore is a MeetingStore backed by an append-only log on disk. The log is replayed when the store
+// is opened, so the content of the store survives restarts
+type FileStore struct {
+	mu     sync.Mutex
+	memory *MemoryStore
+	file   *os.File
+	path   string
+}
+
+// OpenFileStore opens the log at path, creating it if needed, and replays it
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{memory: NewMemoryStore(), file: file, path: path}
+	if err := s.replay(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// replay rebuilds the content of the store from the log. Put and Delete only return once the newline ending
+// their record is on disk, so a last line without one was torn by a crash while it was appended: it is
+// dropped and the log truncated before it. Any other malformed line is corruption and fails the replay
+func (s *FileStore) replay() error {
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(s.file)
+	var offset int64
+	for line := 1; ; line++ {
+		buf, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(buf) > 0 {
+				return s.file.Truncate(offset)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(buf))
+
+		var r record
+		if err := json.Unmarshal(buf, &r); err != nil {
+			return fmt.Errorf("meetingstore: corrupted log at line %d: %v", line, err)
+		}
+
+		switch r.Op {
+		case opPut:
+			s.memory.values[r.MeetingPoint] = r.Value
+		case opDelete:
+			delete(s.memory.values, r.MeetingPoint)
+		default:
+			return fmt.Errorf("meetingstore: unknown operation %q at line %d", r.Op, line)
+		}
+	}
+}
+
+// append writes a record to the log and flushes it to disk
+func (s *FileStore) append(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Put implements MeetingStore
+func (s *FileStore) Put(ctx context.Context, meetingPoint string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(record{Op: opPut, MeetingPoint: meetingPoint, Value: value}); err != nil {
+		return err
+	}
+	return s.memory.Put(ctx, meetingPoint, value)
+}
+
+// Get implements MeetingStore
+func (s *FileStore) Get(ctx context.Context, meetingPoint string) ([]byte, error) {
+	return s.memory.Get(ctx, meetingPoint)
+}
+
+// Delete implements MeetingStore
+func (s *FileStore) Delete(ctx context.Context, meetingPoint string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.memory.Get(ctx, meetingPoint); err == ErrNotFound {
+		return nil
+	}
+	if err := s.append(record{Op: opDelete, MeetingPoint: meetingPoint}); err != nil {
+		return err
+	}
+	return s.memory.Delete(ctx, meetingPoint)
+}
+
+// List implements MeetingStore
+func (s *FileStore) List(ctx context.Context) ([]string, error) {
+	return s.memory.List(ctx)
+}
+
+// Compact rewrites the log with one record per meeting point currently holding a value, dropping the
+// history of deleted and replaced values. The new log replaces the old one atomically
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	s.memory.mu.RLock()
+	w := bufio.NewWriter(tmp)
+	for point, value := range s.memory.values {
+		line, err := json.Marshal(record{Op: opPut, MeetingPoint: point, Value: value})
+		if err != nil {
+			s.memory.mu.RUnlock()
+			tmp.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	s.memory.mu.RUnlock()
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// The new log is opened before it replaces the old one, so that the store keeps appending to the old
+	// log if anything fails
+	file, err := os.OpenFile(tmp.Name(), os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		file.Close()
+		return err
+	}
+	s.file.Close()
+	s.file = file
+	return nil
+}
+
+// Close closes the underlying log
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
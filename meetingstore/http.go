@@ -0,0 +1,288 @@
+package meetingstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// meetingsPath is the prefix under which meeting points are exposed over HTTP
+const meetingsPath = "/meetings/"
+
+// maxValueSize bounds the size of a value accepted by the HTTP handler
+const maxValueSize = 64 * 1024
+
+// ownerHeader carries the hex-encoded secret of the user putting or deleting a value
+const ownerHeader = "Meeting-Owner"
+
+// ownedMagic prefixes the values the handler stores: it is followed by the SHA-256 of the owner's secret, or
+// zeros for a value without owner, then by the value itself
+const ownedMagic = "meetingstore/owned\x00"
+
+// ownedValue wraps a value in the envelope the handler stores
+func ownedValue(value, owner []byte) []byte {
+	envelope := append([]byte(ownedMagic), make([]byte, sha256.Size)...)
+	if len(owner) > 0 {
+		digest := sha256.Sum256(owner)
+		copy(envelope[len(ownedMagic):], digest[:])
+	}
+	return append(envelope, value...)
+}
+
+// openOwnedValue returns the value and the digest of its owner's secret held in a stored envelope. Values left
+// in the store by other means have no owner
+func openOwnedValue(stored []byte) (value, ownerDigest []byte) {
+	if len(stored) < len(ownedMagic)+sha256.Size || !bytes.HasPrefix(stored, []byte(ownedMagic)) {
+		return stored, nil
+	}
+	ownerDigest = stored[len(ownedMagic) : len(ownedMagic)+sha256.Size]
+	if bytes.Equal(ownerDigest, make([]byte, sha256.Size)) {
+		ownerDigest = nil
+	}
+	return stored[len(ownedMagic)+sha256.Size:], ownerDigest
+}
+
+// NewHandler exposes a MeetingStore over HTTP:
+// GET, PUT and DELETE on /meetings/{point} and GET on /meetings/ to list the meeting points.
+// Values are written once and a PUT to an occupied meeting point is refused. A PUT may carry a secret of its
+// owner in the Meeting-Owner header, and only a DELETE presenting the same secret removes the value. Listing
+// the meeting points and deleting any value require the bearer token, neither is possible if token is empty
+func NewHandler(store MeetingStore, token []byte) http.Handler {
+	// mu makes checking a meeting point and writing to it atomic
+	var mu sync.Mutex
+	authorised := func(r *http.Request) bool {
+		presented := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return len(token) > 0 && subtle.ConstantTimeCompare([]byte(presented), token) == 1
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(meetingsPath, func(w http.ResponseWriter, r *http.Request) {
+		meetingPoint := strings.TrimPrefix(r.URL.Path, meetingsPath)
+		ctx := r.Context()
+
+		owner, err := hex.DecodeString(r.Header.Get(ownerHeader))
+		if err != nil {
+			http.Error(w, "meetingstore: invalid owner", http.StatusBadRequest)
+			return
+		}
+
+		if meetingPoint == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "meetingstore: method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if !authorised(r) {
+				http.Error(w, ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+			points, err := store.List(ctx)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(points)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			stored, err := store.Get(ctx, meetingPoint)
+			if err == ErrNotFound {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			value, _ := openOwnedValue(stored)
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(value)
+		case http.MethodPut:
+			value, err := ioutil.ReadAll(io.LimitReader(r.Body, maxValueSize+1))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if len(value) > maxValueSize {
+				http.Error(w, "meetingstore: value too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if _, err := store.Get(ctx, meetingPoint); err == nil {
+				http.Error(w, ErrOccupied.Error(), http.StatusConflict)
+				return
+			} else if err != ErrNotFound {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err := store.Put(ctx, meetingPoint, ownedValue(value, owner)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			mu.Lock()
+			defer mu.Unlock()
+			stored, err := store.Get(ctx, meetingPoint)
+			if err == ErrNotFound {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			_, ownerDigest := openOwnedValue(stored)
+			digest := sha256.Sum256(owner)
+			isOwner := len(owner) > 0 && ownerDigest != nil && subtle.ConstantTimeCompare(digest[:], ownerDigest) == 1
+			if !isOwner && !authorised(r) {
+				http.Error(w, ErrForbidden.Error(), http.StatusForbidden)
+				return
+			}
+			if err := store.Delete(ctx, meetingPoint); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "meetingstore: method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	return mux
+}
+
+// HTTPStore is a MeetingStore client for a store exposed by NewHandler
+type HTTPStore struct {
+	baseURL string
+	token   []byte
+	client  *http.Client
+}
+
+// NewHTTPStore returns a client for the store served at baseURL. token is the bearer token of the store's
+// operator, users leave it empty and may then only delete the values they left with PutOwned
+func NewHTTPStore(baseURL string, token []byte) *HTTPStore {
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		baseURL = "http://" + baseURL
+	}
+
+	return &HTTPStore{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{},
+	}
+}
+
+func (s *HTTPStore) do(ctx context.Context, method, meetingPoint string, body, owner []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.baseURL+meetingsPath+url.PathEscape(meetingPoint), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if len(s.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+string(s.token))
+	}
+	if len(owner) > 0 {
+		req.Header.Set(ownerHeader, hex.EncodeToString(owner))
+	}
+
+	return s.client.Do(req.WithContext(ctx))
+}
+
+// errorFromResponse turns an unexpected HTTP status into an error
+func errorFromResponse(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusConflict:
+		return ErrOccupied
+	case http.StatusForbidden:
+		return ErrForbidden
+	}
+	msg, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("meetingstore: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// Put implements MeetingStore. The value has no owner and only the operator of the store may delete it
+func (s *HTTPStore) Put(ctx context.Context, meetingPoint string, value []byte) error {
+	return s.PutOwned(ctx, meetingPoint, value, nil)
+}
+
+// PutOwned implements OwnedStore
+func (s *HTTPStore) PutOwned(ctx context.Context, meetingPoint string, value, owner []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, meetingPoint, value, owner)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return errorFromResponse(resp)
+	}
+	return nil
+}
+
+// Get implements MeetingStore
+func (s *HTTPStore) Get(ctx context.Context, meetingPoint string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, meetingPoint, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return ioutil.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, errorFromResponse(resp)
+	}
+}
+
+// Delete implements MeetingStore. It needs the operator's token
+func (s *HTTPStore) Delete(ctx context.Context, meetingPoint string) error {
+	return s.DeleteOwned(ctx, meetingPoint, nil)
+}
+
+// DeleteOwned implements OwnedStore
+func (s *HTTPStore) DeleteOwned(ctx context.Context, meetingPoint string, owner []byte) error {
+	resp, err := s.do(ctx, http.MethodDelete, meetingPoint, nil, owner)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return errorFromResponse(resp)
+	}
+	return nil
+}
+
+// List implements MeetingStore. It needs the operator's token
+func (s *HTTPStore) List(ctx context.Context) ([]string, error) {
+	resp, err := s.do(ctx, http.MethodGet, "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorFromResponse(resp)
+	}
+
+	var points []string
+	if err := json.NewDecoder(resp.Body).Decode(&points); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
@@ -0,0 +1,40 @@
+// Package meetingstore implements the storage of meeting points. Users leave a value at each meeting
+// point they derive and look for values left by their contacts
+package meetingstore
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when nothing has been left at a meeting point
+var ErrNotFound = errors.New("meetingstore: meeting point not found")
+
+// ErrOccupied is returned by a shared store when a value is put at a meeting point that already holds one
+var ErrOccupied = errors.New("meetingstore: meeting point already holds a value")
+
+// ErrForbidden is returned by a shared store when the caller may not delete a value or list the meeting points
+var ErrForbidden = errors.New("meetingstore: forbidden")
+
+// MeetingStore holds the values left at meeting points
+type MeetingStore interface {
+	// Put leaves a value at a meeting point. Local stores replace any previous value, stores shared between
+	// users refuse to with ErrOccupied
+	Put(ctx context.Context, meetingPoint string, value []byte) error
+	// Get returns the value left at a meeting point or ErrNotFound
+	Get(ctx context.Context, meetingPoint string) ([]byte, error)
+	// Delete removes the value left at a meeting point. Deleting an empty meeting point is not an error
+	Delete(ctx context.Context, meetingPoint string) error
+	// List returns every meeting point currently holding a value
+	List(ctx context.Context) ([]string, error)
+}
+
+// OwnedStore is a MeetingStore shared between users. Values are written once and tied to a secret of the user
+// who left them: only that user, or the operator of the store, may delete them
+type OwnedStore interface {
+	MeetingStore
+	// PutOwned leaves a value at an empty meeting point on behalf of the holder of owner
+	PutOwned(ctx context.Context, meetingPoint string, value, owner []byte) error
+	// DeleteOwned removes a value left with PutOwned by the holder of owner
+	DeleteOwned(ctx context.Context, meetingPoint string, owner []byte) error
+}
@@ -0,0 +1,318 @@
+package meetingstore
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testStore checks the behaviour every MeetingStore must have
+func testStore(t *testing.T, store MeetingStore) {
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "a"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound on an empty meeting point, got %v", err)
+	}
+
+	if err := store.Put(ctx, "a", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "b", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	// shared stores are write-once
+	expected := []byte("replaced")
+	err := store.Put(ctx, "a", expected)
+	if _, shared := store.(OwnedStore); shared {
+		if err != ErrOccupied {
+			t.Errorf("Expected ErrOccupied when replacing a value in a shared store, got %v", err)
+		}
+		expected = []byte("first")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := store.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(value, expected) {
+		t.Errorf("Got %q, expected %q", value, expected)
+	}
+
+	points, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0] != "a" || points[1] != "b" {
+		t.Errorf("Unexpected list of meeting points %v", points)
+	}
+
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "never-used"); err != nil {
+		t.Errorf("Deleting an empty meeting point failed: %v", err)
+	}
+	if _, err := store.Get(ctx, "a"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := store.Put(cancelled, "c", []byte("late")); err == nil {
+		t.Errorf("Put succeeded with a cancelled context")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meetingstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "meetings.log")
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+	store.Close()
+
+	// The content must survive a restart
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	ctx := context.Background()
+	if _, err := reopened.Get(ctx, "a"); err != ErrNotFound {
+		t.Errorf("Deleted meeting point came back after a restart")
+	}
+	value, err := reopened.Get(ctx, "b")
+	if err != nil || !bytes.Equal(value, []byte("second")) {
+		t.Errorf("Meeting point was lost after a restart")
+	}
+
+	// Compacting keeps the content and shrinks the log
+	before, _ := os.Stat(path)
+	if err := reopened.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("Log did not shrink: %d then %d bytes", before.Size(), after.Size())
+	}
+	if err := reopened.Put(ctx, "c", []byte("third")); err != nil {
+		t.Fatal(err)
+	}
+	compacted, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer compacted.Close()
+	if points, _ := compacted.List(ctx); len(points) != 2 || points[0] != "b" || points[1] != "c" {
+		t.Errorf("Unexpected meeting points after compaction: %v", points)
+	}
+}
+
+func TestFileStoreTornRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meetingstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "meetings.log")
+
+	ctx := context.Background()
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "a", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	intact, _ := ioutil.ReadFile(path)
+
+	// A crash while appending leaves half a record at the end of the log
+	ioutil.WriteFile(path, append(intact, `{"op":"put","point":"b","val`...), 0600)
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Could not open a log with a torn last record: %s", err)
+	}
+	if value, err := reopened.Get(ctx, "a"); err != nil || !bytes.Equal(value, []byte("first")) {
+		t.Errorf("Records before the torn one were lost")
+	}
+	if _, err := reopened.Get(ctx, "b"); err != ErrNotFound {
+		t.Errorf("Torn record was replayed")
+	}
+	if err := reopened.Put(ctx, "c", []byte("third")); err != nil {
+		t.Fatal(err)
+	}
+	reopened.Close()
+	again, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Could not reopen after appending past a torn record: %s", err)
+	}
+	if points, _ := again.List(ctx); len(points) != 2 || points[0] != "a" || points[1] != "c" {
+		t.Errorf("Unexpected meeting points: %v", points)
+	}
+	again.Close()
+
+	// A malformed record followed by others is corruption, not a torn append
+	ioutil.WriteFile(path, append([]byte("{\"op\":\"put\"\n"), intact...), 0600)
+	if _, err := OpenFileStore(path); err == nil {
+		t.Errorf("Opened a log corrupted in the middle")
+	}
+}
+
+func TestFileStoreFailedCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meetingstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "meetings.log")
+
+	ctx := context.Background()
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Put(ctx, "a", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The compacted log cannot replace the old one, which stays in use
+	moved := filepath.Join(dir, "moved.log")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocker"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Compact(); err == nil {
+		t.Fatalf("Compaction replaced a directory")
+	}
+	if err := store.Put(ctx, "b", []byte("second")); err != nil {
+		t.Fatalf("Store unusable after a failed compaction: %s", err)
+	}
+	if log, _ := ioutil.ReadFile(moved); !bytes.Contains(log, []byte(`"point":"b"`)) {
+		t.Errorf("Put after a failed compaction did not reach the log")
+	}
+}
+
+func TestCollectGarbage(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for _, point := range []string{EpochPoint(4, "aa"), EpochPoint(5, "bb"), EpochPoint(6, "cc"), "legacy"} {
+		store.Put(ctx, point, []byte("value"))
+	}
+	if epoch, ok := PointEpoch(EpochPoint(5, "bb")); !ok || epoch != 5 {
+		t.Errorf("Wrong epoch parsed: %d", epoch)
+	}
+	if _, ok := PointEpoch("-aa"); ok {
+		t.Errorf("Meeting point without an epoch was parsed")
+	}
+
+	deleted, err := CollectGarbage(ctx, store, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, _ := store.List(ctx)
+	if deleted != 2 || len(points) != 2 || points[0] != EpochPoint(5, "bb") || points[1] != EpochPoint(6, "cc") {
+		t.Errorf("Unexpected meeting points after garbage collection: %v", points)
+	}
+}
+
+func TestHTTPStore(t *testing.T) {
+	backend := NewMemoryStore()
+	ts := httptest.NewServer(NewHandler(backend, []byte("operator token")))
+	defer ts.Close()
+
+	testStore(t, NewHTTPStore(ts.URL, []byte("operator token")))
+
+	// Both clients share the same backend
+	if _, err := backend.Get(context.Background(), "b"); err != nil {
+		t.Errorf("Value put over HTTP is missing from the backend")
+	}
+}
+
+func TestHTTPStoreOwners(t *testing.T) {
+	ctx := context.Background()
+	ts := httptest.NewServer(NewHandler(NewMemoryStore(), []byte("operator token")))
+	defer ts.Close()
+
+	user := NewHTTPStore(ts.URL, nil)
+	if err := user.PutOwned(ctx, "a", []byte("alice"), []byte("alice's secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := user.Put(ctx, "b", []byte("unowned")); err != nil {
+		t.Fatal(err)
+	}
+
+	// overwrites are refused, whoever asks
+	if err := user.PutOwned(ctx, "a", []byte("mallory"), []byte("mallory's secret")); err != ErrOccupied {
+		t.Errorf("Expected ErrOccupied when overwriting a value, got %v", err)
+	}
+	if err := user.PutOwned(ctx, "a", []byte("alice again"), []byte("alice's secret")); err != ErrOccupied {
+		t.Errorf("Expected ErrOccupied when the owner overwrites a value, got %v", err)
+	}
+	if value, err := user.Get(ctx, "a"); err != nil || !bytes.Equal(value, []byte("alice")) {
+		t.Errorf("Got %q, %v after refused overwrites, expected %q", value, err, "alice")
+	}
+
+	// without the operator's token, only the owner deletes a value
+	if err := user.Delete(ctx, "a"); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden when deleting without a secret, got %v", err)
+	}
+	if err := user.DeleteOwned(ctx, "a", []byte("mallory's secret")); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden when deleting with another owner's secret, got %v", err)
+	}
+	if err := user.DeleteOwned(ctx, "b", []byte("mallory's secret")); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden when deleting a value without owner, got %v", err)
+	}
+	if _, err := user.List(ctx); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden when listing without the token, got %v", err)
+	}
+	if _, err := NewHTTPStore(ts.URL, []byte("guessed token")).List(ctx); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden when listing with the wrong token, got %v", err)
+	}
+	if _, err := user.Get(ctx, "a"); err != nil {
+		t.Errorf("Value was deleted by unauthorised requests: %v", err)
+	}
+
+	if err := user.DeleteOwned(ctx, "a", []byte("alice's secret")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := user.Get(ctx, "a"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after the owner deleted a value, got %v", err)
+	}
+
+	operator := NewHTTPStore(ts.URL, []byte("operator token"))
+	if err := operator.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if points, err := operator.List(ctx); err != nil || len(points) != 0 {
+		t.Errorf("Got %v, %v, expected an empty store", points, err)
+	}
+
+	// without a token, nobody lists the meeting points
+	closed := httptest.NewServer(NewHandler(NewMemoryStore(), nil))
+	defer closed.Close()
+	if _, err := NewHTTPStore(closed.URL, nil).List(ctx); err != ErrForbidden {
+		t.Errorf("Expected ErrForbidden when the store has no token, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package meetingstore
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is an in-memory MeetingStore that is safe for concurrent use
+type MemoryStore struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string][]byte)}
+}
+
+// Put implements MeetingStore
+func (s *MemoryStore) Put(ctx context.Context, meetingPoint string, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[meetingPoint] = append([]byte{}, value...)
+	return nil
+}
+
+// Get implements MeetingStore
+func (s *MemoryStore) Get(ctx context.Context, meetingPoint string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, found := s.values[meetingPoint]
+	if !found {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Delete implements MeetingStore
+func (s *MemoryStore) Delete(ctx context.Context, meetingPoint string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.values, meetingPoint)
+	return nil
+}
+
+// List implements MeetingStore. Meeting points are returned in lexicographic order
+func (s *MemoryStore) List(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	points := make([]string, 0, len(s.values))
+	for meetingPoint := range s.values {
+		points = append(points, meetingPoint)
+	}
+	sort.Strings(points)
+
+	return points, nil
+}
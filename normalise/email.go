@@ -0,0 +1,43 @@
+package normalise
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// domains converts the domain of email addresses to ASCII: the IDNA lookup profile maps the domain as UTS #46
+// prescribes (case folding, NFKC, ...) and validates its labels, with the DNS length limits on top
+var domains = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.VerifyDNSLength(true))
+
+// Email returns the canonical form of an email address, prefixed with mailto:. The local part is mapped to
+// NFKC and lower-cased. The domain is mapped and converted to its ASCII form as IDNA lookups do (UTS #46),
+// so that "Alice@Bücher.example" and "alice@xn--bcher-kva.example" are the same address. A trailing dot
+// naming the root of the domain is dropped
+func Email(raw string) (string, error) {
+	s := strings.TrimSpace(raw)
+	at := strings.LastIndexByte(s, '@')
+	if at <= 0 || at == len(s)-1 {
+		return "", fmt.Errorf("normalise: %q is not an email address", raw)
+	}
+	local := strings.ToLower(norm.NFKC.String(s[:at]))
+	for _, r := range local {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return "", fmt.Errorf("normalise: %q is not an email address", raw)
+		}
+	}
+
+	domain, err := domains.ToASCII(s[at+1:])
+	if err != nil {
+		return "", fmt.Errorf("normalise: %q: %v", raw, err)
+	}
+	domain = strings.TrimSuffix(domain, ".")
+	if domain == "" {
+		return "", fmt.Errorf("normalise: %q is not an email address", raw)
+	}
+
+	return EmailPrefix + local + "@" + domain, nil
+}
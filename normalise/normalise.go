@@ -0,0 +1,79 @@
+// Package normalise puts discovery identifiers in canonical form before they are hashed. Keys are derived
+// from the exact bytes of an identifier, so "+44 7700 900123", "07700 900123" and "+447700900123" must all
+// become the same string or the contacts never meet. Phone numbers become E.164 numbers prefixed with tel:,
+// email addresses are lower-cased, their domain converted to IDNA and prefixed with mailto:, and any other
+// identifier is a handle, mapped to its Unicode compatibility composed form
+package normalise
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Prefixes of typed identifiers. An identifier starting with one of them is parsed as that type, other
+// identifiers are classified by their content
+const (
+	PhonePrefix = "tel:"
+	EmailPrefix = "mailto:"
+)
+
+// ErrEmpty is returned for identifiers that are empty once normalised
+var ErrEmpty = errors.New("normalise: empty identifier")
+
+// Identifier returns the canonical form of a discovery identifier. Phone numbers without a country code are
+// read as numbers of the default region, e.g. "GB", and are rejected with ErrNoRegion when region is empty.
+// A string of digits alone is a phone number whether or not it has separators, a handle made of digits only
+// must be normalised with Handle
+func Identifier(raw, region string) (string, error) {
+	s := strings.TrimSpace(norm.NFKC.String(raw))
+	switch {
+	case hasPrefixFold(s, PhonePrefix):
+		return Phone(s[len(PhonePrefix):], region)
+	case hasPrefixFold(s, EmailPrefix):
+		return email(raw)
+	case looksLikePhone(s):
+		return Phone(s, region)
+	case strings.LastIndexByte(s, '@') > 0:
+		// a handle may start with @, an email address has a local part before it
+		return email(raw)
+	default:
+		return Handle(s)
+	}
+}
+
+// email returns the canonical form of the email address raw, with or without its mailto: prefix. Its domain
+// is passed on as typed rather than mapped to NFKC first, as UTS #46 maps a few characters differently, e.g.
+// the ⒈ of "a⒈com" is disallowed rather than read as "1."
+func email(raw string) (string, error) {
+	s := strings.TrimSpace(raw)
+	if hasPrefixFold(s, EmailPrefix) {
+		s = s[len(EmailPrefix):]
+	}
+	return Email(s)
+}
+
+// Handle returns the canonical form of a handle: surrounding spaces are trimmed and the handle is mapped to
+// NFKC, so that e.g. fullwidth letters or a decomposed accent give the same handle as their usual form.
+// Handles are case sensitive
+func Handle(raw string) (string, error) {
+	handle := strings.TrimSpace(norm.NFKC.String(raw))
+	if handle == "" {
+		return "", ErrEmpty
+	}
+	for _, r := range handle {
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("normalise: handle %q holds a control character", raw)
+		}
+	}
+
+	return handle, nil
+}
+
+// hasPrefixFold reports whether s starts with prefix, ignoring case
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
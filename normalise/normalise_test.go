@@ -0,0 +1,242 @@
+package normalise
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestIdentifier(t *testing.T) {
+	tests := []struct {
+		raw, region, want string
+	}{
+		// phone numbers
+		{"+447700900123", "", "tel:+447700900123"},
+		{"+44 7700 900123", "", "tel:+447700900123"},
+		{"07700 900123", "GB", "tel:+447700900123"},
+		{"07700-900-123", "gb", "tel:+447700900123"},
+		{"0044 7700 900123", "GB", "tel:+447700900123"},
+		{"+44 (0)7700 900123", "", "tel:+447700900123"},
+		{"0044 (0)20 7946 0000", "GB", "tel:+442079460000"},
+		{"011 44 (0)20 7946 0000", "US", "tel:+442079460000"},
+		{"tel:+44-7700-900123", "", "tel:+447700900123"},
+		{"＋４４　７７００　９００１２３", "", "tel:+447700900123"},
+		{"(415) 555-0100", "US", "tel:+14155550100"},
+		{"1 415 555 0100", "US", "tel:+14155550100"},
+		{"011 44 7700 900123", "US", "tel:+447700900123"},
+		{"06 12 34 56 78", "FR", "tel:+33612345678"},
+		{"06 1234 5678", "IT", "tel:+390612345678"},
+		// email addresses
+		{"Alice@Example.ORG", "", "mailto:alice@example.org"},
+		{"mailto:alice@example.org.", "", "mailto:alice@example.org"},
+		{"MAILTO:Bob@Bücher.example", "", "mailto:bob@xn--bcher-kva.example"},
+		{"carol@xn--bcher-kva.example", "", "mailto:carol@xn--bcher-kva.example"},
+		{"ｄａｖｅ@example.org", "", "mailto:dave@example.org"},
+		{"erin@ＥＸＡＭＰＬＥ．org", "", "mailto:erin@example.org"},
+		{"frank@ﬁ.example", "", "mailto:frank@fi.example"},
+		// handles
+		{"alice", "", "alice"},
+		{" Alice ", "", "Alice"},
+		{"ｂｏｂ", "", "bob"},
+		{"ﬁona", "", "fiona"},
+		{"josé", "", "josé"},
+		{"ậ", "", "ậ"},
+		{"ậ", "", "ậ"},
+		{"ớ", "", "ớ"},
+		{"user-42", "GB", "user-42"},
+		{"@alice", "", "@alice"},
+		{"\u1112\u1161\u11ab\u1100\u1173\u11af", "", "한글"},
+		{"㈜", "", "(주)"},
+		{"Ⅻ", "", "XII"},
+		{"x²", "", "x2"},
+	}
+
+	for _, test := range tests {
+		got, err := Identifier(test.raw, test.region)
+		if err != nil {
+			t.Errorf("Identifier(%q, %q) failed: %s", test.raw, test.region, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Identifier(%q, %q) = %q, want %q", test.raw, test.region, got, test.want)
+		}
+	}
+}
+
+func TestIdentifierIsIdempotent(t *testing.T) {
+	for _, raw := range []string{"07700 900123", "Bob@Bücher.example", "josé", "ｂｏｂ"} {
+		once, err := Identifier(raw, "GB")
+		if err != nil {
+			t.Fatal(err)
+		}
+		twice, err := Identifier(once, "GB")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if once != twice {
+			t.Errorf("Normalising %q again changed it: %q then %q", raw, once, twice)
+		}
+	}
+}
+
+func TestIdentifierRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		raw, region string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"tel:not a number", ""},
+		{"tel:+44 7700", ""},
+		{"+1234567890123456", ""},
+		{"+0 7700 900123", ""},
+		{"mailto:alice", ""},
+		{"alice@", ""},
+		{"alice@@", ""},
+		{"mailto:@example.org", ""},
+		{"alice@exa mple.org", ""},
+		{"alice@-example.org", ""},
+		{"alice@example..org", ""},
+		{"alice@a⒈com", ""},
+		{"1234", "GB"},
+		{"ali ce@example.org", ""},
+		{"bob\x00", ""},
+	}
+
+	for _, test := range tests {
+		if got, err := Identifier(test.raw, test.region); err == nil {
+			t.Errorf("Identifier(%q, %q) = %q, want an error", test.raw, test.region, got)
+		}
+	}
+}
+
+func TestPhoneRegions(t *testing.T) {
+	if _, err := Identifier("07700 900123", ""); !errors.Is(err, ErrNoRegion) {
+		t.Errorf("National number without a region: got %v, want ErrNoRegion", err)
+	}
+	if _, err := Identifier("07700 900123", "XX"); !errors.Is(err, ErrUnknownRegion) {
+		t.Errorf("Unknown region: got %v, want ErrUnknownRegion", err)
+	}
+	if got, err := Identifier("+447700900123", "XX"); err == nil {
+		t.Errorf("Unknown region was accepted with an international number: %q", got)
+	}
+	// digits alone are a phone number, written with or without separators, and need a default region
+	if got, err := Identifier("07700900123", "GB"); err != nil || got != "tel:+447700900123" {
+		t.Errorf("Digits with a default region: got %q (%v), want a phone number", got, err)
+	}
+	for _, digits := range []string{"07700900123", "１２３４５"} {
+		if got, err := Identifier(digits, ""); !errors.Is(err, ErrNoRegion) {
+			t.Errorf("Digits without a default region: got %q (%v), want ErrNoRegion", got, err)
+		}
+	}
+	// a handle made of digits only is given as one explicitly
+	if got, err := Handle("１２３４５"); err != nil || got != "12345" {
+		t.Errorf("Handle of digits: got %q (%v), want %q", got, err, "12345")
+	}
+}
+
+// idnaEscape matches the \uXXXX and \x{XXXX} escapes of the Unicode test data
+var idnaEscape = regexp.MustCompile(`\\u([0-9A-Fa-f]{4})|\\x\{([0-9A-Fa-f]+)\}`)
+
+// idnaField unescapes a column of the Unicode test data. Empty columns are returned as def, "" as the empty
+// string
+func idnaField(column, def string) string {
+	column = strings.TrimSpace(column)
+	switch column {
+	case "":
+		return def
+	case `""`:
+		return ""
+	}
+	return idnaEscape.ReplaceAllStringFunc(column, func(escape string) string {
+		m := idnaEscape.FindStringSubmatch(escape)
+		code, _ := strconv.ParseUint(m[1]+m[2], 16, 32)
+		return string(rune(code))
+	})
+}
+
+// idnaChanged reports whether s holds characters whose UTS #46 status changed after Unicode 15.0, the version
+// of the x/net tables: = < > and the negated relations built on them are valid since 15.1 (STD3 rules are
+// no longer applied), the Georgian capitals, the Hangul fillers and a few others are mapped differently
+func idnaChanged(s string) bool {
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune("<=>\u2260\u226E\u226F", r),
+			r >= 0x10A0 && r <= 0x10C5,
+			strings.ContainsRune("\u04C0\u115F\u1160\u1E9E\u2132\u3164\uFFA0\U0001D175\U0002F868", r):
+			return true
+		}
+	}
+	return false
+}
+
+// hyphenatedPunycode reports whether domain has an xn-- label ending with a hyphen, which is ASCII only
+// once decoded and so rejected by UTS #46 since Unicode 15.1
+func hyphenatedPunycode(domain string) bool {
+	for _, label := range strings.Split(strings.ToLower(domain), ".") {
+		if strings.HasPrefix(label, "xn--") && strings.HasSuffix(label, "-") {
+			return true
+		}
+	}
+	return false
+}
+
+// TestEmailDomainConformance checks the domains of email addresses against the UTS #46 conformance data
+// (testdata/IdnaTestV2.txt, nontransitional toASCII). The x/net tables follow Unicode 15.0, so the rows
+// whose result changed since are let through, as is the trailing root label rejected by the data and
+// dropped by Email
+func TestEmailDomainConformance(t *testing.T) {
+	f, err := os.Open("testdata/IdnaTestV2.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, deviations := 0, 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		columns := strings.Split(line, ";")
+		if len(columns) < 5 {
+			t.Fatalf("Malformed test data: %q", line)
+		}
+		source := idnaField(columns[0], "")
+		unicode := idnaField(columns[1], source)
+		unicodeStatus := idnaField(columns[2], "[]")
+		ascii := idnaField(columns[3], unicode)
+		asciiStatus := idnaField(columns[4], unicodeStatus)
+		rows++
+
+		got, err := Identifier(EmailPrefix+"user@"+source, "")
+		want := EmailPrefix + "user@" + ascii
+		switch {
+		case asciiStatus == "[]" && err == nil && got == want, asciiStatus != "[]" && err != nil:
+			continue
+		case idnaChanged(source + unicode):
+		case asciiStatus == "[A4_2]" && got == strings.TrimSuffix(want, "."):
+		case asciiStatus == "[P4]" && hyphenatedPunycode(source):
+		case asciiStatus == "[]":
+			t.Errorf("Domain %+q: got %+q (%v), want %+q", source, got, err, want)
+			continue
+		default:
+			t.Errorf("Domain %+q (%s) was accepted: %+q", source, asciiStatus, got)
+			continue
+		}
+		deviations++
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if rows == 0 || deviations > rows/20 {
+		t.Errorf("Checked %d rows, %d of them deviating from the data", rows, deviations)
+	}
+}
@@ -0,0 +1,119 @@
+package normalise
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// E.164 numbers hold at most 15 digits including the country code. Shorter than 7 digits, a number is more
+// likely a typo than a subscriber
+const (
+	maxPhoneDigits = 15
+	minPhoneDigits = 7
+)
+
+var (
+	// ErrNoRegion is returned for a phone number without a country code when no default region is given
+	ErrNoRegion = errors.New("normalise: phone number without a country code and no default region")
+	// ErrUnknownRegion is returned for a default region missing from the table of regions
+	ErrUnknownRegion = errors.New("normalise: unknown region")
+)
+
+// region holds the dialling conventions of a region: its country calling code, the prefix dialled before
+// a national number (removed in international format) and the prefix dialled before an international one
+type region struct {
+	countryCode   string
+	trunkPrefix   string
+	international string
+}
+
+// regions maps ISO 3166 region codes to their dialling conventions
+var regions = map[string]region{
+	"AU": {"61", "0", "0011"},
+	"BE": {"32", "0", "00"},
+	"CA": {"1", "1", "011"},
+	"CH": {"41", "0", "00"},
+	"DE": {"49", "0", "00"},
+	"ES": {"34", "", "00"},
+	"FR": {"33", "0", "00"},
+	"GB": {"44", "0", "00"},
+	"IE": {"353", "0", "00"},
+	"IN": {"91", "0", "00"},
+	"IT": {"39", "", "00"},
+	"JP": {"81", "0", "010"},
+	"NL": {"31", "0", "00"},
+	"NZ": {"64", "0", "00"},
+	"US": {"1", "1", "011"},
+}
+
+// phoneSeparators are the characters people put between the digits of a phone number
+const phoneSeparators = " -./()"
+
+// looksLikePhone reports whether s is made of digits, separators and a leading plus sign only
+func looksLikePhone(s string) bool {
+	digits := 0
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case strings.ContainsRune(phoneSeparators, r):
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// stripSeparators removes the separators from a phone number, leaving its digits
+func stripSeparators(s string) string {
+	return strings.Map(func(c rune) rune {
+		if strings.ContainsRune(phoneSeparators, c) {
+			return -1
+		}
+		return c
+	}, s)
+}
+
+// Phone returns the E.164 form of a phone number, prefixed with tel:. A number in international format
+// starts with a plus sign or the international prefix of the default region, any other number is a national
+// number of the default region. A national trunk prefix written in brackets after the country code of a
+// number in international format, as in "+44 (0)20" or "0044 (0)20", is dropped
+func Phone(raw, defaultRegion string) (string, error) {
+	s := strings.TrimSpace(raw)
+	if !looksLikePhone(s) {
+		return "", fmt.Errorf("normalise: %q is not a phone number", raw)
+	}
+
+	var r region
+	if defaultRegion != "" {
+		var found bool
+		if r, found = regions[strings.ToUpper(defaultRegion)]; !found {
+			return "", fmt.Errorf("%w %q", ErrUnknownRegion, defaultRegion)
+		}
+	}
+
+	plus := strings.HasPrefix(s, "+")
+	s = strings.TrimPrefix(s, "+")
+	digits := stripSeparators(s)
+	dialledAbroad := !plus && defaultRegion != "" && strings.HasPrefix(digits, r.international)
+	if plus || dialledAbroad {
+		digits = stripSeparators(strings.Replace(s, "(0)", "", 1))
+	}
+
+	switch {
+	case plus:
+	case defaultRegion == "":
+		return "", ErrNoRegion
+	case dialledAbroad:
+		digits = digits[len(r.international):]
+	default:
+		digits = r.countryCode + strings.TrimPrefix(digits, r.trunkPrefix)
+	}
+
+	if len(digits) < minPhoneDigits || len(digits) > maxPhoneDigits || digits[0] == '0' {
+		return "", fmt.Errorf("normalise: %q is not a valid phone number", raw)
+	}
+	return PhonePrefix + "+" + digits, nil
+}
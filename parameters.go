@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto/bls12381"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/share"
+)
+
+// parametersVersion is the version of the public parameters encodings. Version 1 predates epochs, its
+// parameters are decoded with a single epoch
+const parametersVersion = 2
+
+// parametersMagic starts the binary encoding of the public parameters
+var parametersMagic = []byte("CDPP")
+
+// suites maps the names used in encoded parameters to the pairing suites they stand for
+var suites = map[string]func() pairing.Suite{
+	"bn256":    func() pairing.Suite { return bn256.NewSuite() },
+	"bls12381": func() pairing.Suite { return bls12381.NewSuite() },
+}
+
+// newSuite returns the pairing suite registered under name
+func newSuite(name string) (pairing.Suite, error) {
+	constructor, found := suites[name]
+	if !found {
+		return nil, fmt.Errorf("parameters: unknown suite %q", name)
+	}
+	return constructor(), nil
+}
+
+func suiteName(suite pairing.Suite) (string, error) {
+	switch suite.(type) {
+	case *bn256.Suite:
+		return "bn256", nil
+	case *bls12381.Suite:
+		return "bls12381", nil
+	}
+	return "", fmt.Errorf("parameters: unknown suite %T", suite)
+}
+
+// parametersBundle is the serialisable form of the public parameters and the servers' endpoints,
+// as published to clients. Commitments[0] are the coefficients of the public polynomial in G2,
+// Commitments[1] those in G1
+type parametersBundle struct {
+	Version      int          `json:"version"`
+	Suite        string       `json:"suite"`
+	Threshold    int          `json:"threshold"`
+	TotalServers int          `json:"total_servers"`
+	EpochLength  int64        `json:"epoch_length,omitempty"` // in seconds
+	Commitments  [2][][]byte  `json:"commitments"`
+	Servers      []serverInfo `json:"servers"`
+}
+
+type serverInfo struct {
+	ID      int    `json:"id"`
+	Address string `json:"address"`
+}
+
+func newParametersBundle(parameters publicParameters, endpoints []*serverEndpoint) (*parametersBundle, error) {
+	name, err := suiteName(parameters.Suite)
+	if err != nil {
+		return nil, err
+	}
+	b := &parametersBundle{
+		Version:      parametersVersion,
+		Suite:        name,
+		Threshold:    parameters.Threshold,
+		TotalServers: parameters.TotalServers,
+		EpochLength:  int64(parameters.EpochLength / time.Second),
+	}
+	if parameters.EpochLength%time.Second != 0 {
+		return nil, errors.New("parameters: the epoch length must be a whole number of seconds")
+	}
+
+	for i, poly := range parameters.PublicPolynomials {
+		if poly == nil {
+			return nil, errors.New("parameters: missing public polynomial")
+		}
+		_, commits := poly.Info()
+		for _, c := range commits {
+			buf, err := c.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			b.Commitments[i] = append(b.Commitments[i], buf)
+		}
+	}
+
+	// Endpoints are sorted so that the encoding does not depend on their order
+	for _, e := range endpoints {
+		b.Servers = append(b.Servers, serverInfo{ID: e.ID, Address: e.Address})
+	}
+	sort.Slice(b.Servers, func(i, j int) bool { return b.Servers[i].ID < b.Servers[j].ID })
+
+	return b, nil
+}
+
+// decode checks the bundle and rebuilds the public parameters and endpoints it describes
+func (b *parametersBundle) decode() (publicParameters, []*serverEndpoint, error) {
+	var parameters publicParameters
+	if b.Version != parametersVersion && b.Version != 1 {
+		return parameters, nil, fmt.Errorf("parameters: unsupported version %d", b.Version)
+	}
+	suite, err := newSuite(b.Suite)
+	if err != nil {
+		return parameters, nil, err
+	}
+	if b.Threshold < 1 || b.Threshold > b.TotalServers {
+		return parameters, nil, fmt.Errorf("parameters: invalid threshold %d of %d", b.Threshold, b.TotalServers)
+	}
+	parameters.Suite = suite
+	parameters.Threshold = b.Threshold
+	parameters.TotalServers = b.TotalServers
+	if b.EpochLength < 0 || (b.Version == 1 && b.EpochLength != 0) {
+		return parameters, nil, fmt.Errorf("parameters: invalid epoch length %d", b.EpochLength)
+	}
+	parameters.EpochLength = time.Duration(b.EpochLength) * time.Second
+
+	groups := [2]kyber.Group{parameters.Suite.G2(), parameters.Suite.G1()}
+	commits := [2][]kyber.Point{}
+	for i, group := range groups {
+		if len(b.Commitments[i]) != b.Threshold {
+			return parameters, nil, errors.New("parameters: public polynomial does not match the threshold")
+		}
+		for _, buf := range b.Commitments[i] {
+			c := group.Point()
+			if err := c.UnmarshalBinary(buf); err != nil {
+				return parameters, nil, err
+			}
+			commits[i] = append(commits[i], c)
+		}
+		parameters.PublicPolynomials[i] = share.NewPubPoly(group, group.Point().Base(), commits[i])
+	}
+
+	// Both polynomials must commit to the same coefficients
+	for j := range commits[0] {
+		left := parameters.Suite.Pair(commits[1][j], parameters.Suite.G2().Point().Base())
+		right := parameters.Suite.Pair(parameters.Suite.G1().Point().Base(), commits[0][j])
+		if !left.Equal(right) {
+			return parameters, nil, errors.New("parameters: public polynomials do not match")
+		}
+	}
+
+	// Server IDs are the indices of their shares, each server of the committee must be listed exactly once
+	if len(b.Servers) != b.TotalServers {
+		return parameters, nil, fmt.Errorf("parameters: %d servers listed for a committee of %d", len(b.Servers), b.TotalServers)
+	}
+	seen := make(map[int]bool, len(b.Servers))
+	endpoints := make([]*serverEndpoint, len(b.Servers))
+	for i, s := range b.Servers {
+		if s.ID < 0 || s.ID >= b.TotalServers {
+			return parameters, nil, fmt.Errorf("parameters: server ID %d out of range", s.ID)
+		}
+		if seen[s.ID] {
+			return parameters, nil, fmt.Errorf("parameters: server ID %d listed twice", s.ID)
+		}
+		seen[s.ID] = true
+		endpoints[i] = newServerEndpoint(s.ID, s.Address)
+	}
+
+	return parameters, endpoints, nil
+}
+
+// marshalBinary writes the canonical binary encoding of the bundle, which the fingerprint is computed on
+func (b *parametersBundle) marshalBinary() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Write(parametersMagic)
+	buf.WriteByte(byte(b.Version))
+	writeBytes(buf, []byte(b.Suite))
+	binary.Write(buf, binary.BigEndian, uint32(b.Threshold))
+	binary.Write(buf, binary.BigEndian, uint32(b.TotalServers))
+	if b.Version >= 2 {
+		binary.Write(buf, binary.BigEndian, uint64(b.EpochLength))
+	}
+	for _, commits := range b.Commitments {
+		binary.Write(buf, binary.BigEndian, uint32(len(commits)))
+		for _, c := range commits {
+			writeBytes(buf, c)
+		}
+	}
+	binary.Write(buf, binary.BigEndian, uint32(len(b.Servers)))
+	for _, s := range b.Servers {
+		binary.Write(buf, binary.BigEndian, uint32(s.ID))
+		writeBytes(buf, []byte(s.Address))
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (b *parametersBundle) unmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	magic := make([]byte, len(parametersMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, parametersMagic) {
+		return errors.New("parameters: not a binary parameters encoding")
+	}
+	version, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	b.Version = int(version)
+	suite, err := readBytes(r)
+	if err != nil {
+		return err
+	}
+	b.Suite = string(suite)
+
+	var t, n, count uint32
+	if err := binary.Read(r, binary.BigEndian, &t); err != nil {
+		return err
+	}
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return err
+	}
+	b.Threshold, b.TotalServers = int(t), int(n)
+	if b.Version >= 2 {
+		var epochLength uint64
+		if err := binary.Read(r, binary.BigEndian, &epochLength); err != nil {
+			return err
+		}
+		b.EpochLength = int64(epochLength)
+	}
+	for i := range b.Commitments {
+		if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+			return err
+		}
+		if int(count) > r.Len() {
+			return errors.New("parameters: truncated encoding")
+		}
+		b.Commitments[i] = make([][]byte, count)
+		for j := range b.Commitments[i] {
+			if b.Commitments[i][j], err = readBytes(r); err != nil {
+				return err
+			}
+		}
+	}
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return err
+	}
+	if int(count) > r.Len() {
+		return errors.New("parameters: truncated encoding")
+	}
+	b.Servers = make([]serverInfo, count)
+	for i := range b.Servers {
+		var id uint32
+		if err := binary.Read(r, binary.BigEndian, &id); err != nil {
+			return err
+		}
+		address, err := readBytes(r)
+		if err != nil {
+			return err
+		}
+		b.Servers[i] = serverInfo{ID: int(id), Address: string(address)}
+	}
+	if r.Len() != 0 {
+		return errors.New("parameters: trailing data")
+	}
+
+	return nil
+}
+
+func writeBytes(buf *bytes.Buffer, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint16(len(data)))
+	buf.Write(data)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	if int(length) > r.Len() {
+		return nil, errors.New("parameters: truncated encoding")
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+// fingerprint is a short digest of the canonical encoding, for clients to pin
+func (b *parametersBundle) fingerprint() (string, error) {
+	// The digest is taken on the parameters as newParametersBundle encodes them, whichever version and server
+	// order the file was written with, so that the same parameters always have the same fingerprint
+	canonical := *b
+	canonical.Version = parametersVersion
+	canonical.Servers = append([]serverInfo(nil), b.Servers...)
+	sort.Slice(canonical.Servers, func(i, j int) bool { return canonical.Servers[i].ID < canonical.Servers[j].ID })
+	buf, err := canonical.marshalBinary()
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(buf)
+
+	return hex.EncodeToString(digest[:16]), nil
+}
+
+// checkFingerprint rejects a bundle that does not match the pinned fingerprint. Nothing is checked when pinned is empty
+func (b *parametersBundle) checkFingerprint(pinned string) error {
+	if pinned == "" {
+		return nil
+	}
+	actual, err := b.fingerprint()
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(actual), []byte(pinned)) != 1 {
+		return fmt.Errorf("parameters: fingerprint %s does not match the pinned %s", actual, pinned)
+	}
+
+	return nil
+}
+
+// marshalParametersJSON encodes the public parameters and the servers' endpoints as JSON
+func marshalParametersJSON(parameters publicParameters, endpoints []*serverEndpoint) ([]byte, error) {
+	b, err := newParametersBundle(parameters, endpoints)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// unmarshalParametersJSON decodes parameters encoded by marshalParametersJSON, and checks them against the pinned fingerprint
+func unmarshalParametersJSON(data []byte, pinned string) (publicParameters, []*serverEndpoint, error) {
+	var b parametersBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return publicParameters{}, nil, err
+	}
+	if err := b.checkFingerprint(pinned); err != nil {
+		return publicParameters{}, nil, err
+	}
+	return b.decode()
+}
+
+// marshalParametersBinary encodes the public parameters and the servers' endpoints in the canonical binary form
+func marshalParametersBinary(parameters publicParameters, endpoints []*serverEndpoint) ([]byte, error) {
+	b, err := newParametersBundle(parameters, endpoints)
+	if err != nil {
+		return nil, err
+	}
+	return b.marshalBinary()
+}
+
+// unmarshalParametersBinary decodes parameters encoded by marshalParametersBinary, and checks them against the pinned fingerprint
+func unmarshalParametersBinary(data []byte, pinned string) (publicParameters, []*serverEndpoint, error) {
+	var b parametersBundle
+	if err := b.unmarshalBinary(data); err != nil {
+		return publicParameters{}, nil, err
+	}
+	if err := b.checkFingerprint(pinned); err != nil {
+		return publicParameters{}, nil, err
+	}
+	return b.decode()
+}
+
+// publicKeyFingerprint returns a short digest of the suite and of the public keys, the values at index 0
+// of both public polynomials. Constraining keys only depend on those: unlike the parameters fingerprint,
+// it does not change when the shares are refreshed or moved to another committee
+func publicKeyFingerprint(parameters publicParameters) (string, error) {
+	name, err := suiteName(parameters.Suite)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	writeBytes(buf, []byte(name))
+	for _, poly := range parameters.PublicPolynomials {
+		if poly == nil {
+			return "", errors.New("parameters: missing public polynomial")
+		}
+		public, err := poly.Commit().MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		writeBytes(buf, public)
+	}
+	digest := sha256.Sum256(buf.Bytes())
+
+	return hex.EncodeToString(digest[:16]), nil
+}
+
+// parametersFingerprint returns the fingerprint clients pin to recognise these parameters
+func parametersFingerprint(parameters publicParameters, endpoints []*serverEndpoint) (string, error) {
+	b, err := newParametersBundle(parameters, endpoints)
+	if err != nil {
+		return "", err
+	}
+	return b.fingerprint()
+}
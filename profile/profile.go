@@ -0,0 +1,234 @@
+// Package profile stores a user's discovery state on disk, encrypted under a passphrase: the unblinded
+// constraining keys of each of the user's identifiers, the contact list and, for each contact, the shared
+// keys derived so far and whether the contact was found. A user reloading their profile neither asks the
+// servers for keys again nor recomputes pairings for contacts they already processed
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto/pbe"
+)
+
+// Version is the version of the file format written by Save. Version 1 files, which held a single
+// identifier, are upgraded by Load
+const Version = 2
+
+// scrypt cost parameters used by Save. Load reads them from the file
+var (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrWrongPassphrase is returned by Load when the file cannot be decrypted
+var ErrWrongPassphrase = pbe.ErrWrongPassphrase
+
+// Identifier is one of the identifiers the user enrolled, with its unblinded constraining keys
+type Identifier struct {
+	Identifier string `json:"identifier"`
+	Left       []byte `json:"left"`
+	Right      []byte `json:"right"`
+}
+
+// SharedKeys are the keys shared between one of the user's identifiers, Own, and a contact
+type SharedKeys struct {
+	Own      string `json:"own"`
+	Outgoing []byte `json:"outgoing"`
+	Incoming []byte `json:"incoming"`
+}
+
+// Contact is the discovery state of one contact. Points are stored in their binary encoding
+type Contact struct {
+	Identifier string `json:"identifier"`
+	// Keys are the shared keys derived for this contact, one per identifier of the user, empty until computed
+	Keys []SharedKeys `json:"keys,omitempty"`
+	// LastChecked is the last time the meeting points were visited
+	LastChecked time.Time `json:"last_checked,omitempty"`
+	// DiscoveredAt is the time the contact was found on the service, zero until then
+	DiscoveredAt time.Time `json:"discovered_at,omitempty"`
+	// MatchedBy is the user's identifier the contact was found with
+	MatchedBy string `json:"matched_by,omitempty"`
+	// Card is the contact card the contact left at the meeting point
+	Card []byte `json:"card,omitempty"`
+}
+
+// Discovered reports whether the contact was found on the service
+func (c *Contact) Discovered() bool {
+	return !c.DiscoveredAt.IsZero()
+}
+
+// Profile is the discovery state of a user
+type Profile struct {
+	// Identifiers are the identifiers the user enrolled, the primary one first
+	Identifiers []Identifier `json:"identifiers"`
+	// Parameters is the fingerprint of the public keys the keys were obtained under
+	Parameters string `json:"parameters"`
+	// Epoch is the epoch the keys belong to
+	Epoch uint64 `json:"epoch"`
+	// Region is the default region of the phone numbers in the contact list
+	Region   string    `json:"region,omitempty"`
+	Card     []byte    `json:"card,omitempty"`
+	Contacts []Contact `json:"contacts"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Identifier returns the user's primary identifier
+func (p *Profile) Identifier() string {
+	if len(p.Identifiers) == 0 {
+		return ""
+	}
+	return p.Identifiers[0].Identifier
+}
+
+// profileV1 holds the fields of version 1 profiles that were replaced in version 2
+type profileV1 struct {
+	Identifier string `json:"identifier"`
+	Left       []byte `json:"left"`
+	Right      []byte `json:"right"`
+	Contacts   []struct {
+		Outgoing []byte `json:"outgoing"`
+		Incoming []byte `json:"incoming"`
+	} `json:"contacts"`
+}
+
+// upgradeV1 decodes a version 1 profile: its single identifier becomes the primary one, and every contact
+// found was found with it
+func upgradeV1(plaintext []byte) (*Profile, error) {
+	var p Profile
+	if err := json.Unmarshal(plaintext, &p); err != nil {
+		return nil, err
+	}
+	var v1 profileV1
+	if err := json.Unmarshal(plaintext, &v1); err != nil {
+		return nil, err
+	}
+
+	p.Identifiers = []Identifier{{Identifier: v1.Identifier, Left: v1.Left, Right: v1.Right}}
+	for i := range p.Contacts {
+		c := &p.Contacts[i]
+		if old := v1.Contacts[i]; old.Outgoing != nil && old.Incoming != nil {
+			c.Keys = []SharedKeys{{Own: v1.Identifier, Outgoing: old.Outgoing, Incoming: old.Incoming}}
+		}
+		if c.Discovered() {
+			c.MatchedBy = v1.Identifier
+		}
+	}
+
+	return &p, nil
+}
+
+// envelope is the encrypted form of a profile written to disk
+type envelope struct {
+	Version    int     `json:"version"`
+	KDF        pbe.KDF `json:"kdf"`
+	Nonce      []byte  `json:"nonce"`
+	Ciphertext []byte  `json:"ciphertext"`
+}
+
+// additionalData authenticates the clear fields of the envelope
+func (e *envelope) additionalData() ([]byte, error) {
+	return json.Marshal(struct {
+		Version int     `json:"version"`
+		KDF     pbe.KDF `json:"kdf"`
+	}{e.Version, e.KDF})
+}
+
+// Save encrypts the profile under the passphrase and writes it to path. The file is replaced atomically
+func Save(path string, passphrase []byte, p *Profile) error {
+	return save(path, passphrase, Version, p)
+}
+
+// save writes v as a profile of the given format version
+func save(path string, passphrase []byte, version int, v interface{}) error {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	e := envelope{Version: version}
+	if e.KDF, err = pbe.NewKDF(scryptN, scryptR, scryptP); err != nil {
+		return err
+	}
+	aead, err := e.KDF.AEAD(passphrase)
+	if err != nil {
+		return err
+	}
+	additionalData, err := e.additionalData()
+	if err != nil {
+		return err
+	}
+	if e.Nonce, e.Ciphertext, err = pbe.Seal(aead, plaintext, additionalData); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load decrypts the profile stored at path
+func Load(path string, passphrase []byte) (*Profile, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e envelope
+	if err := json.Unmarshal(buf, &e); err != nil {
+		return nil, fmt.Errorf("profile: %s: %v", path, err)
+	}
+	if e.Version != Version && e.Version != 1 {
+		return nil, fmt.Errorf("profile: %s: unsupported version %d", path, e.Version)
+	}
+
+	aead, err := e.KDF.AEAD(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	additionalData, err := e.additionalData()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := pbe.Open(aead, e.Nonce, e.Ciphertext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Version == 1 {
+		p, err := upgradeV1(plaintext)
+		if err != nil {
+			return nil, fmt.Errorf("profile: %s: %v", path, err)
+		}
+		return p, nil
+	}
+	var p Profile
+	if err := json.Unmarshal(plaintext, &p); err != nil {
+		return nil, fmt.Errorf("profile: %s: %v", path, err)
+	}
+
+	return &p, nil
+}
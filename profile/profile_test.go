@@ -0,0 +1,132 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto/pbe"
+)
+
+func init() {
+	// keep the tests fast
+	scryptN = 1 << 10
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alice.profile")
+
+	found := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	p := &Profile{
+		Identifiers: []Identifier{
+			{Identifier: "alice", Left: []byte{1, 2, 3}, Right: []byte{4, 5, 6}},
+			{Identifier: "alice@example.org", Left: []byte{9}, Right: []byte{10}},
+		},
+		Parameters: "653a7390e967340f7144d47ce3bb8d0f",
+		Region:     "GB",
+		Contacts: []Contact{
+			{Identifier: "bob", Keys: []SharedKeys{{Own: "alice", Outgoing: []byte{7}, Incoming: []byte{8}}}, LastChecked: found, DiscoveredAt: found, MatchedBy: "alice", Card: []byte("bob")},
+			{Identifier: "carol"},
+		},
+	}
+	if err := Save(path, []byte("correct horse"), p); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Identifier() != "alice" || len(loaded.Identifiers) != 2 || !bytes.Equal(loaded.Identifiers[1].Left, p.Identifiers[1].Left) || len(loaded.Contacts) != 2 || loaded.Region != "GB" {
+		t.Errorf("Profile was not restored: %+v", loaded)
+	}
+	if !loaded.Contacts[0].Discovered() || !loaded.Contacts[0].DiscoveredAt.Equal(found) || loaded.Contacts[1].Discovered() {
+		t.Errorf("Discovery status was not restored: %+v", loaded.Contacts)
+	}
+
+	if _, err := Load(path, []byte("wrong horse")); err != ErrWrongPassphrase {
+		t.Errorf("Loaded with the wrong passphrase: %v", err)
+	}
+
+	// The identifier and the contacts never appear in the clear
+	buf, _ := ioutil.ReadFile(path)
+	if bytes.Contains(buf, []byte("alice")) || bytes.Contains(buf, []byte("carol")) {
+		t.Errorf("Profile file leaks the user's data")
+	}
+}
+
+func TestLoadVersion1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alice.profile")
+
+	found := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	v1 := map[string]interface{}{
+		"identifier": "alice",
+		"parameters": "653a7390e967340f7144d47ce3bb8d0f",
+		"left":       []byte{1, 2, 3},
+		"right":      []byte{4, 5, 6},
+		"contacts": []map[string]interface{}{
+			{"identifier": "bob", "outgoing": []byte{7}, "incoming": []byte{8}, "discovered_at": found},
+			{"identifier": "carol"},
+		},
+	}
+	if err := save(path, []byte("correct horse"), 1, v1); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path, []byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Identifier() != "alice" || len(loaded.Identifiers) != 1 || !bytes.Equal(loaded.Identifiers[0].Right, []byte{4, 5, 6}) {
+		t.Errorf("Identifier was not upgraded: %+v", loaded.Identifiers)
+	}
+	bob, carol := loaded.Contacts[0], loaded.Contacts[1]
+	if len(bob.Keys) != 1 || bob.Keys[0].Own != "alice" || !bytes.Equal(bob.Keys[0].Incoming, []byte{8}) || bob.MatchedBy != "alice" {
+		t.Errorf("Contact found with the single identifier was not upgraded: %+v", bob)
+	}
+	if len(carol.Keys) != 0 || carol.MatchedBy != "" {
+		t.Errorf("Contact without keys was upgraded with some: %+v", carol)
+	}
+}
+
+func TestExpensiveKDFRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "alice.profile")
+
+	if err := Save(path, []byte("correct horse"), &Profile{Identifiers: []Identifier{{Identifier: "alice"}}}); err != nil {
+		t.Fatal(err)
+	}
+	buf, _ := ioutil.ReadFile(path)
+
+	// A crafted profile cannot make the key derivation use up the machine
+	for _, cost := range [][3]int{{1 << 30, scryptR, scryptP}, {scryptN, pbe.MaxR + 1, scryptP}, {scryptN, scryptR, pbe.MaxP + 1}} {
+		var e envelope
+		if err := json.Unmarshal(buf, &e); err != nil {
+			t.Fatal(err)
+		}
+		e.KDF.N, e.KDF.R, e.KDF.P = cost[0], cost[1], cost[2]
+		expensive, _ := json.Marshal(e)
+		ioutil.WriteFile(path, expensive, 0600)
+		if _, err := Load(path, []byte("correct horse")); err == nil || err == ErrWrongPassphrase {
+			t.Errorf("Key derivation with N=%d r=%d p=%d was attempted", cost[0], cost[1], cost[2])
+		}
+	}
+}
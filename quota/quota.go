@@ -0,0 +1,280 @@
+// Package quota limits how often constraining keys are issued. Without limits, an attacker can enumerate
+// the identifier space by requesting keys for guessed identifiers. A Limiter combines a token bucket per
+// account, a global token bucket shared by all accounts and a cap on the number of distinct identifiers
+// each account may obtain keys for
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrExceeded is wrapped by every error returned when a quota is exceeded
+var ErrExceeded = errors.New("quota exceeded")
+
+var (
+	// ErrRateLimited is returned when an account sends requests faster than its rate
+	ErrRateLimited = fmt.Errorf("%w: account rate limit", ErrExceeded)
+	// ErrGlobalRateLimited is returned when all accounts together send requests faster than the global rate
+	ErrGlobalRateLimited = fmt.Errorf("%w: global rate limit", ErrExceeded)
+	// ErrTooManyIdentifiers is returned when an account requests keys for one identifier too many
+	ErrTooManyIdentifiers = fmt.Errorf("%w: too many identifiers for this account", ErrExceeded)
+)
+
+// Clock returns the current time. Tests use a FakeClock to control the refill of the buckets
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// FakeClock is a Clock that only moves when told to
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a clock stopped at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now implements Clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Config sets the limits enforced by a Limiter. A zero rate or cap disables the corresponding limit
+type Config struct {
+	// Rate is the number of requests per second each account may send, Burst the number it may send at once
+	Rate  float64
+	Burst int
+	// GlobalRate and GlobalBurst apply to all accounts together
+	GlobalRate  float64
+	GlobalBurst int
+	// MaxIdentifiers caps the number of distinct identifiers an account may obtain keys for
+	MaxIdentifiers int
+	// IdleTimeout is how long the limiter remembers an account after its last request, 24 hours by
+	// default. The identifier cap applies to the identifiers requested until the account is forgotten
+	IdleTimeout time.Duration
+	// Clock defaults to the system clock
+	Clock Clock
+}
+
+// defaultIdleTimeout is the IdleTimeout of a Config that does not set one
+const defaultIdleTimeout = 24 * time.Hour
+
+// Metrics counts the decisions taken by a Limiter
+type Metrics struct {
+	Allowed            uint64 `json:"allowed"`
+	RateLimited        uint64 `json:"rate_limited"`
+	GlobalLimited      uint64 `json:"global_limited"`
+	TooManyIdentifiers uint64 `json:"too_many_identifiers"`
+}
+
+// bucket is a token bucket holding up to burst tokens and refilled at rate tokens per second
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) refill(now time.Time, rate float64, burst int) {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.last = now
+}
+
+// account is the state kept for one account: its token bucket and the identifiers it obtained keys for
+type account struct {
+	bucket      bucket
+	identifiers map[string]bool
+	lastSeen    time.Time
+}
+
+// Limiter enforces a Config. It is safe for concurrent use
+type Limiter struct {
+	mu        sync.Mutex
+	config    Config
+	accounts  map[string]*account
+	global    *bucket
+	lastSweep time.Time
+	metrics   Metrics
+}
+
+// New returns a Limiter enforcing config. Buckets start full
+func New(config Config) *Limiter {
+	if config.Clock == nil {
+		config.Clock = systemClock{}
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultIdleTimeout
+	}
+	now := config.Clock.Now()
+
+	return &Limiter{
+		config:    config,
+		accounts:  make(map[string]*account),
+		global:    &bucket{tokens: float64(config.GlobalBurst), last: now},
+		lastSweep: now,
+	}
+}
+
+// Reservation is quota used up by an allowed request. It is given back with Cancel when the request fails
+// before the keys are issued
+type Reservation struct {
+	limiter    *Limiter
+	account    string
+	identifier string
+	// newIdentifier is set when the request added identifier to the account's identifiers
+	newIdentifier bool
+	global, rate  bool
+	cancelled     bool
+}
+
+// Allow records a request from account for keys on identifier, or returns an error wrapping ErrExceeded if
+// the request goes over one of the limits. Rejected requests do not use up any quota
+func (l *Limiter) Allow(account, identifier string) error {
+	_, err := l.Reserve(account, identifier)
+	return err
+}
+
+// Reserve is Allow for requests that may still fail once allowed: the quota they used up is given back by
+// cancelling the reservation
+func (l *Limiter) Reserve(accountID, identifier string) (*Reservation, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.config.Clock.Now()
+	l.sweep(now)
+
+	a := l.accounts[accountID]
+	if a == nil {
+		a = &account{bucket: bucket{tokens: float64(l.config.Burst), last: now}}
+	}
+	known := a.identifiers[identifier]
+	if l.config.MaxIdentifiers > 0 && !known && len(a.identifiers) >= l.config.MaxIdentifiers {
+		l.metrics.TooManyIdentifiers++
+		return nil, ErrTooManyIdentifiers
+	}
+
+	if l.config.GlobalRate > 0 {
+		l.global.refill(now, l.config.GlobalRate, l.config.GlobalBurst)
+		if l.global.tokens < 1 {
+			l.metrics.GlobalLimited++
+			return nil, ErrGlobalRateLimited
+		}
+	}
+
+	if l.config.Rate > 0 {
+		a.bucket.refill(now, l.config.Rate, l.config.Burst)
+		if a.bucket.tokens < 1 {
+			l.metrics.RateLimited++
+			return nil, ErrRateLimited
+		}
+	}
+
+	// The request is within every limit, use up the quota
+	r := &Reservation{limiter: l, account: accountID, identifier: identifier}
+	if l.config.GlobalRate > 0 {
+		l.global.tokens--
+		r.global = true
+	}
+	if l.config.Rate > 0 {
+		a.bucket.tokens--
+		r.rate = true
+	}
+	if l.config.MaxIdentifiers > 0 && !known {
+		if a.identifiers == nil {
+			a.identifiers = make(map[string]bool)
+		}
+		a.identifiers[identifier] = true
+		r.newIdentifier = true
+	}
+	if l.config.Rate > 0 || l.config.MaxIdentifiers > 0 {
+		a.lastSeen = now
+		l.accounts[accountID] = a
+	}
+	l.metrics.Allowed++
+
+	return r, nil
+}
+
+// Cancel gives back the quota used up by the reservation. Cancelling twice, or a nil reservation, has no effect
+func (r *Reservation) Cancel() {
+	if r == nil {
+		return
+	}
+	l := r.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if r.cancelled {
+		return
+	}
+	r.cancelled = true
+	l.metrics.Allowed--
+
+	if r.global {
+		l.global.tokens++
+		if l.global.tokens > float64(l.config.GlobalBurst) {
+			l.global.tokens = float64(l.config.GlobalBurst)
+		}
+	}
+	// The account may have been forgotten meanwhile, in which case there is nothing left to give back
+	a := l.accounts[r.account]
+	if a == nil {
+		return
+	}
+	if r.rate {
+		a.bucket.tokens++
+		if a.bucket.tokens > float64(l.config.Burst) {
+			a.bucket.tokens = float64(l.config.Burst)
+		}
+	}
+	if r.newIdentifier {
+		delete(a.identifiers, r.identifier)
+	}
+}
+
+// sweep forgets the accounts idle for longer than the idle timeout. It walks all accounts at most once per
+// timeout, so that the cost of a sweep is spread over the requests of a whole timeout
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.config.IdleTimeout {
+		return
+	}
+	for id, a := range l.accounts {
+		if now.Sub(a.lastSeen) >= l.config.IdleTimeout {
+			delete(l.accounts, id)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Metrics returns a snapshot of the limiter's counters
+func (l *Limiter) Metrics() Metrics {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.metrics
+}
+
+// Accounts returns the number of accounts the limiter currently remembers
+func (l *Limiter) Accounts() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.accounts)
+}
@@ -0,0 +1,147 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAccountRate(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	l := New(Config{Rate: 1, Burst: 2, Clock: clock})
+
+	for i := 0; i < 2; i++ {
+		if err := l.Allow("alice", "alice"); err != nil {
+			t.Fatalf("Request %d within the burst was rejected: %s", i, err)
+		}
+	}
+	if err := l.Allow("alice", "alice"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Request over the burst was not rate limited: %v", err)
+	}
+	if err := l.Allow("bob", "bob"); err != nil {
+		t.Errorf("Another account was rate limited: %s", err)
+	}
+
+	clock.Advance(time.Second)
+	if err := l.Allow("alice", "alice"); err != nil {
+		t.Errorf("Request was rejected after the bucket refilled: %s", err)
+	}
+	if err := l.Allow("alice", "alice"); !errors.Is(err, ErrExceeded) {
+		t.Errorf("Bucket refilled faster than its rate: %v", err)
+	}
+
+	if m := l.Metrics(); m.Allowed != 4 || m.RateLimited != 2 {
+		t.Errorf("Wrong metrics: %+v", m)
+	}
+}
+
+func TestGlobalRate(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	l := New(Config{Rate: 10, Burst: 10, GlobalRate: 1, GlobalBurst: 3, Clock: clock})
+
+	for _, account := range []string{"alice", "bob", "carol"} {
+		if err := l.Allow(account, account); err != nil {
+			t.Fatalf("Request within the global burst was rejected: %s", err)
+		}
+	}
+	if err := l.Allow("dave", "dave"); !errors.Is(err, ErrGlobalRateLimited) {
+		t.Errorf("Request over the global burst was not limited: %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if err := l.Allow("dave", "dave"); err != nil {
+		t.Errorf("Request was rejected after the global bucket refilled: %s", err)
+	}
+
+	if m := l.Metrics(); m.GlobalLimited != 1 {
+		t.Errorf("Wrong metrics: %+v", m)
+	}
+}
+
+func TestIdentifierCap(t *testing.T) {
+	l := New(Config{MaxIdentifiers: 2})
+
+	for _, id := range []string{"+447700900001", "+447700900002", "+447700900001"} {
+		if err := l.Allow("mallory", id); err != nil {
+			t.Fatalf("Request for %s was rejected: %s", id, err)
+		}
+	}
+	if err := l.Allow("mallory", "+447700900003"); !errors.Is(err, ErrTooManyIdentifiers) {
+		t.Errorf("Third identifier was not rejected: %v", err)
+	}
+	if err := l.Allow("alice", "+447700900003"); err != nil {
+		t.Errorf("Another account was capped: %s", err)
+	}
+
+	if m := l.Metrics(); m.Allowed != 4 || m.TooManyIdentifiers != 1 {
+		t.Errorf("Wrong metrics: %+v", m)
+	}
+}
+
+func TestRejectedRequestsAreFree(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	l := New(Config{Rate: 1, Burst: 1, MaxIdentifiers: 1, Clock: clock})
+
+	if err := l.Allow("alice", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	// A request over the identifier cap must not drain the rate bucket
+	clock.Advance(time.Second)
+	if err := l.Allow("alice", "bob"); !errors.Is(err, ErrTooManyIdentifiers) {
+		t.Fatalf("Second identifier was not rejected: %v", err)
+	}
+	if err := l.Allow("alice", "alice"); err != nil {
+		t.Errorf("Rejected request used up quota: %s", err)
+	}
+}
+
+func TestCancelledReservationsAreFree(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	l := New(Config{Rate: 1, Burst: 1, GlobalRate: 1, GlobalBurst: 1, MaxIdentifiers: 1, Clock: clock})
+
+	r, err := l.Reserve("alice", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Cancel()
+	r.Cancel()
+	if err := l.Allow("alice", "bob"); err != nil {
+		t.Errorf("Cancelled reservation used up quota: %s", err)
+	}
+	if err := l.Allow("carol", "carol"); !errors.Is(err, ErrGlobalRateLimited) {
+		t.Errorf("Cancelling twice gave back quota twice: %v", err)
+	}
+	if m := l.Metrics(); m.Allowed != 1 {
+		t.Errorf("Wrong metrics: %+v", m)
+	}
+}
+
+func TestIdleAccountsForgotten(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	l := New(Config{Rate: 1, Burst: 1, MaxIdentifiers: 1, IdleTimeout: time.Hour, Clock: clock})
+
+	for _, account := range []string{"alice", "bob", "carol"} {
+		if err := l.Allow(account, account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := l.Accounts(); n != 3 {
+		t.Fatalf("Remembering %d accounts, want 3", n)
+	}
+
+	// Alice keeps sending requests, the others stay idle until they are forgotten
+	clock.Advance(30 * time.Minute)
+	if err := l.Allow("alice", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(30 * time.Minute)
+	if err := l.Allow("dave", "dave"); err != nil {
+		t.Fatal(err)
+	}
+	if n := l.Accounts(); n != 2 {
+		t.Errorf("Remembering %d accounts after the idle ones expired, want 2", n)
+	}
+	if err := l.Allow("alice", "bob"); !errors.Is(err, ErrTooManyIdentifiers) {
+		t.Errorf("An active account was forgotten: %v", err)
+	}
+}
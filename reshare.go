@@ -0,0 +1,657 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/share"
+	dkg "go.dedis.ch/kyber/v3/share/dkg/pedersen"
+	vss "go.dedis.ch/kyber/v3/share/vss/pedersen"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+// Endpoints of the reshare protocol, one per step (see reshare)
+const (
+	reshareKeyEndpoint            = "/reshare/key"
+	reshareDealsEndpoint          = "/reshare/deals"
+	reshareResponsesEndpoint      = "/reshare/responses"
+	reshareJustificationsEndpoint = "/reshare/justifications"
+	reshareFinishEndpoint         = "/reshare/finish"
+	reshareCommitEndpoint         = "/reshare/commit"
+)
+
+// reshareInTransport is the message exchanged between the coordinator of a reshare and the servers. Each
+// step only sets the fields it needs
+type reshareInTransport struct {
+	Session string `json:"session"`
+	// Key is the long-term public key the server picked for the session
+	Key []byte `json:"key,omitempty"`
+	// OldNodes and NewNodes are the long-term public keys of both committees, Commits the coefficients of
+	// the public polynomial in G2 being reshared
+	OldNodes     [][]byte `json:"old_nodes,omitempty"`
+	NewNodes     [][]byte `json:"new_nodes,omitempty"`
+	Commits      [][]byte `json:"commits,omitempty"`
+	Threshold    int      `json:"threshold,omitempty"`
+	OldThreshold int      `json:"old_threshold,omitempty"`
+	// Deals returned by a dealer are indexed by the position of their recipient in the new committee,
+	// deals sent to their recipient by the position of their dealer in the old committee
+	Deals          map[int]*dkg.Deal          `json:"deals,omitempty"`
+	Responses      []*dkg.Response            `json:"responses,omitempty"`
+	Justifications []justificationInTransport `json:"justifications,omitempty"`
+	// Index is the index of the server's new share, PublicShare that share times the base point of G1
+	Index       int    `json:"index,omitempty"`
+	PublicShare []byte `json:"public_share,omitempty"`
+	// Parameters are the public parameters of the new committee in JSON, as published to users
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// justificationInTransport is the serialisable form of a dkg.Justification, which reveals the deal a
+// verifier complained about
+type justificationInTransport struct {
+	Dealer      uint32   `json:"dealer"`
+	SessionID   []byte   `json:"session_id"`
+	Verifier    uint32   `json:"verifier"`
+	Signature   []byte   `json:"signature"`
+	DealSession []byte   `json:"deal_session"`
+	ShareIndex  int      `json:"share_index"`
+	Share       []byte   `json:"share"`
+	T           uint32   `json:"t"`
+	Commitments [][]byte `json:"commitments"`
+}
+
+func newJustificationInTransport(j *dkg.Justification) (justificationInTransport, error) {
+	deal := j.Justification.Deal
+	out := justificationInTransport{
+		Dealer:      j.Index,
+		SessionID:   j.Justification.SessionID,
+		Verifier:    j.Justification.Index,
+		Signature:   j.Justification.Signature,
+		DealSession: deal.SessionID,
+		ShareIndex:  deal.SecShare.I,
+		T:           deal.T,
+	}
+	var err error
+	if out.Share, err = deal.SecShare.V.MarshalBinary(); err != nil {
+		return justificationInTransport{}, err
+	}
+	if out.Commitments, err = marshalPoints(deal.Commitments); err != nil {
+		return justificationInTransport{}, err
+	}
+
+	return out, nil
+}
+
+func (j justificationInTransport) decode(group kyber.Group) (*dkg.Justification, error) {
+	v := group.Scalar()
+	if err := v.UnmarshalBinary(j.Share); err != nil {
+		return nil, err
+	}
+	commitments, err := unmarshalPoints(group, j.Commitments)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dkg.Justification{
+		Index: j.Dealer,
+		Justification: &vss.Justification{
+			SessionID: j.SessionID,
+			Index:     j.Verifier,
+			Signature: j.Signature,
+			Deal: &vss.Deal{
+				SessionID:   j.DealSession,
+				SecShare:    &share.PriShare{I: j.ShareIndex, V: v},
+				T:           j.T,
+				Commitments: commitments,
+			},
+		},
+	}, nil
+}
+
+func marshalPoints(points []kyber.Point) ([][]byte, error) {
+	out := make([][]byte, len(points))
+	for i, p := range points {
+		buf, err := p.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		out[i] = buf
+	}
+	return out, nil
+}
+
+func unmarshalPoints(group kyber.Group, encoded [][]byte) ([]kyber.Point, error) {
+	points := make([]kyber.Point, len(encoded))
+	for i, buf := range encoded {
+		points[i] = group.Point()
+		if err := points[i].UnmarshalBinary(buf); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+// reshareState is what a server needs to take part in reshares run over the network, and the state of
+// the reshare in progress
+type reshareState struct {
+	// token authenticates the coordinator of a reshare
+	token []byte
+	// save persists the shares installed by a reshare under the server's new ID, forget deletes the
+	// persisted share of a server leaving the committee. Both are given the share the server held before,
+	// nil for a server joining the committee, and may be nil
+	save   func(id int, keys crypto.MasterSecretShares, old *share.PriShare) error
+	forget func(old *share.PriShare) error
+
+	mu      sync.Mutex
+	session string
+	// oldIndex and newIndex are the positions of the server in each committee, -1 when it is not part of it
+	oldIndex, newIndex int
+	staged             *share.PriShare
+	// parameters are those of the committee the server joined in its last reshare, if any
+	parameters *publicParameters
+}
+
+// newReshareState lets a server take part in reshares coordinated by whoever presents token
+func newReshareState(token []byte) *reshareState {
+	return &reshareState{token: token}
+}
+
+// current returns the parameters of the server's committee: those it was started with unless it has
+// taken part in a reshare since
+func (r *reshareState) current(parameters publicParameters) publicParameters {
+	if r.parameters != nil {
+		return *r.parameters
+	}
+	return parameters
+}
+
+// authorised reports whether the request carries the reshare token as a bearer token
+func (r *reshareState) authorised(req *http.Request) bool {
+	presented := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return len(r.token) > 0 && subtle.ConstantTimeCompare([]byte(presented), r.token) == 1
+}
+
+// reshareKey starts a session: the server picks the long-term key that authenticates its messages in it.
+// A session in progress is abandoned
+func (s *server) reshareKey(parameters publicParameters, msg reshareInTransport) (reshareInTransport, error) {
+	if msg.Session == "" {
+		return reshareInTransport{}, errors.New("reshare: no session")
+	}
+	s.participant = newDKGParticipant(parameters.Suite)
+	s.resharing.session, s.resharing.staged = msg.Session, nil
+	s.resharing.oldIndex, s.resharing.newIndex = -1, -1
+
+	key, err := s.participant.Public.MarshalBinary()
+	if err != nil {
+		return reshareInTransport{}, err
+	}
+	return reshareInTransport{Session: msg.Session, Key: key}, nil
+}
+
+// reshareDeals sets up the server's generator for both committees. A server of the old committee checks
+// its share against the public polynomial and returns its deals, encrypted to each new server
+func (s *server) reshareDeals(parameters publicParameters, msg reshareInTransport) (reshareInTransport, error) {
+	group := newDKGSuite(parameters.Suite)
+	oldNodes, err := unmarshalPoints(group, msg.OldNodes)
+	if err != nil {
+		return reshareInTransport{}, err
+	}
+	newNodes, err := unmarshalPoints(group, msg.NewNodes)
+	if err != nil {
+		return reshareInTransport{}, err
+	}
+	commits, err := unmarshalPoints(group, msg.Commits)
+	if err != nil {
+		return reshareInTransport{}, err
+	}
+	if len(commits) == 0 || !commits[0].Equal(s.resharing.current(parameters).PublicPolynomials[0].Commit()) {
+		return reshareInTransport{}, errors.New("reshare: not the public key of the server's committee")
+	}
+
+	r := s.resharing
+	for i, n := range oldNodes {
+		if n.Equal(s.participant.Public) {
+			r.oldIndex = i
+		}
+	}
+	for i, n := range newNodes {
+		if n.Equal(s.participant.Public) {
+			r.newIndex = i
+		}
+	}
+	if r.oldIndex < 0 && r.newIndex < 0 {
+		return reshareInTransport{}, errors.New("reshare: the server is in neither committee")
+	}
+
+	c := &dkg.Config{
+		Suite:        group,
+		Longterm:     s.participant.longterm,
+		OldNodes:     oldNodes,
+		NewNodes:     newNodes,
+		PublicCoeffs: commits,
+		Threshold:    msg.Threshold,
+		OldThreshold: msg.OldThreshold,
+	}
+	if r.oldIndex >= 0 {
+		sh, err := s.share()
+		if err != nil {
+			return reshareInTransport{}, err
+		}
+		if !share.NewPubPoly(group, group.Point().Base(), commits).Check(sh) {
+			return reshareInTransport{}, errors.New("reshare: the server's share is not on the public polynomial")
+		}
+		c.Share = &dkg.DistKeyShare{Commits: commits, Share: sh}
+	}
+	if s.participant.generator, err = dkg.NewDistKeyHandler(c); err != nil {
+		return reshareInTransport{}, err
+	}
+
+	out := reshareInTransport{Session: msg.Session}
+	if r.oldIndex >= 0 {
+		if out.Deals, err = s.participant.generator.Deals(); err != nil {
+			return reshareInTransport{}, err
+		}
+	}
+	return out, nil
+}
+
+// reshareResponses processes the deals sent to a server of the new committee and returns its responses
+func (s *server) reshareResponses(parameters publicParameters, msg reshareInTransport) (reshareInTransport, error) {
+	out := reshareInTransport{Session: msg.Session}
+	for _, deal := range msg.Deals {
+		resp, err := s.participant.generator.ProcessDeal(deal)
+		if err != nil {
+			return reshareInTransport{}, err
+		}
+		out.Responses = append(out.Responses, resp)
+	}
+	return out, nil
+}
+
+// reshareJustifications processes the responses broadcast to both committees, except the server's own,
+// and returns the justifications the server owes as a dealer
+func (s *server) reshareJustifications(parameters publicParameters, msg reshareInTransport) (reshareInTransport, error) {
+	out := reshareInTransport{Session: msg.Session}
+	for _, resp := range msg.Responses {
+		if resp == nil || resp.Response == nil {
+			return reshareInTransport{}, errors.New("reshare: malformed response")
+		}
+		if s.resharing.newIndex >= 0 && resp.Response.Index == uint32(s.resharing.newIndex) {
+			continue
+		}
+		j, err := s.participant.generator.ProcessResponse(resp)
+		if err != nil {
+			return reshareInTransport{}, err
+		}
+		if j != nil {
+			encoded, err := newJustificationInTransport(j)
+			if err != nil {
+				return reshareInTransport{}, err
+			}
+			out.Justifications = append(out.Justifications, encoded)
+		}
+	}
+	return out, nil
+}
+
+// reshareFinish processes the justifications and computes the server's new share. The share is staged
+// until the coordinator commits the reshare, the response only holds its public counterparts
+func (s *server) reshareFinish(parameters publicParameters, msg reshareInTransport) (reshareInTransport, error) {
+	if s.resharing.newIndex < 0 {
+		return reshareInTransport{}, errors.New("reshare: the server is not in the new committee")
+	}
+	group := newDKGSuite(parameters.Suite)
+	for _, encoded := range msg.Justifications {
+		j, err := encoded.decode(group)
+		if err != nil {
+			return reshareInTransport{}, err
+		}
+		if err := s.participant.generator.ProcessJustification(j); err != nil {
+			return reshareInTransport{}, err
+		}
+	}
+
+	sh, commits, err := s.finishDKG()
+	if err != nil {
+		return reshareInTransport{}, err
+	}
+	s.resharing.staged = sh
+
+	out := reshareInTransport{Session: msg.Session, Index: sh.I}
+	if out.Commits, err = marshalPoints(commits); err != nil {
+		return reshareInTransport{}, err
+	}
+	if out.PublicShare, err = parameters.Suite.G1().Point().Mul(sh.V, nil).MarshalBinary(); err != nil {
+		return reshareInTransport{}, err
+	}
+	return out, nil
+}
+
+// reshareCommit ends the session once every server has computed its share. A server of the new
+// committee checks its staged share against the new parameters, saves it and signs with it from then
+// on. A server leaving the committee forgets its share
+func (s *server) reshareCommit(parameters publicParameters, msg reshareInTransport) (reshareInTransport, error) {
+	r := s.resharing
+	current := r.current(parameters)
+	next, _, err := unmarshalParametersJSON(msg.Parameters, "")
+	if err != nil {
+		return reshareInTransport{}, err
+	}
+	if !next.PublicPolynomials[0].Commit().Equal(current.PublicPolynomials[0].Commit()) || !next.PublicPolynomials[1].Commit().Equal(current.PublicPolynomials[1].Commit()) {
+		return reshareInTransport{}, errors.New("reshare: the public key has changed")
+	}
+	nextSuite, _ := suiteName(next.Suite)
+	currentSuite, _ := suiteName(current.Suite)
+	if nextSuite != currentSuite || next.EpochLength != current.EpochLength {
+		return reshareInTransport{}, errors.New("reshare: the new parameters change the suite or the epochs")
+	}
+
+	old, _ := s.share()
+	if r.newIndex < 0 {
+		s.retire()
+		if r.forget != nil && old != nil {
+			if err := r.forget(old); err != nil {
+				return reshareInTransport{}, err
+			}
+		}
+		r.session = ""
+		return reshareInTransport{Session: msg.Session}, nil
+	}
+
+	sh := r.staged
+	if sh == nil {
+		return reshareInTransport{}, errors.New("reshare: no share staged")
+	}
+	if !next.PublicPolynomials[0].Check(sh) || !next.PublicPolynomials[1].Check(sh) {
+		return reshareInTransport{}, errors.New("reshare: the staged share does not match the new parameters")
+	}
+	keys := crypto.MasterSecretShares{
+		&share.PriShare{I: sh.I, V: sh.V.Clone()},
+		&share.PriShare{I: sh.I, V: sh.V.Clone()},
+	}
+	if r.save != nil {
+		if err := r.save(sh.I, keys, old); err != nil {
+			return reshareInTransport{}, err
+		}
+	}
+	s.installShare(sh)
+	s.mu.Lock()
+	s.ID = sh.I
+	s.mu.Unlock()
+	r.parameters = &next
+	r.session, r.staged = "", nil
+
+	return reshareInTransport{Session: msg.Session}, nil
+}
+
+// handleReshare serves one step of the reshare protocol to the coordinator holding the reshare token.
+// Steps of a session other than the server's current one are refused
+func (s *server) handleReshare(parameters publicParameters, step func(publicParameters, reshareInTransport) (reshareInTransport, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "reshare: method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.resharing.authorised(r) {
+			http.Error(w, "reshare: unauthorised", http.StatusUnauthorized)
+			return
+		}
+
+		var msg reshareInTransport
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, "reshare: malformed request", http.StatusBadRequest)
+			return
+		}
+
+		s.resharing.mu.Lock()
+		var out reshareInTransport
+		var err error
+		switch {
+		case r.URL.Path != reshareKeyEndpoint && (msg.Session == "" || msg.Session != s.resharing.session || s.participant == nil):
+			err = errors.New("reshare: unknown session")
+		case r.URL.Path != reshareKeyEndpoint && r.URL.Path != reshareDealsEndpoint && r.URL.Path != reshareCommitEndpoint && s.participant.generator == nil:
+			err = errors.New("reshare: the session has no deals yet")
+		default:
+			out, err = step(parameters, msg)
+		}
+		s.resharing.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// handleReshareSteps registers the endpoints of the reshare protocol on mux
+func (s *server) handleReshareSteps(parameters publicParameters, mux *http.ServeMux) {
+	mux.HandleFunc(reshareKeyEndpoint, s.handleReshare(parameters, s.reshareKey))
+	mux.HandleFunc(reshareDealsEndpoint, s.handleReshare(parameters, s.reshareDeals))
+	mux.HandleFunc(reshareResponsesEndpoint, s.handleReshare(parameters, s.reshareResponses))
+	mux.HandleFunc(reshareJustificationsEndpoint, s.handleReshare(parameters, s.reshareJustifications))
+	mux.HandleFunc(reshareFinishEndpoint, s.handleReshare(parameters, s.reshareFinish))
+	mux.HandleFunc(reshareCommitEndpoint, s.handleReshare(parameters, s.reshareCommit))
+}
+
+// reshareParticipant is a server taking part in a reshare, as seen by the coordinator
+type reshareParticipant struct {
+	endpoint           *serverEndpoint
+	oldIndex, newIndex int
+	key                []byte
+}
+
+// reshare moves the secret behind the public polynomials from the committee serving parameters to a new
+// committee, with a (newThreshold, len(newCommittee)) sharing. The committees may overlap: servers are
+// matched by address, and the servers of the new committee are numbered in the order given. The public
+// key is unchanged, so users' constraining keys and meeting points remain valid. Resharing to the same
+// committee refreshes the shares: shares obtained before cannot be combined with shares obtained after.
+//
+// The coordinator drives the servers' reshare endpoints with their reshare token and routes the messages
+// of a Pedersen DKG between them. Deals are encrypted to their recipients, so the coordinator never sees a
+// share. New shares are only installed once every server has computed its share and the public key is
+// known to be unchanged, then servers leaving the committee forget theirs. It returns the parameters and
+// the endpoints of the new committee
+func reshare(ctx context.Context, parameters publicParameters, oldCommittee, newCommittee []*serverEndpoint, newThreshold int) (publicParameters, []*serverEndpoint, error) {
+	if len(oldCommittee) != parameters.TotalServers {
+		return parameters, nil, errors.New("reshare: every server of the old committee takes part")
+	}
+	for i, e := range oldCommittee {
+		if e.ID != i {
+			return parameters, nil, errors.New("reshare: the old committee must be listed in the order of the servers' IDs")
+		}
+	}
+	if newThreshold < 1 || newThreshold > len(newCommittee) {
+		return parameters, nil, errors.New("reshare: invalid threshold for the new committee")
+	}
+
+	// Servers in both committees take part once
+	var participants []*reshareParticipant
+	byAddress := make(map[string]*reshareParticipant)
+	join := func(e *serverEndpoint) *reshareParticipant {
+		p, found := byAddress[e.Address]
+		if !found {
+			p = &reshareParticipant{endpoint: e, oldIndex: -1, newIndex: -1}
+			byAddress[e.Address] = p
+			participants = append(participants, p)
+		}
+		return p
+	}
+	for i, e := range oldCommittee {
+		join(e).oldIndex = i
+	}
+	newEndpoints := make([]*serverEndpoint, len(newCommittee))
+	newParticipants := make([]*reshareParticipant, len(newCommittee))
+	for i, e := range newCommittee {
+		newEndpoints[i] = newServerEndpoint(i, e.Address)
+		newEndpoints[i].token = e.token
+		newParticipants[i] = join(e)
+		newParticipants[i].newIndex = i
+	}
+
+	session := hex.EncodeToString(random.Bits(128, true, random.New()))
+	msg := reshareInTransport{Session: session, Threshold: newThreshold, OldThreshold: parameters.Threshold}
+	msg.OldNodes = make([][]byte, len(oldCommittee))
+	msg.NewNodes = make([][]byte, len(newCommittee))
+	for _, p := range participants {
+		out, err := p.endpoint.reshareStep(ctx, reshareKeyEndpoint, reshareInTransport{Session: session})
+		if err != nil {
+			return parameters, nil, err
+		}
+		if p.oldIndex >= 0 {
+			msg.OldNodes[p.oldIndex] = out.Key
+		}
+		if p.newIndex >= 0 {
+			msg.NewNodes[p.newIndex] = out.Key
+		}
+	}
+	_, commits := parameters.PublicPolynomials[0].Info()
+	var err error
+	if msg.Commits, err = marshalPoints(commits); err != nil {
+		return parameters, nil, err
+	}
+
+	// 1) old servers deal sub-shares of their share to the new committee
+	deals := make([]map[int]*dkg.Deal, len(newCommittee))
+	for i := range deals {
+		deals[i] = make(map[int]*dkg.Deal)
+	}
+	for _, p := range participants {
+		out, err := p.endpoint.reshareStep(ctx, reshareDealsEndpoint, msg)
+		if err != nil {
+			return parameters, nil, err
+		}
+		for i, deal := range out.Deals {
+			if i < 0 || i >= len(newCommittee) {
+				return parameters, nil, fmt.Errorf("reshare: server %d dealt to unknown server %d", p.endpoint.ID, i)
+			}
+			deals[i][p.oldIndex] = deal
+		}
+	}
+
+	// 2) new servers answer the deals, responses are broadcast to both committees, and any complaint
+	// must be answered by a justification
+	var responses []*dkg.Response
+	for i, p := range newParticipants {
+		out, err := p.endpoint.reshareStep(ctx, reshareResponsesEndpoint, reshareInTransport{Session: session, Deals: deals[i]})
+		if err != nil {
+			return parameters, nil, err
+		}
+		responses = append(responses, out.Responses...)
+	}
+	var justifications []justificationInTransport
+	for _, p := range participants {
+		out, err := p.endpoint.reshareStep(ctx, reshareJustificationsEndpoint, reshareInTransport{Session: session, Responses: responses})
+		if err != nil {
+			return parameters, nil, err
+		}
+		justifications = append(justifications, out.Justifications...)
+	}
+
+	// 3) new servers compute and stage their fresh shares, which must all be on the same polynomial
+	group := newDKGSuite(parameters.Suite)
+	newParameters := parameters
+	newParameters.Threshold = newThreshold
+	newParameters.TotalServers = len(newCommittee)
+
+	var pubPoly1 *share.PubPoly
+	pubShares := make([]*share.PubShare, len(newCommittee))
+	for i, p := range newParticipants {
+		out, err := p.endpoint.reshareStep(ctx, reshareFinishEndpoint, reshareInTransport{Session: session, Justifications: justifications})
+		if err != nil {
+			return parameters, nil, err
+		}
+		if out.Index != i {
+			return parameters, nil, fmt.Errorf("reshare: server %d computed share %d instead of %d", p.endpoint.ID, out.Index, i)
+		}
+		c, err := unmarshalPoints(group, out.Commits)
+		if err != nil {
+			return parameters, nil, err
+		}
+		poly := share.NewPubPoly(group, group.Point().Base(), c)
+		if pubPoly1 == nil {
+			pubPoly1 = poly
+		} else if poly.Threshold() != pubPoly1.Threshold() || !poly.Equal(pubPoly1) {
+			return parameters, nil, errors.New("reshare: servers disagree on the public polynomial")
+		}
+		V := parameters.Suite.G1().Point()
+		if err := V.UnmarshalBinary(out.PublicShare); err != nil {
+			return parameters, nil, err
+		}
+		pubShares[i] = &share.PubShare{I: out.Index, V: V}
+	}
+
+	if pubPoly1.Threshold() != newThreshold || !pubPoly1.Commit().Equal(parameters.PublicPolynomials[0].Commit()) {
+		return parameters, nil, errors.New("reshare: the public key has changed")
+	}
+	pubPoly2, err := recoverPubPolyG1(newParameters, pubPoly1, pubShares)
+	if err != nil {
+		return parameters, nil, err
+	}
+	if !pubPoly2.Commit().Equal(parameters.PublicPolynomials[1].Commit()) {
+		return parameters, nil, errors.New("reshare: the public key has changed")
+	}
+	newParameters.PublicPolynomials = [2]*share.PubPoly{pubPoly1, pubPoly2}
+
+	// 4) every server succeeded: new servers install their shares, then leaving servers forget theirs
+	encoded, err := marshalParametersJSON(newParameters, newEndpoints)
+	if err != nil {
+		return parameters, nil, err
+	}
+	commit := reshareInTransport{Session: session, Parameters: encoded}
+	for _, p := range newParticipants {
+		if _, err := p.endpoint.reshareStep(ctx, reshareCommitEndpoint, commit); err != nil {
+			return parameters, nil, err
+		}
+	}
+	for _, p := range participants {
+		if p.newIndex < 0 {
+			if _, err := p.endpoint.reshareStep(ctx, reshareCommitEndpoint, commit); err != nil {
+				return parameters, nil, err
+			}
+		}
+	}
+
+	return newParameters, newEndpoints, nil
+}
+
+// reshareStep sends one step of a reshare to the server and returns its answer
+func (e *serverEndpoint) reshareStep(ctx context.Context, path string, msg reshareInTransport) (reshareInTransport, error) {
+	var received reshareInTransport
+	if err := e.post(ctx, path, msg, &received); err != nil {
+		return reshareInTransport{}, err
+	}
+	if received.Session != msg.Session {
+		return reshareInTransport{}, fmt.Errorf("server %d: answered for another session", e.ID)
+	}
+
+	return received, nil
+}
+
+// share returns a copy of the server's current share of the master secret
+func (s *server) share() (*share.PriShare, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.keys[0] == nil {
+		return nil, errors.New("server holds no share of the master secret")
+	}
+	return &share.PriShare{I: s.keys[0].I, V: s.keys[0].V.Clone()}, nil
+}
+
+// retire makes the server forget its share once it has left the committee
+func (s *server) retire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = crypto.MasterSecretShares{}
+}
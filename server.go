@@ -1,49 +1,316 @@
 package main
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
 	"github.com/nmohnblatt/contact_discovery2/crypto"
 	"github.com/nmohnblatt/contact_discovery2/crypto/blindtbls"
+	"github.com/nmohnblatt/contact_discovery2/crypto/nizk"
+	"github.com/nmohnblatt/contact_discovery2/identity"
+	"github.com/nmohnblatt/contact_discovery2/quota"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/share"
 )
 
 type server struct {
-	ID    int
-	keys  crypto.MasterSecretShares
-	Comms chan keysInTransport
+	ID          int
+	mu          sync.RWMutex
+	keys        crypto.MasterSecretShares
+	participant *dkgParticipant
+	// verifier checks that users control the identifier they request keys for. A server without one
+	// refuses to sign
+	verifier identity.Verifier
+	// limiter enforces the issuance quotas, no limits apply when nil
+	limiter *quota.Limiter
+	// resharing serves the reshare endpoints, the server takes part in no reshare when nil
+	resharing *reshareState
+}
+
+// errNotAttested is returned when a request does not prove ownership of the identifier
+var errNotAttested = errors.New("identifier ownership not proven")
+
+// errWrongEpoch is returned when a request is for an epoch the server does not sign in
+var errWrongEpoch = errors.New("wrong epoch")
+
+// checkEpoch accepts requests for the current epoch and the next one, so that users can obtain their keys
+// before an epoch starts. The epoch is the one the attestation commits to, and the current epoch is read
+// from the server's clock
+func checkEpoch(parameters publicParameters, epoch uint64) error {
+	current := parameters.currentEpoch()
+	if epoch != current && epoch != current+1 {
+		return fmt.Errorf("%w: %d, the current epoch is %d", errWrongEpoch, epoch, current)
+	}
+	return nil
+}
+
+// checkAttestation verifies the user's token, that it is for an epoch the server signs in, and that both
+// blinded points are the same multiple of the points committed to in the token. The user cannot mix
+// identifiers across G1 and G2, nor request keys for an identifier or an epoch that was not attested, and
+// the server never learns the identifier
+func (s *server) checkAttestation(parameters publicParameters, userPublic keysInTransport) error {
+	suite := parameters.Suite
+	if s.verifier == nil {
+		return fmt.Errorf("%w: the server has no attestation verifier", errNotAttested)
+	}
+	if err := s.verifier.Verify(userPublic.Attestation); err != nil {
+		return fmt.Errorf("%w: %v", errNotAttested, err)
+	}
+	if err := checkEpoch(parameters, userPublic.Attestation.Epoch); err != nil {
+		return err
+	}
+
+	C1, C2, err := userPublic.Attestation.CommittedPoints(suite)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errNotAttested, err)
+	}
+	left := suite.G1().Point()
+	if err := left.UnmarshalBinary(userPublic.Left); err != nil {
+		return err
+	}
+	right := suite.G2().Point()
+	if err := right.UnmarshalBinary(userPublic.Right); err != nil {
+		return err
+	}
+	B1, B2 := suite.G1().Point().Base(), suite.G2().Point().Base()
+	context := attestationContext(userPublic.Attestation)
+	if err := nizk.VerifyBlindedOpening(suite.G1(), suite.G2(), B1, B2, C1, C2, left, right, userPublic.Proof, context); err != nil {
+		return fmt.Errorf("%w: %v", errNotAttested, err)
+	}
+
+	return nil
+}
+
+// checkQuota charges the request to the account named in its attestation, the identifier being named by
+// its tag. The reservation is cancelled if no signature shares are returned in the end
+func (s *server) checkQuota(userPublic keysInTransport) (*quota.Reservation, error) {
+	if s.limiter == nil {
+		return nil, nil
+	}
+
+	token := userPublic.Attestation
+	return s.limiter.Reserve(token.AccountID(), hex.EncodeToString(token.Tag))
 }
 
-func (s server) sign(suite pairing.Suite, userPublic keysInTransport) ([]byte, []byte, error) {
+// sign computes the server's signature shares on the user's blinded points, together with the proofs
+// that they were computed with the server's share of the master secret
+func (s *server) sign(parameters publicParameters, userPublic keysInTransport) (keysInTransport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	suite := parameters.Suite
+	if s.keys[0] == nil || s.keys[1] == nil {
+		return keysInTransport{}, errors.New("server holds no share of the master secret")
+	}
+	if err := s.checkAttestation(parameters, userPublic); err != nil {
+		return keysInTransport{}, err
+	}
+	reservation, err := s.checkQuota(userPublic)
+	if err != nil {
+		return keysInTransport{}, err
+	}
+	signed, err := s.signShares(suite, userPublic)
+	if err != nil {
+		reservation.Cancel()
+		return keysInTransport{}, err
+	}
 
-	buf1, err := blindtbls.Sign(suite, suite.G1(), s.keys[0], userPublic.Left)
+	return signed, nil
+}
+
+// signShares computes the signature shares on the user's blinded points and the proofs that go with them
+func (s *server) signShares(suite pairing.Suite, userPublic keysInTransport) (keysInTransport, error) {
+	var signed keysInTransport
+	var err error
+
+	signed.Left, err = blindtbls.Sign(suite, suite.G1(), s.keys[0], userPublic.Left)
+	if err != nil {
+		return keysInTransport{}, err
+	}
+	signed.LeftProof, err = blindtbls.ProveShare(suite.G1(), suite.G2(), s.keys[0], userPublic.Left, signed.Left)
+	if err != nil {
+		return keysInTransport{}, err
+	}
+
+	signed.Right, err = blindtbls.Sign(suite, suite.G2(), s.keys[1], userPublic.Right)
+	if err != nil {
+		return keysInTransport{}, err
+	}
+	signed.RightProof, err = blindtbls.ProveShare(suite.G2(), suite.G1(), s.keys[1], userPublic.Right, signed.Right)
 	if err != nil {
-		return nil, nil, err
+		return keysInTransport{}, err
+	}
+
+	return signed, nil
+}
+
+// maxBatchSize bounds the number of identifiers in a batch signing request
+const maxBatchSize = 16
+
+// signBatch computes the server's signature shares on the blinded points of several identifiers. Every
+// request is checked as in sign before any quota is charged, and the quota is only charged if the whole
+// batch is signed. No proofs are returned: users check the whole batch at once with blindtbls.VerifyBatch
+func (s *server) signBatch(parameters publicParameters, batch batchInTransport) (batchInTransport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	suite := parameters.Suite
+	if s.keys[0] == nil || s.keys[1] == nil {
+		return batchInTransport{}, errors.New("server holds no share of the master secret")
+	}
+	if len(batch.Requests) == 0 || len(batch.Requests) > maxBatchSize {
+		return batchInTransport{}, fmt.Errorf("batches hold between 1 and %d identifiers", maxBatchSize)
 	}
 
-	buf2, _ := blindtbls.Sign(suite, suite.G2(), s.keys[1], userPublic.Right)
+	left := make([][]byte, len(batch.Requests))
+	right := make([][]byte, len(batch.Requests))
+	for j, userPublic := range batch.Requests {
+		if err := s.checkAttestation(parameters, userPublic); err != nil {
+			return batchInTransport{}, fmt.Errorf("request %d: %w", j, err)
+		}
+		left[j], right[j] = userPublic.Left, userPublic.Right
+	}
+	reservations := make([]*quota.Reservation, 0, len(batch.Requests))
+	cancel := func() {
+		for _, r := range reservations {
+			r.Cancel()
+		}
+	}
+	for j, userPublic := range batch.Requests {
+		r, err := s.checkQuota(userPublic)
+		if err != nil {
+			cancel()
+			return batchInTransport{}, fmt.Errorf("request %d: %w", j, err)
+		}
+		reservations = append(reservations, r)
+	}
+
+	var signed batchInTransport
+	var err error
+
+	signed.Left, err = blindtbls.SignBatch(suite, suite.G1(), s.keys[0], left)
+	if err != nil {
+		cancel()
+		return batchInTransport{}, err
+	}
+	signed.Right, err = blindtbls.SignBatch(suite, suite.G2(), s.keys[1], right)
 	if err != nil {
-		return nil, nil, err
+		cancel()
+		return batchInTransport{}, err
+	}
+
+	return signed, nil
+}
+
+// writeSignError reports an error of the signing endpoints with the matching status code
+func writeSignError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNotAttested):
+		http.Error(w, "sign: "+err.Error(), http.StatusForbidden)
+	case errors.Is(err, quota.ErrExceeded):
+		http.Error(w, "sign: "+err.Error(), http.StatusTooManyRequests)
+	default:
+		http.Error(w, "sign: "+err.Error(), http.StatusBadRequest)
 	}
+}
+
+// handleSign is the "sign blinded point" endpoint. The request body holds the user's blinded points,
+// the response body holds the corresponding signature shares as output by blindtbls.Sign
+func (s *server) handleSign(parameters publicParameters) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "sign: method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var toSign keysInTransport
+		if err := json.NewDecoder(r.Body).Decode(&toSign); err != nil {
+			http.Error(w, "sign: malformed request", http.StatusBadRequest)
+			return
+		}
 
-	return buf1, buf2, nil
+		signed, err := s.sign(parameters, toSign)
+		if err != nil {
+			writeSignError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(signed)
+	}
 }
 
-func (s server) runServer(parameters publicParameters) {
-	for {
-		toSign := <-s.Comms
+// handleSignBatch is the batch signing endpoint. The request body holds the blinded points of several
+// identifiers, the response body the signature shares on all of them as output by blindtbls.SignBatch
+func (s *server) handleSignBatch(parameters publicParameters) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "sign: method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var toSign batchInTransport
+		if err := json.NewDecoder(r.Body).Decode(&toSign); err != nil {
+			http.Error(w, "sign: malformed request", http.StatusBadRequest)
+			return
+		}
+
+		signed, err := s.signBatch(parameters, toSign)
+		if err != nil {
+			writeSignError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(signed)
+	}
+}
 
-		left, right, _ := s.sign(parameters.Suite, toSign)
-		outputMessage := keysInTransport{left, right, nil}
+// handleMetrics reports the quota metrics as JSON
+func (s *server) handleMetrics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var metrics quota.Metrics
+		if s.limiter != nil {
+			metrics = s.limiter.Metrics()
+		}
 
-		s.Comms <- outputMessage
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metrics)
 	}
 }
 
+// serve exposes the server's endpoints on the given listener until the listener is closed
+func (s *server) serve(parameters publicParameters, l net.Listener) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(signEndpoint, s.handleSign(parameters))
+	mux.HandleFunc(signBatchEndpoint, s.handleSignBatch(parameters))
+	mux.HandleFunc(metricsEndpoint, s.handleMetrics())
+	if s.resharing != nil {
+		s.handleReshareSteps(parameters, mux)
+	}
+
+	return http.Serve(l, mux)
+}
+
+// listenAndServe runs the server as a standalone network service on the given address
+func (s *server) listenAndServe(parameters publicParameters, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.serve(parameters, l)
+}
+
 // NewServer creates an instance of a server
-func newServer(id int, key1, key2 *share.PriShare, comms chan keysInTransport) *server {
+func newServer(id int, key1, key2 *share.PriShare) *server {
 	return &server{
-		ID:    id,
-		keys:  [2]*share.PriShare{key1, key2},
-		Comms: comms,
+		ID:   id,
+		keys: [2]*share.PriShare{key1, key2},
 	}
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nmohnblatt/contact_discovery2/keystore"
+	"go.dedis.ch/kyber/v3/pairing"
+	"go.dedis.ch/kyber/v3/share"
+)
+
+// keystorePath returns the path of a server's keystore in dir
+func keystorePath(dir string, id int) string {
+	return filepath.Join(dir, fmt.Sprintf("server-%d.json", id))
+}
+
+// keystoresExist reports whether dir holds a keystore for every server
+func keystoresExist(parameters publicParameters, dir string) bool {
+	for i := 0; i < parameters.TotalServers; i++ {
+		if _, err := os.Stat(keystorePath(dir, i)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// saveServerKeys writes each server's shares to its own encrypted keystore in dir
+func saveServerKeys(parameters publicParameters, servers []*server, dir string, passphrase []byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	for _, s := range servers {
+		s.mu.RLock()
+		keys := s.keys
+		s.mu.RUnlock()
+
+		if err := keystore.Save(keystorePath(dir, s.ID), passphrase, parameters.Suite, s.ID, keys); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeOwnKeystore deletes the keystore at path if it still holds sh. A reshare may renumber servers that
+// keep their keystores in the same directory, so the file may already hold another server's new share
+func removeOwnKeystore(path string, passphrase []byte, suite pairing.Suite, sh *share.PriShare) error {
+	_, keys, err := keystore.Load(path, passphrase, suite)
+	if err != nil || keys[0] == nil || keys[0].I != sh.I || !keys[0].V.Equal(sh.V) {
+		return nil
+	}
+
+	return os.Remove(path)
+}
+
+// loadThresholdServers restores the servers from their keystores in dir. The public polynomials are
+// rebuilt from the commitments to the shares, so nothing else has to be stored
+func loadThresholdServers(parameters publicParameters, dir string, passphrase []byte) ([]*server, *share.PubPoly, *share.PubPoly, error) {
+	serverList := make([]*server, parameters.TotalServers)
+	pubShares := make([]*share.PubShare, parameters.TotalServers)
+	pubSharesG1 := make([]*share.PubShare, parameters.TotalServers)
+
+	for i := range serverList {
+		id, keys, err := keystore.Load(keystorePath(dir, i), passphrase, parameters.Suite)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if id != i {
+			return nil, nil, nil, fmt.Errorf("keystore: %s holds the keys of server %d", keystorePath(dir, i), id)
+		}
+		serverList[i] = newServer(id, keys[0], keys[1])
+		pubShares[i] = &share.PubShare{I: keys[0].I, V: parameters.Suite.G2().Point().Mul(keys[0].V, nil)}
+		pubSharesG1[i] = &share.PubShare{I: keys[1].I, V: parameters.Suite.G1().Point().Mul(keys[1].V, nil)}
+	}
+
+	recovered, err := share.RecoverPubPoly(parameters.Suite.G2(), pubShares, parameters.Threshold, parameters.TotalServers)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	_, commits := recovered.Info()
+	pubPoly1 := share.NewPubPoly(parameters.Suite.G2(), parameters.Suite.G2().Point().Base(), commits)
+	for _, s := range pubShares {
+		if !pubPoly1.Eval(s.I).V.Equal(s.V) {
+			return nil, nil, nil, errors.New("keystore: stored shares are not on a polynomial of the expected degree")
+		}
+	}
+
+	pubPoly2, err := recoverPubPolyG1(parameters, pubPoly1, pubSharesG1)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return serverList, pubPoly1, pubPoly2, nil
+}
+
+// exportCommitments returns the public commitments to the shares held in each keystore in dir
+func exportCommitments(parameters publicParameters, dir string) ([]keystore.Commitments, error) {
+	commitments := make([]keystore.Commitments, parameters.TotalServers)
+	for i := range commitments {
+		c, err := keystore.ReadCommitments(keystorePath(dir, i), parameters.Suite)
+		if err != nil {
+			return nil, err
+		}
+		commitments[i] = c
+	}
+
+	return commitments, nil
+}
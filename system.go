@@ -1,13 +1,12 @@
 package main
 
 import (
-	"math/rand"
 	"time"
 
-	"go.dedis.ch/kyber/v3"
+	"github.com/nmohnblatt/contact_discovery2/identity"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/share"
-	"go.dedis.ch/kyber/v3/util/random"
+	"go.dedis.ch/kyber/v3/sign/tbls"
 )
 
 // PublicParameters contains all the required public parameters
@@ -16,42 +15,77 @@ type publicParameters struct {
 	TotalServers      int
 	Suite             pairing.Suite
 	PublicPolynomials [2]*share.PubPoly
+	// EpochLength is the period after which constraining keys and meeting points change. Zero means a
+	// single epoch that never ends
+	EpochLength time.Duration
 }
 
-type keysInTransport struct {
-	Left  []byte
-	Right []byte
-	Error error
+// epochAt returns the epoch t belongs to. Epochs are consecutive periods of EpochLength counted from the
+// Unix epoch
+func (p publicParameters) epochAt(t time.Time) uint64 {
+	if p.EpochLength <= 0 {
+		return 0
+	}
+	return uint64(t.UnixNano() / int64(p.EpochLength))
 }
 
-func setupThresholdServers(parameters publicParameters, secret kyber.Scalar) ([]*server, *share.PubPoly, *share.PubPoly) {
-	serverList := make([]*server, parameters.TotalServers)
-	if secret == nil {
-		secret = parameters.Suite.GT().Scalar().Pick(random.New())
-	}
+// currentEpoch returns the epoch at the current time
+func (p publicParameters) currentEpoch() uint64 {
+	return p.epochAt(time.Now())
+}
 
-	priPoly1 := share.NewPriPoly(parameters.Suite.G2(), parameters.Threshold, secret, random.New())
-	pubPoly1 := priPoly1.Commit(parameters.Suite.G2().Point().Base())
-	serverPrivateKeys1 := priPoly1.Shares(parameters.TotalServers)
+// epochEnd returns the time epoch ends, or the zero time if epochs never end
+func (p publicParameters) epochEnd(epoch uint64) time.Time {
+	if p.EpochLength <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(epoch+1)*int64(p.EpochLength))
+}
 
-	priPoly2 := share.NewPriPoly(parameters.Suite.G1(), parameters.Threshold, secret, random.New())
-	pubPoly2 := priPoly2.Commit(parameters.Suite.G1().Point().Base())
-	serverPrivateKeys2 := priPoly2.Shares(parameters.TotalServers)
+// keysInTransport is the message exchanged between users and servers. It carries either a pair
+// of blinded points (request) or the corresponding pair of signature shares (response)
+type keysInTransport struct {
+	Left  []byte `json:"left"`
+	Right []byte `json:"right"`
+	// Attestation proves the user controls the identifier it commits to, hashed for the epoch it names.
+	// Proof shows that both blinded points are the same multiple of the committed points, without
+	// revealing them (see nizk.ProveBlindedOpening). They are only set on requests
+	Attestation *identity.Token `json:"attestation,omitempty"`
+	Proof       []byte          `json:"proof,omitempty"`
+	// LeftProof and RightProof show that each signature share was computed with the server's share of
+	// the master secret (see blindtbls.ProveShare). They are only set on responses
+	LeftProof  []byte `json:"left_proof,omitempty"`
+	RightProof []byte `json:"right_proof,omitempty"`
+}
 
-	for i := 0; i < parameters.TotalServers; i++ {
-		comms := make(chan keysInTransport)
-		serverList[i] = newServer(i, serverPrivateKeys1[i], serverPrivateKeys2[i], comms)
-	}
+// batchInTransport is the message of the batch signing endpoint. A request carries one keysInTransport
+// request per identifier in Requests, the response the server's signature shares on the left and on the
+// right points of the requests, in the same order
+type batchInTransport struct {
+	Requests []keysInTransport `json:"requests,omitempty"`
+	Left     []tbls.SigShare   `json:"left,omitempty"`
+	Right    []tbls.SigShare   `json:"right,omitempty"`
+}
 
-	return serverList, pubPoly1, pubPoly2
+// attestationContext binds the blinding proof to the token it is presented with
+func attestationContext(token *identity.Token) []byte {
+	context := append([]byte("blinded identifier attestation"), token.Commitment...)
+	return append(context, token.Signature...)
 }
 
-func chooseTofNservers(parameters publicParameters, servers []*server) []*server {
-	rand.Seed(time.Now().Unix())
-	shuffled := make([]*server, len(servers))
+// setupThresholdServers creates the servers and lets them run a DKG to obtain their shares of the master
+// secret. All the servers live in this process, which is therefore a trusted dealer (see runDKG)
+func setupThresholdServers(parameters publicParameters) ([]*server, *share.PubPoly, *share.PubPoly, error) {
+	serverList := make([]*server, parameters.TotalServers)
+	for i := 0; i < parameters.TotalServers; i++ {
+		serverList[i] = newServer(i, nil, nil)
+		serverList[i].participant = newDKGParticipant(parameters.Suite)
+	}
 
-	copy(shuffled, servers)
-	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	pubPoly1, pubPoly2, err := runDKG(parameters, serverList)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	return shuffled[:parameters.Threshold]
+	return serverList, pubPoly1, pubPoly2, nil
 }
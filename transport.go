@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	signEndpoint      = "/sign"
+	signBatchEndpoint = "/sign-batch"
+	metricsEndpoint   = "/metrics"
+)
+
+// serverEndpoint is the client side of a remote server's signing service
+type serverEndpoint struct {
+	ID      int
+	Address string
+	client  *http.Client
+	// token is sent as a bearer token when set, to authenticate to the reshare endpoints
+	token string
+}
+
+func newServerEndpoint(id int, address string) *serverEndpoint {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "http://" + address
+	}
+
+	return &serverEndpoint{
+		ID:      id,
+		Address: strings.TrimSuffix(address, "/"),
+		client:  &http.Client{},
+	}
+}
+
+// requestSignature sends a pair of blinded points to the server and returns its signature shares
+func (e *serverEndpoint) requestSignature(ctx context.Context, blinded keysInTransport) (keysInTransport, error) {
+	var received keysInTransport
+	if err := e.post(ctx, signEndpoint, blinded, &received); err != nil {
+		return keysInTransport{}, err
+	}
+	if received.Left == nil || received.Right == nil {
+		return keysInTransport{}, errors.New("transport: incomplete response from server")
+	}
+
+	return received, nil
+}
+
+// requestSignatures sends the blinded points of several identifiers to the server at once and returns its
+// signature shares, one left and one right share per request
+func (e *serverEndpoint) requestSignatures(ctx context.Context, blinded batchInTransport) (batchInTransport, error) {
+	var received batchInTransport
+	if err := e.post(ctx, signBatchEndpoint, blinded, &received); err != nil {
+		return batchInTransport{}, err
+	}
+	if len(received.Left) != len(blinded.Requests) || len(received.Right) != len(blinded.Requests) {
+		return batchInTransport{}, errors.New("transport: incomplete response from server")
+	}
+
+	return received, nil
+}
+
+// post sends in as JSON to the given path of the server and decodes the response into out
+func (e *serverEndpoint) post(ctx context.Context, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.Address+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Bearer "+e.token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("server %d: %s", e.ID, strings.TrimSpace(string(msg)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
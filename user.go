@@ -1,144 +1,714 @@
 package main
 
 import (
-	"encoding/hex"
+	"context"
 	"errors"
+	"fmt"
+	"sort"
+	"time"
 
 	"github.com/nmohnblatt/contact_discovery2/crypto"
 	"github.com/nmohnblatt/contact_discovery2/crypto/blindbls"
 	"github.com/nmohnblatt/contact_discovery2/crypto/blindtbls"
+	"github.com/nmohnblatt/contact_discovery2/crypto/nizk"
+	"github.com/nmohnblatt/contact_discovery2/identity"
+	"github.com/nmohnblatt/contact_discovery2/meetingstore"
+	"github.com/nmohnblatt/contact_discovery2/normalise"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/share"
 	"go.dedis.ch/kyber/v3/sign/tbls"
 	"go.dedis.ch/kyber/v3/util/random"
 )
 
+// shareCollectionTimeout bounds the collection of signature shares when the caller's context has no deadline
+const shareCollectionTimeout = 10 * time.Second
+
+// lateShareGrace is how long the servers that have not answered yet are waited for once a threshold of
+// valid shares is in, so that their invalid shares are reported too
+const lateShareGrace = 250 * time.Millisecond
+
+// errServerTimeout is recorded for servers that did not answer before the deadline
+var errServerTimeout = errors.New("no answer before the deadline")
+
 type user struct {
+	// DiscoveryIdentifier is the user's primary identifier, the one the card names by default
 	DiscoveryIdentifier string
-	contacts            []string
-	publicKeys          crypto.PublicKeys
-	constrainingKeys    crypto.ConstrainingKeys
-	sharedKeys          map[string]crypto.SharedKeys
-	contactPresence     map[string]bool
+	// identifiers are all the identifiers the user is discoverable under, the primary one first
+	identifiers []*ownIdentifier
+	contacts    []string
+	// region is the default region of the phone numbers in the contact list, e.g. GB
+	region string
+	// canonical holds the normalised form of each contact, the one hashed and bound into the derived keys
+	canonical map[string]string
+	// epoch is the epoch the public, constraining and shared keys belong to
+	epoch uint64
+	// sharedKeys holds the keys shared between each of the user's identifiers and each contact
+	sharedKeys      map[meeting]crypto.SharedKeys
+	contactPresence map[string]bool
+	// matchedBy records, for each contact found, which of the user's identifiers the contact was found with
+	matchedBy map[string]string
+	// contactKeys caches the public keys of the contacts
+	contactKeys *crypto.PublicKeyCache
+	// card is the payload left for contacts at secure meeting points, contactCards holds the ones received
+	card         []byte
+	contactCards map[string][]byte
+	// lastChecked and discoveredAt record when each contact's meeting points were last visited and when the
+	// contact was found there
+	lastChecked  map[string]time.Time
+	discoveredAt map[string]time.Time
+	// faultyServers records, by server ID, the servers that timed out, failed or returned invalid
+	// signature shares during the last call to requestContrainingKeys
+	faultyServers map[int]error
+}
+
+// ownIdentifier is one of the identifiers a user is discoverable under, with the keys obtained for it
+type ownIdentifier struct {
+	identifier       string
+	publicKeys       crypto.PublicKeys
+	constrainingKeys crypto.ConstrainingKeys
+	// attestation proves to the servers that the user controls identifier during the user's epoch
+	attestation *identity.Credential
+}
+
+func newOwnIdentifier(parameters publicParameters, epoch uint64, identifier string) *ownIdentifier {
+	return &ownIdentifier{
+		identifier:       identifier,
+		publicKeys:       crypto.DerivePublicKeys(parameters.Suite, epoch, identifier),
+		constrainingKeys: crypto.ConstrainingKeys{Left: parameters.Suite.G1().Point(), Right: parameters.Suite.G2().Point()},
+	}
+}
+
+// meeting names the meeting point between one of the user's identifiers and a contact
+type meeting struct {
+	own, contact string
 }
 
+// newUser creates a user discoverable under identifier, which must already be normalised (see
+// normalise.Identifier). Contacts may be written in any form
 func newUser(parameters publicParameters, identifier string, contacts []string) *user {
 	addressBook := make(map[string]bool)
 	for _, contact := range contacts {
 		addressBook[contact] = false
 	}
 
+	epoch := parameters.currentEpoch()
 	return &user{
 		DiscoveryIdentifier: identifier,
+		identifiers:         []*ownIdentifier{newOwnIdentifier(parameters, epoch, identifier)},
 		contacts:            contacts,
-		publicKeys:          crypto.DerivePublicKeys(parameters.Suite, identifier),
-		constrainingKeys:    crypto.ConstrainingKeys{Left: parameters.Suite.G1().Point(), Right: parameters.Suite.G2().Point()},
-		sharedKeys:          make(map[string]crypto.SharedKeys),
+		epoch:               epoch,
+		sharedKeys:          make(map[meeting]crypto.SharedKeys),
 		contactPresence:     addressBook,
+		canonical:           make(map[string]string),
+		matchedBy:           make(map[string]string),
+		contactKeys:         crypto.NewPublicKeyCache(parameters.Suite, epoch),
+		card:                []byte(identifier),
+		contactCards:        make(map[string][]byte),
+		lastChecked:         make(map[string]time.Time),
+		discoveredAt:        make(map[string]time.Time),
 	}
 }
 
-func (u *user) requestContrainingKeys(parameters publicParameters, serverlist []*server) error {
-	t := parameters.Threshold
-	n := parameters.TotalServers
+// addIdentifier makes the user discoverable under another identifier, e.g. an email address besides a phone
+// number. The identifier is normalised first. Its constraining keys are obtained by the next call to
+// requestContrainingKeys, and meeting points are then shared between each of the user's identifiers and each
+// contact
+func (u *user) addIdentifier(parameters publicParameters, identifier string) error {
+	identifier, err := normalise.Identifier(identifier, u.region)
+	if err != nil {
+		return err
+	}
+	if u.identifier(identifier) != nil {
+		return fmt.Errorf("%s is already one of the user's identifiers", identifier)
+	}
+	if len(u.identifiers) >= maxBatchSize {
+		return fmt.Errorf("a user has at most %d identifiers", maxBatchSize)
+	}
+	u.identifiers = append(u.identifiers, newOwnIdentifier(parameters, u.epoch, identifier))
+
+	return nil
+}
+
+// identifier returns the user's identifier with the given name, or nil
+func (u *user) identifier(name string) *ownIdentifier {
+	for _, id := range u.identifiers {
+		if id.identifier == name {
+			return id
+		}
+	}
+	return nil
+}
 
+// startEpoch moves the user to another epoch. The keys of the previous epoch are dropped and every contact
+// has to be found again at the meeting points of the new epoch; the contact list, the cards and the
+// first discovery times are kept
+func (u *user) startEpoch(parameters publicParameters, epoch uint64) {
+	u.epoch = epoch
+	for i, id := range u.identifiers {
+		u.identifiers[i] = newOwnIdentifier(parameters, epoch, id.identifier)
+	}
+	u.sharedKeys = make(map[meeting]crypto.SharedKeys)
+	u.contactKeys = crypto.NewPublicKeyCache(parameters.Suite, epoch)
+	u.lastChecked = make(map[string]time.Time)
+	for _, contact := range u.contacts {
+		u.contactPresence[contact] = false
+	}
+}
+
+// attest obtains credentials proving the user controls each of their identifiers. They are only valid for
+// the user's current epoch
+func (u *user) attest(ctx context.Context, issuer identity.Issuer) error {
+	for _, id := range u.identifiers {
+		credential, err := issuer.Issue(ctx, u.epoch, id.identifier)
+		if err != nil {
+			return err
+		}
+		id.attestation = credential
+	}
+
+	return nil
+}
+
+// requestContrainingKeys obtains the constraining keys of each of the user's identifiers. A single identifier
+// is sent to the "sign blinded point" endpoint, several are sent together with requestConstrainingKeysBatch
+func (u *user) requestContrainingKeys(ctx context.Context, parameters publicParameters, serverlist []*serverEndpoint) error {
+	if len(u.identifiers) > 1 {
+		return u.requestConstrainingKeysBatch(ctx, parameters, serverlist)
+	}
 	if len(serverlist) < parameters.Threshold {
 		return errors.New("Not enough servers to meet the threshold")
 	}
-
-	// Choose a blinding factor (one per group)
-	BF := [2]kyber.Scalar{parameters.Suite.G1().Scalar().Pick(random.New()), parameters.Suite.G2().Scalar().Pick(random.New())}
+	if _, set := ctx.Deadline(); !set {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, shareCollectionTimeout)
+		defer cancel()
+	}
+	id := u.identifiers[0]
 
 	// Blind
-	aH1M, err := blindtbls.Blind(parameters.Suite.G1(), BF[0], u.publicKeys.Left)
+	b, err := newBlindedRequest(parameters, id.publicKeys, id.attestation)
 	if err != nil {
 		return err
 	}
-	aH2M, err := blindtbls.Blind(parameters.Suite.G2(), BF[1], u.publicKeys.Right)
+
+	// Sign
+	query := func(ctx context.Context, s *serverEndpoint) ([]*share.PubShare, []*share.PubShare, error) {
+		received, err := s.requestSignature(ctx, b.request)
+		if err != nil {
+			return nil, nil, err
+		}
+		left, right, err := verifySignatureShares(parameters, b.blinded, received)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []*share.PubShare{left}, []*share.PubShare{right}, nil
+	}
+	shares1, shares2, faulty, err := collectSignatureShares(ctx, parameters, serverlist, query)
+	u.faultyServers = faulty
+	if err != nil {
+		return err
+	}
+
+	// Recover and unblind
+	id.constrainingKeys, err = b.unblind(parameters, shares1[0], shares2[0])
+	return err
+}
+
+// requestConstrainingKeysBatch obtains the constraining keys of all the user's identifiers with a single batch
+// request to each server, e.g. for a person enrolling their phone number, email and handle at once. The shares
+// are checked with one pairing equation per server and group rather than one proof per identifier
+func (u *user) requestConstrainingKeysBatch(ctx context.Context, parameters publicParameters, serverlist []*serverEndpoint) error {
+	if len(serverlist) < parameters.Threshold {
+		return errors.New("Not enough servers to meet the threshold")
+	}
+	if _, set := ctx.Deadline(); !set {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, shareCollectionTimeout)
+		defer cancel()
+	}
+
+	// Blind every identifier with its own blinding factor
+	blinded := make([]blindedRequest, len(u.identifiers))
+	var batch batchInTransport
+	for j, id := range u.identifiers {
+		b, err := newBlindedRequest(parameters, id.publicKeys, id.attestation)
+		if err != nil {
+			return err
+		}
+		blinded[j] = b
+		batch.Requests = append(batch.Requests, b.request)
+	}
+
+	// Sign
+	query := func(ctx context.Context, s *serverEndpoint) ([]*share.PubShare, []*share.PubShare, error) {
+		received, err := s.requestSignatures(ctx, batch)
+		if err != nil {
+			return nil, nil, err
+		}
+		return verifySignatureBatch(parameters, blinded, received)
+	}
+	shares1, shares2, faulty, err := collectSignatureShares(ctx, parameters, serverlist, query)
+	u.faultyServers = faulty
 	if err != nil {
 		return err
 	}
 
+	// Recover and unblind
+	for j, id := range u.identifiers {
+		if id.constrainingKeys, err = blinded[j].unblind(parameters, shares1[j], shares2[j]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blindedRequest is a request for the constraining keys of one identifier, together with what the user
+// needs to check and unblind the signature shares
+type blindedRequest struct {
+	blindingFactor kyber.Scalar
+	blinded        crypto.PublicKeys
+	request        keysInTransport
+}
+
+// newBlindedRequest blinds the public keys of an identifier. The request proves that both blinded points are
+// the same multiple of the points committed to in the attestation, which must be for the identifier and the
+// epoch of the public keys
+func newBlindedRequest(parameters publicParameters, publicKeys crypto.PublicKeys, attestation *identity.Credential) (blindedRequest, error) {
+	if attestation == nil {
+		return blindedRequest{}, errors.New("identifier not attested")
+	}
+	C1, C2, err := attestation.Token.CommittedPoints(parameters.Suite)
+	if err != nil {
+		return blindedRequest{}, err
+	}
+
+	// Choose a blinding factor. The same one is used in both groups so that the servers can be
+	// convinced that the two blinded points hide the same identifier
+	BF := parameters.Suite.G1().Scalar().Pick(random.New())
+
+	aH1M, err := blindtbls.Blind(parameters.Suite.G1(), BF, publicKeys.Left)
+	if err != nil {
+		return blindedRequest{}, err
+	}
+	aH2M, err := blindtbls.Blind(parameters.Suite.G2(), BF, publicKeys.Right)
+	if err != nil {
+		return blindedRequest{}, err
+	}
+
 	// Keep an unmarshalled representation for later
 	blindedPublic := crypto.PublicKeys{Left: parameters.Suite.G1().Point(), Right: parameters.Suite.G2().Point()}
 
 	if err := blindedPublic.Left.UnmarshalBinary(aH1M); err != nil {
-		return err
+		return blindedRequest{}, err
 	}
 	if err := blindedPublic.Right.UnmarshalBinary(aH2M); err != nil {
-		return err
+		return blindedRequest{}, err
 	}
 
-	// Sign
-	buf1 := make([][]byte, len(serverlist))
-	buf2 := make([][]byte, len(serverlist))
+	// Prove that both blinded points blind the openings of the attested commitments
+	request := keysInTransport{Left: aH1M, Right: aH2M, Attestation: attestation.Token}
+	B1, B2 := parameters.Suite.G1().Point().Base(), parameters.Suite.G2().Point().Base()
+	request.Proof, err = nizk.ProveBlindedOpening(parameters.Suite.G1(), parameters.Suite.G2(), B1, B2, C1, C2,
+		BF, attestation.Opening.Left, attestation.Opening.Right, blindedPublic.Left, blindedPublic.Right, attestationContext(attestation.Token))
+	if err != nil {
+		return blindedRequest{}, err
+	}
 
-	for i, s := range serverlist {
-		s.Comms <- keysInTransport{aH1M, aH2M, nil}
-		received := <-s.Comms
-		if received.Error != nil {
-			return received.Error
-		}
+	return blindedRequest{blindingFactor: BF, blinded: blindedPublic, request: request}, nil
+}
 
-		buf1[i] = received.Left
-		buf2[i] = received.Right
+// unblind recovers the constraining keys from a threshold of verified signature shares on the blinded points
+func (b blindedRequest) unblind(parameters publicParameters, shares1, shares2 []*share.PubShare) (crypto.ConstrainingKeys, error) {
+	t := parameters.Threshold
+	n := parameters.TotalServers
 
+	// Recover
+	blindKey1, err := blindtbls.Combine(parameters.Suite.G1(), shares1, t, n)
+	if err != nil {
+		return crypto.ConstrainingKeys{}, err
+	}
+	blindKey2, err := blindtbls.Combine(parameters.Suite.G2(), shares2, t, n)
+	if err != nil {
+		return crypto.ConstrainingKeys{}, err
 	}
 
-	// Recover
-	buf1Formatted := make([]*share.PubShare, len(buf1))
-	buf2Formatted := make([]*share.PubShare, len(buf2))
-	for i := 0; i < len(buf1); i++ {
-		buf1Formatted[i], err = blindtbls.SigSharetoPubShare(parameters.Suite.G1(), tbls.SigShare(buf1[i]))
-		if err != nil {
-			return err
+	// Unblind
+	var keys crypto.ConstrainingKeys
+	keys.Left, err = blindbls.Unblind(parameters.Suite.G1(), b.blindingFactor, blindKey1)
+	if err != nil {
+		return crypto.ConstrainingKeys{}, err
+	}
+	keys.Right, err = blindbls.Unblind(parameters.Suite.G2(), b.blindingFactor, blindKey2)
+	if err != nil {
+		return crypto.ConstrainingKeys{}, err
+	}
+
+	return keys, nil
+}
+
+// signatureQuery asks one server for its signature shares and verifies them. It returns a left and a right
+// share per identifier, all with the server's share index
+type signatureQuery func(ctx context.Context, s *serverEndpoint) ([]*share.PubShare, []*share.PubShare, error)
+
+// signatureResult is the outcome of one server's signing request
+type signatureResult struct {
+	server      *serverEndpoint
+	left, right []*share.PubShare
+	err         error
+}
+
+// collectSignatureShares queries all servers concurrently and verifies their shares as they arrive. Once a
+// threshold of valid shares is in, the servers still outstanding get lateShareGrace to answer, so that the
+// invalid shares they return are reported whether or not they arrived first, then the remaining requests are
+// cancelled. The shares are grouped by identifier: shares1[j] holds the left shares on the j-th identifier.
+// Servers that returned invalid shares, failed, or did not answer before the context's deadline are recorded,
+// by ID, in faulty. Servers still outstanding after the grace period are not, nor are the servers cut off when
+// the caller cancels the context, in which case the context's error is returned
+func collectSignatureShares(ctx context.Context, parameters publicParameters, serverlist []*serverEndpoint, query signatureQuery) (shares1, shares2 [][]*share.PubShare, faulty map[int]error, err error) {
+	t := parameters.Threshold
+	faulty = make(map[int]error)
+
+	queryCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan signatureResult, len(serverlist))
+	for _, s := range serverlist {
+		go func(s *serverEndpoint) {
+			left, right, err := query(queryCtx, s)
+			results <- signatureResult{server: s, left: left, right: right, err: err}
+		}(s)
+	}
+
+	valid := 0
+	seen := make(map[int]bool)
+	pending := make(map[int]bool)
+	for _, s := range serverlist {
+		pending[s.ID] = true
+	}
+
+	// record checks a server's answer, and keeps its shares as long as the threshold is not met
+	record := func(r signatureResult) {
+		delete(pending, r.server.ID)
+		switch {
+		case r.err != nil && ctx.Err() != nil:
+			// the request was cut off by the caller's context, not by the server
+			if ctx.Err() == context.DeadlineExceeded {
+				faulty[r.server.ID] = errServerTimeout
+			}
+		case r.err != nil:
+			faulty[r.server.ID] = r.err
+		case seen[r.left[0].I]:
+			faulty[r.server.ID] = fmt.Errorf("duplicate share index %d", r.left[0].I)
+		case valid < t:
+			seen[r.left[0].I] = true
+			valid++
+			if shares1 == nil {
+				shares1 = make([][]*share.PubShare, len(r.left))
+				shares2 = make([][]*share.PubShare, len(r.right))
+			}
+			for j := range r.left {
+				shares1[j] = append(shares1[j], r.left[j])
+				shares2[j] = append(shares2[j], r.right[j])
+			}
+		default:
+			seen[r.left[0].I] = true
 		}
-		buf2Formatted[i], err = blindtbls.SigSharetoPubShare(parameters.Suite.G2(), tbls.SigShare(buf2[i]))
-		if err != nil {
-			return err
+	}
+
+	for len(pending) > 0 && valid < t {
+		select {
+		case r := <-results:
+			record(r)
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				for id := range pending {
+					faulty[id] = errServerTimeout
+				}
+			}
+			pending = nil
+		}
+	}
+
+	if valid < t && ctx.Err() == context.Canceled {
+		return nil, nil, faulty, ctx.Err()
+	}
+	if valid < t {
+		return nil, nil, faulty, &recoveryError{valid: valid, required: t, faulty: faulty}
+	}
+
+	// The keys can be recovered, give the other servers a chance to answer before reporting
+	grace := time.NewTimer(lateShareGrace)
+	defer grace.Stop()
+	for len(pending) > 0 {
+		select {
+		case r := <-results:
+			record(r)
+		case <-grace.C:
+			pending = nil
+		case <-ctx.Done():
+			pending = nil
 		}
 	}
 
-	blindKey1, err := blindtbls.Recover(parameters.Suite, parameters.Suite.G1(), parameters.PublicPolynomials[0], blindedPublic.Left, buf1Formatted[:t], t, n)
+	return shares1, shares2, faulty, nil
+}
+
+// verifySignatureShares parses a server's response and checks both signature shares against the public polynomials
+func verifySignatureShares(parameters publicParameters, blinded crypto.PublicKeys, received keysInTransport) (*share.PubShare, *share.PubShare, error) {
+	left, err := blindtbls.SigSharetoPubShare(parameters.Suite.G1(), tbls.SigShare(received.Left))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	blindKey2, err := blindtbls.Recover(parameters.Suite, parameters.Suite.G2(), parameters.PublicPolynomials[1], blindedPublic.Right, buf2Formatted[:t], t, n)
+	right, err := blindtbls.SigSharetoPubShare(parameters.Suite.G2(), tbls.SigShare(received.Right))
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if left.I != right.I {
+		return nil, nil, errors.New("signature shares have different indices")
 	}
 
-	// Unblind
-	u.constrainingKeys.Left, err = blindbls.Unblind(parameters.Suite.G1(), BF[0], blindKey1)
+	if err := blindtbls.VerifyShare(parameters.Suite.G1(), parameters.Suite.G2(), parameters.PublicPolynomials[0], blinded.Left, left, received.LeftProof); err != nil {
+		return nil, nil, fmt.Errorf("invalid left share: %v", err)
+	}
+	if err := blindtbls.VerifyShare(parameters.Suite.G2(), parameters.Suite.G1(), parameters.PublicPolynomials[1], blinded.Right, right, received.RightProof); err != nil {
+		return nil, nil, fmt.Errorf("invalid right share: %v", err)
+	}
+
+	return left, right, nil
+}
+
+// verifySignatureBatch parses a server's response to a batch request and checks all the left shares, then
+// all the right shares, with blindtbls.VerifyBatch
+func verifySignatureBatch(parameters publicParameters, blinded []blindedRequest, received batchInTransport) ([]*share.PubShare, []*share.PubShare, error) {
+	left := make([]*share.PubShare, len(blinded))
+	right := make([]*share.PubShare, len(blinded))
+	blindedLeft := make([]kyber.Point, len(blinded))
+	blindedRight := make([]kyber.Point, len(blinded))
+	for j, b := range blinded {
+		var err error
+		if left[j], err = blindtbls.SigSharetoPubShare(parameters.Suite.G1(), received.Left[j]); err != nil {
+			return nil, nil, fmt.Errorf("share %d: %v", j, err)
+		}
+		if right[j], err = blindtbls.SigSharetoPubShare(parameters.Suite.G2(), received.Right[j]); err != nil {
+			return nil, nil, fmt.Errorf("share %d: %v", j, err)
+		}
+		if left[j].I != right[j].I {
+			return nil, nil, errors.New("signature shares have different indices")
+		}
+		blindedLeft[j], blindedRight[j] = b.blinded.Left, b.blinded.Right
+	}
+
+	if err := blindtbls.VerifyBatch(parameters.Suite, parameters.Suite.G1(), parameters.PublicPolynomials[0], blindedLeft, left); err != nil {
+		return nil, nil, fmt.Errorf("invalid left shares: %v", err)
+	}
+	if err := blindtbls.VerifyBatch(parameters.Suite, parameters.Suite.G2(), parameters.PublicPolynomials[1], blindedRight, right); err != nil {
+		return nil, nil, fmt.Errorf("invalid right shares: %v", err)
+	}
+
+	return left, right, nil
+}
+
+// recoveryError reports that too few servers returned valid signature shares, and what went wrong with the others
+type recoveryError struct {
+	valid, required int
+	faulty          map[int]error
+}
+
+func (e *recoveryError) Error() string {
+	ids := make([]int, 0, len(e.faulty))
+	for id := range e.faulty {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	msg := fmt.Sprintf("only %d valid signature shares out of the %d required", e.valid, e.required)
+	for _, id := range ids {
+		msg += fmt.Sprintf("; server %d: %v", id, e.faulty[id])
+	}
+	return msg
+}
+
+// normalisedContact returns the canonical form of contact, under which the contact enrolled: keys are
+// derived from it rather than from the identifier as the user wrote it
+func (u *user) normalisedContact(contact string) (string, error) {
+	if canonical, found := u.canonical[contact]; found {
+		return canonical, nil
+	}
+	canonical, err := normalise.Identifier(contact, u.region)
 	if err != nil {
-		return err
+		return "", err
 	}
-	u.constrainingKeys.Right, err = blindbls.Unblind(parameters.Suite.G2(), BF[1], blindKey2)
+	u.canonical[contact] = canonical
+
+	return canonical, nil
+}
+
+// computeSharedKeys derives the keys shared between each of the user's identifiers and every contact that
+// does not have them yet. Contacts are normalised before they are hashed, and the pairings are computed in
+// parallel
+func (u *user) computeSharedKeys(parameters publicParameters) error {
+	for _, id := range u.identifiers {
+		var pending, normalised []string
+		for _, contact := range u.contacts {
+			if _, found := u.sharedKeys[meeting{id.identifier, contact}]; found {
+				continue
+			}
+			canonical, err := u.normalisedContact(contact)
+			if err != nil {
+				return fmt.Errorf("%s: %v", contact, err)
+			}
+			pending = append(pending, contact)
+			normalised = append(normalised, canonical)
+		}
+
+		keys := crypto.DeriveSharedKeysBatch(parameters.Suite, u.epoch, id.constrainingKeys, normalised, 0, u.contactKeys)
+		for i, contact := range pending {
+			u.sharedKeys[meeting{id.identifier, contact}] = keys[i]
+		}
+	}
+
+	return nil
+}
+
+// meetingPoint returns the keys derived for the user's identifier own and contact, the address of the
+// meeting point they share and the normalised contact identifier the keys are bound to
+func (u *user) meetingPoint(own, contact string) (crypto.DerivedKeys, string, string, error) {
+	keys, found := u.sharedKeys[meeting{own, contact}]
+	if !found {
+		return crypto.DerivedKeys{}, "", "", errors.New("meet: no shared keys for this contact")
+	}
+	peer, err := u.normalisedContact(contact)
 	if err != nil {
-		return err
+		return crypto.DerivedKeys{}, "", "", err
+	}
+
+	derived, err := crypto.KeyDerivationFunction(keys.Outgoing, keys.Incoming, own, peer)
+	if err != nil {
+		return crypto.DerivedKeys{}, "", "", err
+	}
+
+	return derived, createMeetingPoint(u.epoch, derived.MeetingTag), peer, nil
+}
+
+// secureMeet visits the meeting points shared between each of the user's identifiers and contact. The user
+// leaves an authenticated ciphertext of their card at each one, unless the contact already left theirs: presence
+// is then proven by successfully decrypting it, and the identifier it was shared with is recorded in matchedBy
+func (u *user) secureMeet(ctx context.Context, contact string, onlineCache meetingstore.MeetingStore) error {
+	matched := false
+	for _, id := range u.identifiers {
+		card, found, err := u.meet(ctx, id.identifier, contact, onlineCache)
+		if err != nil {
+			return err
+		}
+		if !found || matched {
+			continue
+		}
+
+		matched = true
+		if !u.contactPresence[contact] {
+			u.discoveredAt[contact] = time.Now()
+			u.matchedBy[contact] = id.identifier
+		}
+		u.contactPresence[contact] = true
+		u.contactCards[contact] = card
 	}
+	u.lastChecked[contact] = time.Now()
 
 	return nil
 }
 
-func (u *user) computeSharedKeys(parameters publicParameters) {
+// meet visits the meeting point shared between the user's identifier own and contact. It returns the card the
+// contact left there, or leaves the user's own card if the point is empty
+func (u *user) meet(ctx context.Context, own, contact string, onlineCache meetingstore.MeetingStore) ([]byte, bool, error) {
+	derived, meetingPoint, peer, err := u.meetingPoint(own, contact)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sealed, err := onlineCache.Get(ctx, meetingPoint)
+	if err == nil {
+		if card, err := crypto.OpenMeetingPayload(derived, peer, own, sealed); err == nil {
+			return card, true, nil
+		}
+		if _, err := crypto.OpenMeetingPayload(derived, own, peer, sealed); err == nil {
+			// this is the payload we left earlier, the contact has not shown up yet
+			return nil, false, nil
+		}
+		return nil, false, errors.New("meet: meeting point holds an invalid payload")
+	} else if err != meetingstore.ErrNotFound {
+		return nil, false, err
+	}
+
+	sealed, err = crypto.SealMeetingPayload(derived, own, peer, u.card)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = leavePayload(ctx, onlineCache, meetingPoint, sealed, meetingPointOwner(derived, own))
+	if err == meetingstore.ErrOccupied {
+		// the contact left their payload since we looked
+		return u.meet(ctx, own, contact, onlineCache)
+	}
+	return nil, false, err
+}
+
+// match is a person found on the service. A person listed in the address book under several identifiers is
+// found at the meeting points of each of them and leaves the same card at all, so contacts are told apart by
+// their card: contacts are the address book entries of the person that matched, own the user's identifiers
+// they were found with
+type match struct {
+	card     string
+	contacts []string
+	own      []string
+}
+
+// checkContacts visits the meeting points of the contacts that were not found yet and returns the people
+// found this time, with the identifiers they were found under
+func (u *user) checkContacts(ctx context.Context, onlineCache meetingstore.MeetingStore) ([]match, error) {
+	var found []string
 	for _, contact := range u.contacts {
-		sharedAB, sharedBA := crypto.DeriveSharedKeys(parameters.Suite, u.constrainingKeys, contact)
-		u.sharedKeys[contact] = crypto.SharedKeys{Outgoing: sharedAB, Incoming: sharedBA}
+		if u.contactPresence[contact] {
+			continue
+		}
+		if err := u.secureMeet(ctx, contact, onlineCache); err != nil {
+			return u.matches(found), fmt.Errorf("%s: %v", contact, err)
+		}
+		if u.contactPresence[contact] {
+			found = append(found, contact)
+		}
 	}
+
+	return u.matches(found), nil
 }
 
-func (u *user) insecureMeet(contact string, onlineCache meetingPlatform) {
-	if keys, found := u.sharedKeys[contact]; found {
-		keymaterial, _ := crypto.KeyDerivationFunction(keys.Outgoing, keys.Incoming)
-		meetingPoint := createMeetingPoint(keymaterial)
+// matches groups contacts that were found by the person behind them, in the order of the contacts
+func (u *user) matches(contacts []string) []match {
+	var people []match
+	index := make(map[string]int)
+	for _, contact := range contacts {
+		card := string(u.contactCards[contact])
+		i, known := index[card]
+		if !known {
+			i = len(people)
+			index[card] = i
+			people = append(people, match{card: card})
+		}
+		people[i].contacts = append(people[i].contacts, contact)
+		if own := u.matchedBy[contact]; !contains(people[i].own, own) {
+			people[i].own = append(people[i].own, own)
+		}
+	}
 
-		if x, found := onlineCache[meetingPoint]; found {
-			if hex.EncodeToString(x) == hex.EncodeToString(keymaterial) {
-				u.contactPresence[contact] = true
-			}
-		} else {
-			onlineCache[meetingPoint] = keymaterial
+	return people
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
 		}
 	}
+	return false
 }
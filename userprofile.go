@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nmohnblatt/contact_discovery2/crypto"
+	"github.com/nmohnblatt/contact_discovery2/profile"
+)
+
+// toProfile captures the user's keys and discovery state. fingerprint identifies the public keys the
+// constraining keys were obtained under (see publicKeyFingerprint)
+func (u *user) toProfile(fingerprint string) (*profile.Profile, error) {
+	p := &profile.Profile{
+		Parameters: fingerprint,
+		Epoch:      u.epoch,
+		Region:     u.region,
+		Card:       u.card,
+		Updated:    time.Now(),
+	}
+
+	for _, id := range u.identifiers {
+		saved := profile.Identifier{Identifier: id.identifier}
+		var err error
+		if saved.Left, err = id.constrainingKeys.Left.MarshalBinary(); err != nil {
+			return nil, err
+		}
+		if saved.Right, err = id.constrainingKeys.Right.MarshalBinary(); err != nil {
+			return nil, err
+		}
+		p.Identifiers = append(p.Identifiers, saved)
+	}
+
+	for _, contact := range u.contacts {
+		c := profile.Contact{
+			Identifier:   contact,
+			LastChecked:  u.lastChecked[contact],
+			DiscoveredAt: u.discoveredAt[contact],
+			MatchedBy:    u.matchedBy[contact],
+			Card:         u.contactCards[contact],
+		}
+		for _, id := range u.identifiers {
+			keys, found := u.sharedKeys[meeting{id.identifier, contact}]
+			if !found {
+				continue
+			}
+			saved := profile.SharedKeys{Own: id.identifier}
+			var err error
+			if saved.Outgoing, err = keys.Outgoing.MarshalBinary(); err != nil {
+				return nil, err
+			}
+			if saved.Incoming, err = keys.Incoming.MarshalBinary(); err != nil {
+				return nil, err
+			}
+			c.Keys = append(c.Keys, saved)
+		}
+		p.Contacts = append(p.Contacts, c)
+	}
+
+	return p, nil
+}
+
+// userFromProfile restores a user saved with toProfile. The profile is refused if it was saved under other
+// public keys. It is still accepted after a reshare, which keeps the public keys
+func userFromProfile(parameters publicParameters, fingerprint string, p *profile.Profile) (*user, error) {
+	if p.Parameters != fingerprint {
+		return nil, fmt.Errorf("profile: keys were obtained under public keys %s, not %s", p.Parameters, fingerprint)
+	}
+	if len(p.Identifiers) == 0 {
+		return nil, errors.New("profile: no identifier")
+	}
+
+	contacts := make([]string, len(p.Contacts))
+	for i, c := range p.Contacts {
+		contacts[i] = c.Identifier
+	}
+	u := newUser(parameters, p.Identifier(), contacts)
+	u.region = p.Region
+	for _, saved := range p.Identifiers[1:] {
+		if err := u.addIdentifier(parameters, saved.Identifier); err != nil {
+			return nil, err
+		}
+	}
+	if u.epoch != p.Epoch {
+		u.startEpoch(parameters, p.Epoch)
+	}
+	if p.Card != nil {
+		u.card = p.Card
+	}
+
+	for i, saved := range p.Identifiers {
+		id := u.identifiers[i]
+		if err := id.constrainingKeys.Left.UnmarshalBinary(saved.Left); err != nil {
+			return nil, err
+		}
+		if err := id.constrainingKeys.Right.UnmarshalBinary(saved.Right); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range p.Contacts {
+		for _, saved := range c.Keys {
+			if u.identifier(saved.Own) == nil {
+				return nil, fmt.Errorf("profile: %s has keys for unknown identifier %s", c.Identifier, saved.Own)
+			}
+			keys := crypto.SharedKeys{Outgoing: parameters.Suite.GT().Point(), Incoming: parameters.Suite.GT().Point()}
+			if err := keys.Outgoing.UnmarshalBinary(saved.Outgoing); err != nil {
+				return nil, err
+			}
+			if err := keys.Incoming.UnmarshalBinary(saved.Incoming); err != nil {
+				return nil, err
+			}
+			u.sharedKeys[meeting{saved.Own, c.Identifier}] = keys
+		}
+		if !c.LastChecked.IsZero() {
+			u.lastChecked[c.Identifier] = c.LastChecked
+		}
+		if c.Discovered() {
+			u.discoveredAt[c.Identifier] = c.DiscoveredAt
+			u.contactPresence[c.Identifier] = true
+			u.contactCards[c.Identifier] = c.Card
+			u.matchedBy[c.Identifier] = c.MatchedBy
+		}
+	}
+
+	return u, nil
+}